@@ -0,0 +1,31 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// bellObserver rings the terminal bell when a command finishes: on
+// failure with --bell-on-failure, on success with --bell-on-success.
+type bellObserver struct {
+	w                    io.Writer
+	onFailure, onSuccess bool
+}
+
+func (o bellObserver) OnEvent(e Event) {
+	if e.Kind != CommandFinished {
+		return
+	}
+	if (e.Failed && o.onFailure) || (!e.Failed && o.onSuccess) {
+		_, _ = io.WriteString(o.w, "\a")
+	}
+}
+
+// addBellObserver registers the bell for the --bell-on-* flags and returns
+// a function removing it. Nothing rings unless stderr is a terminal.
+func addBellObserver() func() {
+	if (!*bellOnFailure && !*bellOnSuccess) || !isTerminal(os.Stderr) {
+		return func() {}
+	}
+	return AddObserver(bellObserver{w: os.Stderr, onFailure: *bellOnFailure, onSuccess: *bellOnSuccess})
+}
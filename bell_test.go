@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the bell rings for failed commands only when enabled
+func TestBellOnFailure(t *testing.T) {
+	rule := Rule{Name: "build", Commands: []Command{{Cmd: "false"}, {Cmd: "true"}}}
+	bells := func(o bellObserver) string {
+		var out bytes.Buffer
+		o.w = &out
+		defer AddObserver(o)()
+		_, err := runRule(context.Background(), rule, []string{"main.go"}, "*.go", failureContinue)
+		assert.NoError(t, err)
+		return out.String()
+	}
+
+	assert.Equal(t, "\a", bells(bellObserver{onFailure: true}))
+	assert.Equal(t, "", bells(bellObserver{}))
+	assert.Equal(t, "\a", bells(bellObserver{onSuccess: true}))
+	assert.Equal(t, "\a\a", bells(bellObserver{onFailure: true, onSuccess: true}))
+}
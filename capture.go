@@ -0,0 +1,218 @@
+package main
+
+import (
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Parentheses in a rule pattern capture the path segment matched by the
+// wildcards inside them, e.g. "proto/(*).proto", and a named group
+// "(?P<name>...)" also makes it available by name. Commands use the
+// captures as {{.1}}, {{.2}}, ... in pattern order, {{index .Captures 1}},
+// or by name as {{.Named.name}}. A backslash escapes the character after
+// it, so "\(" and "\)" match literal parentheses.
+
+// captureOpen starts a named capture group in a pattern.
+const captureOpen = "(?P<"
+
+// capturePlaceholder matches the {{.N}} shorthand for a capture.
+var capturePlaceholder = regexp.MustCompile(`\{\{\s*\.(\d+)\s*\}\}`)
+
+// hasCaptures reports whether a pattern contains capture groups.
+func hasCaptures(pattern string) bool {
+	return strings.Contains(pattern, "(") && stripCaptures(pattern) != pattern
+}
+
+// scanCaptures walks a pattern, calling open with the name of each
+// capture group, empty for unnamed ones, close at its end, and literal
+// with everything else, escapes included. A ")" closing no group is
+// literal.
+func scanCaptures(pattern string, open func(name string), close func(), literal func(s string)) {
+	groups := 0
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\' && i+1 < len(pattern):
+			literal(pattern[i : i+2])
+			i++
+		case strings.HasPrefix(pattern[i:], captureOpen) && strings.IndexByte(pattern[i:], '>') > 0:
+			end := i + strings.IndexByte(pattern[i:], '>')
+			open(pattern[i+len(captureOpen) : end])
+			groups++
+			i = end
+		case c == '(':
+			open("")
+			groups++
+		case c == ')' && groups > 0:
+			close()
+			groups--
+		default:
+			literal(string(c))
+		}
+	}
+}
+
+// captureCount returns the number of capture groups in a pattern.
+func captureCount(pattern string) int {
+	n := 0
+	scanCaptures(pattern, func(string) { n++ }, func() {}, func(string) {})
+	return n
+}
+
+// missingCapture returns the first {{.N}} placeholder of a rule's commands
+// and env for which none of its patterns has a capture group N, and
+// whether there is one.
+func missingCapture(rule Rule) (int, bool) {
+	groups := 0
+	for _, pattern := range rule.Patterns {
+		groups = max(groups, captureCount(pattern))
+	}
+	var templates []string
+	for _, cmd := range rule.Commands {
+		templates = append(append(templates, cmd.Cmd), cmd.Args...)
+	}
+	for _, key := range slices.Sorted(maps.Keys(rule.Env)) {
+		templates = append(templates, rule.Env[key])
+	}
+	for _, tmpl := range templates {
+		for _, m := range capturePlaceholder.FindAllStringSubmatch(tmpl, -1) {
+			if n, err := strconv.Atoi(m[1]); err == nil && n > groups {
+				return n, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// stripCaptures returns the pattern without its capture group syntax, as
+// a plain glob for matching and watching.
+func stripCaptures(pattern string) string {
+	if !strings.Contains(pattern, "(") {
+		return pattern
+	}
+	var b strings.Builder
+	scanCaptures(pattern, func(string) {}, func() {}, func(s string) { b.WriteString(s) })
+	return b.String()
+}
+
+// captureRegexp translates a pattern with capture groups into a regular
+// expression with the same groups. Wildcards match like the glob matcher
+// used for rules: "**" crosses directory separators, "*" and "?" do not.
+func captureRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	braces := 0
+	// class collects a character class until its closing bracket
+	var class *strings.Builder
+	stars := 0
+	flushStars := func() {
+		switch {
+		case stars > 1:
+			b.WriteString(".*")
+		case stars == 1:
+			b.WriteString("[^/]*")
+		}
+		stars = 0
+	}
+	scanCaptures(pattern,
+		func(name string) {
+			flushStars()
+			if name == "" {
+				b.WriteString("(")
+			} else {
+				b.WriteString(captureOpen + name + ">")
+			}
+		},
+		func() {
+			flushStars()
+			b.WriteString(")")
+		},
+		func(s string) {
+			if class != nil {
+				if s == "]" {
+					// Glob classes negate with "!"
+					chars := class.String()
+					if strings.HasPrefix(chars, "!") {
+						chars = "^" + chars[1:]
+					}
+					b.WriteString("[" + chars + "]")
+					class = nil
+				} else {
+					class.WriteString(s)
+				}
+				return
+			}
+			if s == "*" {
+				stars++
+				return
+			}
+			flushStars()
+			switch {
+			case s == "?":
+				b.WriteString("[^/]")
+			case s == "{":
+				braces++
+				b.WriteString("(?:")
+			case s == "}" && braces > 0:
+				braces--
+				b.WriteString(")")
+			case s == "," && braces > 0:
+				b.WriteString("|")
+			case s == "[":
+				class = &strings.Builder{}
+			case len(s) == 2 && s[0] == '\\':
+				b.WriteString(regexp.QuoteMeta(s[1:]))
+			default:
+				b.WriteString(regexp.QuoteMeta(s))
+			}
+		})
+	flushStars()
+	if class != nil {
+		b.WriteString(`\[` + regexp.QuoteMeta(class.String()))
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// matchCaptures returns the whole path followed by the captured segments
+// of the first path matching the pattern, and the captures by name, or
+// nil when no path matches.
+func matchCaptures(pattern string, paths ...string) ([]string, map[string]string) {
+	re, err := captureRegexp(pattern)
+	if err != nil {
+		return nil, nil
+	}
+	for _, path := range paths {
+		captures := re.FindStringSubmatch(path)
+		if captures == nil {
+			continue
+		}
+		named := make(map[string]string)
+		for i, name := range re.SubexpNames() {
+			if name != "" {
+				named[name] = captures[i]
+			}
+		}
+		return captures, named
+	}
+	return nil, nil
+}
+
+// unescapePattern drops the backslashes escaping glob metacharacters and
+// parentheses, turning a literal pattern into the path it names.
+func unescapePattern(pattern string) string {
+	if !strings.Contains(pattern, `\`) {
+		return pattern
+	}
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '\\' && i+1 < len(pattern) && strings.IndexByte(`*?[]{}(),!\`, pattern[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(pattern[i])
+	}
+	return b.String()
+}
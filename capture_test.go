@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test substituting a captured path segment into the command
+func TestPatternCaptures(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.txt")
+	config := Config{
+		Rules: []Rule{
+			{
+				Patterns: []string{"proto/(*).proto"},
+				Commands: []Command{{Cmd: "echo protoc {{.1}}.proto >> " + out}},
+			},
+			{
+				Patterns: []string{"proto/(?P<name>*).proto"},
+				Commands: []Command{{Cmd: "echo named {{.1}} {{.Named.name}} >> " + out}},
+			},
+		},
+	}
+	assert.NoError(t, config.Validate())
+
+	ran, err := executeRules(context.Background(), []string{"proto/user.proto", "api/user.go"}, config)
+	assert.NoError(t, err)
+	assert.True(t, ran)
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "protoc user.proto\nnamed user user\n", string(data))
+
+	// A placeholder without a group to fill it is a configuration error
+	for _, rule := range []Rule{
+		{Patterns: []string{`proto/\(*\).proto`}, Commands: []Command{{Cmd: "protoc {{.1}}.proto"}}},
+		{Patterns: []string{"proto/(*).proto"}, Commands: []Command{{Cmd: "protoc {{ .2 }}"}}},
+		{Patterns: []string{"*.proto"}, Commands: []Command{{Args: []string{"protoc", "{{.1}}"}}}},
+	} {
+		assert.ErrorContains(t, Config{Rules: []Rule{rule}}.Validate(), "capture group", "%+v", rule)
+	}
+
+	captures, named := matchCaptures("services/(?P<service>*)/{cmd,pkg}/(?P<file>*).go", "services/api/cmd/main.go")
+	assert.Equal(t, []string{"services/api/cmd/main.go", "api", "main"}, captures)
+	assert.Equal(t, map[string]string{"service": "api", "file": "main"}, named)
+	captures, _ = matchCaptures("proto/(?P<name>*).proto", "api/user.go")
+	assert.Nil(t, captures)
+	captures, _ = matchCaptures("(*)/(**).go", "cmd/server/main.go")
+	assert.Equal(t, []string{"cmd/server/main.go", "cmd", "server/main"}, captures)
+	assert.Equal(t, "proto/*.proto", stripCaptures("proto/(?P<name>*).proto"))
+	assert.Equal(t, "proto/*.proto", stripCaptures("proto/(*).proto"))
+
+	rendered, err := renderCommand("make {{ .2 }} DIR={{index .Captures 1}}", MatchData{Captures: []string{"services/api/cmd/main.go", "api", "main"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "make main DIR=api", rendered)
+	_, err = renderCommand("make {{.3}}", MatchData{Captures: []string{"services/api/cmd/main.go", "api", "main"}})
+	assert.Error(t, err)
+}
+
+// Test that escaped parentheses are matched literally
+func TestLiteralParentheses(t *testing.T) {
+	page := filepath.Join("app", "(marketing)", "page.tsx")
+	pattern := `app/\(marketing\)/*.tsx`
+	assert.False(t, hasCaptures(pattern))
+	assert.True(t, matchPattern(Rule{}, pattern, page))
+	assert.False(t, matchPattern(Rule{}, pattern, filepath.Join("app", "marketing", "page.tsx")))
+
+	// Without the escapes, the parentheses are a capture group
+	assert.True(t, hasCaptures("app/(marketing)/*.tsx"))
+	assert.True(t, matchPattern(Rule{}, "app/(marketing)/*.tsx", filepath.Join("app", "marketing", "page.tsx")))
+
+	// Literal parentheses next to a capture group
+	captures, _ := matchCaptures(`app/\(marketing\)/(*).tsx`, "app/(marketing)/about.tsx")
+	assert.Equal(t, []string{"app/(marketing)/about.tsx", "about"}, captures)
+	assert.Equal(t, `app/\(marketing\)/*.tsx`, stripCaptures(`app/\(marketing\)/(?P<page>*).tsx`))
+	assert.Equal(t, `a/\(?P<x>*\)`, stripCaptures(`a/\(?P<x>*\)`))
+
+	// An escaped literal pattern resolves to the path it names
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(page), 0755))
+	assert.NoError(t, os.WriteFile(page, nil, 0644))
+	for _, pattern := range []string{`app/\(marketing\)/page.tsx`, `app/\(marketing\)/*.tsx`} {
+		resolved, err := resolvePattern(pattern, Config{})
+		assert.NoError(t, err)
+		if assert.Len(t, resolved, 1, pattern) {
+			assert.Equal(t, filepath.ToSlash(page), filepath.ToSlash(resolved[0]), pattern)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// changeLogWindow is how long changes are collected into one log line.
+const changeLogWindow = time.Second
+
+// changeLogger coalesces "Change detected" lines: changes arriving within
+// the window are reported as a single summary, while each path is logged
+// at debug level.
+type changeLogger struct {
+	window time.Duration
+
+	mu    sync.Mutex
+	count int
+	first string
+}
+
+func newChangeLogger(window time.Duration) *changeLogger {
+	return &changeLogger{window: window}
+}
+
+// Record notes a detected change, starting a new window if none is open.
+// The debug line includes the operations fsnotify reported.
+func (c *changeLogger) Record(event fsnotify.Event) {
+	path := event.Name
+	debugf("Change detected: %s (%s)", path, event.Op)
+	emit(Event{Kind: ChangeDetected, Files: []string{path}})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.count++
+	if c.count == 1 {
+		c.first = path
+		time.AfterFunc(c.window, c.flush)
+	}
+}
+
+// flush logs the changes of the current window and closes it.
+func (c *changeLogger) flush() {
+	c.mu.Lock()
+	count, first := c.count, c.first
+	c.count, c.first = 0, ""
+	c.mu.Unlock()
+
+	switch {
+	case count > 1:
+		logger.Printf("Detected %d changes", count)
+	case count == 1 && !debugEnabled():
+		logger.Printf("Change detected: %s", first)
+	}
+}
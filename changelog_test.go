@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that a burst of changes is logged as a single summary line
+func TestChangeLoggerCoalescing(t *testing.T) {
+	var out syncBuffer
+	logger.SetOutput(&out)
+	defer logger.SetOutput(os.Stdout)
+
+	changes := newChangeLogger(100 * time.Millisecond)
+	for i := 0; i < 100; i++ {
+		changes.Record(fsnotify.Event{Name: fmt.Sprintf("src/file%d.go", i), Op: fsnotify.Write})
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 1)
+	assert.Contains(t, lines[0], "Detected 100 changes")
+	assert.NotContains(t, lines[0], "[debug]")
+
+	out.Reset()
+	changes.Record(fsnotify.Event{Name: "src/single.go", Op: fsnotify.Write})
+	time.Sleep(300 * time.Millisecond)
+	assert.Contains(t, out.String(), "Change detected: src/single.go")
+}
+
+// Test that the debug change line names the fsnotify operation
+func TestChangeLoggerOp(t *testing.T) {
+	var out syncBuffer
+	logger.SetOutput(&out)
+	level := *logLevel
+	*logLevel = "debug"
+	defer func() {
+		logger.SetOutput(os.Stdout)
+		*logLevel = level
+	}()
+
+	changes := newChangeLogger(time.Hour)
+	changes.Record(fsnotify.Event{Name: "src/new.go", Op: fsnotify.Create})
+	assert.Contains(t, out.String(), "[debug] Change detected: src/new.go (CREATE)")
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent log writes and reads.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *syncBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// completionShells are the shells `go-watch completion` writes scripts for.
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// subcommands are the positional commands go-watch accepts.
+var subcommands = []string{"completion"}
+
+// pathFlags are flags whose value is a file ("file") or a directory ("dir"),
+// completed from the file system.
+var pathFlags = map[string]string{
+	"config":       "file",
+	"explain":      "file",
+	"from-file":    "file",
+	"wait-for":     "file",
+	"trigger-fifo": "file",
+	"summary-file": "file",
+	"cwd":          "dir",
+}
+
+// completionFlag is a visible command-line flag as seen by the completion
+// scripts.
+type completionFlag struct {
+	name  string
+	usage string
+	bool  bool
+}
+
+// completionFlags returns the flags shown in the usage message.
+func completionFlags() []completionFlag {
+	var flags []completionFlag
+	flag.VisitAll(func(f *flag.Flag) {
+		if hiddenFlags[f.Name] {
+			return
+		}
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completionFlag{name: f.Name, usage: f.Usage, bool: ok && b.IsBoolFlag()})
+	})
+	return flags
+}
+
+// runCompletion handles `go-watch completion <shell>`, writing the script
+// to w. It returns the exit code.
+func runCompletion(w, errw io.Writer, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(errw, "usage: go-watch completion %s\n", strings.Join(completionShells, "|"))
+		return 2
+	}
+	if err := writeCompletion(w, args[0]); err != nil {
+		fmt.Fprintln(errw, err)
+		return 2
+	}
+	return 0
+}
+
+// writeCompletion writes the completion script for shell to w.
+func writeCompletion(w io.Writer, shell string) error {
+	flags := completionFlags()
+	switch shell {
+	case "bash":
+		writeBashCompletion(w, flags)
+	case "zsh":
+		writeZshCompletion(w, flags)
+	case "fish":
+		writeFishCompletion(w, flags)
+	default:
+		return fmt.Errorf("unsupported shell %q, use one of %s", shell, strings.Join(completionShells, ", "))
+	}
+	return nil
+}
+
+func writeBashCompletion(w io.Writer, flags []completionFlag) {
+	var names, files, dirs []string
+	for _, f := range flags {
+		names = append(names, "--"+f.name)
+		switch pathFlags[f.name] {
+		case "file":
+			files = append(files, "--"+f.name, "-"+f.name)
+		case "dir":
+			dirs = append(dirs, "--"+f.name, "-"+f.name)
+		}
+	}
+	fmt.Fprintf(w, `# bash completion for go-watch
+_go_watch() {
+	local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+	case "$prev" in
+	completion)
+		COMPREPLY=($(compgen -W "%s" -- "$cur"))
+		return
+		;;
+	%s)
+		COMPREPLY=($(compgen -f -- "$cur"))
+		return
+		;;
+	%s)
+		COMPREPLY=($(compgen -d -- "$cur"))
+		return
+		;;
+	esac
+	if [[ "$cur" == -* ]]; then
+		COMPREPLY=($(compgen -W "%s" -- "$cur"))
+	else
+		COMPREPLY=($(compgen -W "%s" -- "$cur"))
+	fi
+}
+complete -o default -F _go_watch go-watch
+`, strings.Join(completionShells, " "), strings.Join(files, "|"), strings.Join(dirs, "|"),
+		strings.Join(names, " "), strings.Join(subcommands, " "))
+}
+
+func writeZshCompletion(w io.Writer, flags []completionFlag) {
+	fmt.Fprintln(w, "#compdef go-watch")
+	fmt.Fprintln(w, "_arguments \\")
+	escape := strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`)
+	for _, f := range flags {
+		spec := fmt.Sprintf("--%s[%s]", f.name, escape.Replace(f.usage))
+		if !f.bool {
+			switch pathFlags[f.name] {
+			case "file":
+				spec += ":" + f.name + ":_files"
+			case "dir":
+				spec += ":" + f.name + ":_files -/"
+			default:
+				spec += ":" + f.name + ": "
+			}
+		}
+		fmt.Fprintf(w, "  '%s' \\\n", spec)
+	}
+	fmt.Fprintf(w, "  '1::command:(%s)' \\\n", strings.Join(subcommands, " "))
+	fmt.Fprintf(w, "  '2::shell:(%s)'\n", strings.Join(completionShells, " "))
+}
+
+func writeFishCompletion(w io.Writer, flags []completionFlag) {
+	fmt.Fprintln(w, "# fish completion for go-watch")
+	quote := strings.NewReplacer(`\`, `\\`, "'", `\'`)
+	for _, f := range flags {
+		line := fmt.Sprintf("complete -c go-watch -l %s -d '%s'", f.name, quote.Replace(f.usage))
+		if !f.bool {
+			switch pathFlags[f.name] {
+			case "file":
+				line += " -r -F"
+			case "dir":
+				line += " -r -a '(__fish_complete_directories)'"
+			default:
+				line += " -r -f"
+			}
+		}
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintf(w, "complete -c go-watch -n '__fish_use_subcommand' -f -a '%s'\n", strings.Join(subcommands, " "))
+	fmt.Fprintf(w, "complete -c go-watch -n '__fish_seen_subcommand_from completion' -f -a '%s'\n", strings.Join(completionShells, " "))
+}
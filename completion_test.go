@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the generated completion scripts
+func TestCompletion(t *testing.T) {
+	var out, errOut bytes.Buffer
+	assert.Equal(t, 0, runCompletion(&out, &errOut, []string{"bash"}))
+	script := out.String()
+	for _, name := range []string{"--config", "--ignore-dirs", "--debounce-time", "--rules", "--shell", "--once", "--disable-rule"} {
+		assert.Contains(t, script, name+" ")
+	}
+	assert.NotContains(t, script, " --cpuprofile")
+	assert.Contains(t, script, "complete -o default -F _go_watch go-watch")
+	assert.Contains(t, script, `compgen -W "bash zsh fish"`)
+
+	for _, shell := range []string{"zsh", "fish"} {
+		out.Reset()
+		assert.Equal(t, 0, runCompletion(&out, &errOut, []string{shell}))
+		assert.Contains(t, out.String(), "config-check")
+	}
+	assert.True(t, strings.HasPrefix(out.String(), "# fish completion"))
+
+	assert.Equal(t, 2, runCompletion(&out, &errOut, []string{"powershell"}))
+	assert.Equal(t, 2, runCompletion(&out, &errOut, nil))
+	assert.Contains(t, errOut.String(), "usage: go-watch completion bash|zsh|fish")
+}
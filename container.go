@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+)
+
+// containerWorkdir is where the working directory is mounted inside the
+// container of a command with a container image.
+const containerWorkdir = "/work"
+
+// Container runtimes accepted by --container-runtime.
+const (
+	runtimeDocker = "docker"
+	runtimePodman = "podman"
+)
+
+// containerRunner builds the invocation running a shell script in a
+// container image, with dir mounted as the working directory. env names
+// variables passed on from go-watch's environment.
+type containerRunner interface {
+	Invocation(image, dir, script string, env []string) []string
+}
+
+// cliRunner runs containers with a docker compatible CLI, such as docker
+// or podman.
+type cliRunner struct {
+	binary string
+}
+
+func (r cliRunner) Invocation(image, dir, script string, env []string) []string {
+	args := []string{r.binary, "run", "--rm", "-v", dir + ":" + containerWorkdir, "-w", containerWorkdir}
+	for _, name := range env {
+		args = append(args, "-e", name)
+	}
+	return append(args, image, "sh", "-c", script)
+}
+
+// newContainerRunner returns the runner of --container-runtime; tests
+// replace it with a fake.
+var newContainerRunner = func() containerRunner {
+	return cliRunner{binary: *containerRuntime}
+}
+
+// containerScript returns the shell script running cmd in its container.
+// Args are quoted, since they bypass the shell outside of containers.
+func containerScript(cmd Command) string {
+	if len(cmd.Args) == 0 {
+		return cmd.Cmd
+	}
+	quoted := make([]string, len(cmd.Args))
+	for i, arg := range cmd.Args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// envNames returns the names of environment entries in NAME=value form.
+func envNames(env []string) []string {
+	names := make([]string, 0, len(env))
+	for _, entry := range env {
+		name, _, _ := strings.Cut(entry, "=")
+		names = append(names, name)
+	}
+	return names
+}
+
+// withDefaultContainer returns the commands with the rule's container
+// image set on those without their own.
+func withDefaultContainer(cmds []Command, image string) []Command {
+	if image == "" {
+		return cmds
+	}
+	resolved := make([]Command, len(cmds))
+	for i, cmd := range cmds {
+		if cmd.Container == "" {
+			cmd.Container = image
+		}
+		resolved[i] = cmd
+	}
+	return resolved
+}
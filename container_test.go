@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRunner records the invocations asked for and runs true instead.
+type fakeRunner struct {
+	calls [][]string
+}
+
+func (r *fakeRunner) Invocation(image, dir, script string, env []string) []string {
+	r.calls = append(r.calls, append([]string{image, dir, script}, env...))
+	return []string{"true"}
+}
+
+// Test that commands with a container image run through the container
+// runner, with the working directory mounted
+func TestContainerCommands(t *testing.T) {
+	runner := &fakeRunner{}
+	defer func(original func() containerRunner) { newContainerRunner = original }(newContainerRunner)
+	newContainerRunner = func() containerRunner { return runner }
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+
+	config := Config{Rules: []Rule{{
+		Name:      "build",
+		Container: "golang:1.23",
+		Env:       map[string]string{"TARGET": "{{.Base}}"},
+		Patterns:  []string{"*.go"},
+		Commands: []Command{
+			{Cmd: "go build ./..."},
+			{Args: []string{"node", "-e", "console.log('hi')"}, Container: "node:22"},
+		},
+	}}}
+	reports, err := executeBatch(context.Background(), ruleBatch{files: []string{"main.go"}}, config)
+	assert.NoError(t, err)
+	if assert.Len(t, reports, 1) {
+		assert.False(t, reports[0].Failed())
+	}
+	if assert.Len(t, runner.calls, 2) {
+		assert.Equal(t, []string{"golang:1.23", wd, "go build ./...", "GO_WATCH_FILE", "GOWATCH_RUN_ID", "TARGET"}, runner.calls[0])
+		assert.Equal(t, []string{"node:22", wd, `node -e 'console.log('\''hi'\'')'`, "GO_WATCH_FILE", "GOWATCH_RUN_ID", "TARGET"}, runner.calls[1])
+	}
+
+	// Commands without an image run as usual
+	runner.calls = nil
+	config.Rules[0].Container = ""
+	config.Rules[0].Commands = config.Rules[0].Commands[:1]
+	config.Rules[0].Commands[0].Cmd = "true"
+	_, err = executeBatch(context.Background(), ruleBatch{files: []string{"main.go"}}, config)
+	assert.NoError(t, err)
+	assert.Empty(t, runner.calls)
+}
+
+// Test the invocation of the docker compatible runtimes
+func TestContainerInvocation(t *testing.T) {
+	assert.Equal(t,
+		[]string{"docker", "run", "--rm", "-v", "/src/app:/work", "-w", "/work", "-e", "GO_WATCH_FILE", "golang:1.23", "sh", "-c", "go test ./..."},
+		cliRunner{binary: "docker"}.Invocation("golang:1.23", "/src/app", "go test ./...", []string{"GO_WATCH_FILE"}))
+	assert.Equal(t,
+		[]string{"podman", "run", "--rm", "-v", "/src/app:/work", "-w", "/work", "alpine", "sh", "-c", "make"},
+		cliRunner{binary: "podman"}.Invocation("alpine", "/src/app", "make", nil))
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// sniffLen is how much of a file is read to detect its content type, all
+// that http.DetectContentType looks at.
+const sniffLen = 512
+
+// sniffContentType detects the MIME type of a file from its first bytes,
+// e.g. "image/png" or "text/plain; charset=utf-8".
+func sniffContentType(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return http.DetectContentType(head[:n]), nil
+}
+
+// contentTypeFilter keeps the files whose content type starts with the
+// rule's content_type. Files that can't be read, e.g. removed ones, are
+// dropped.
+func contentTypeFilter(rule Rule, files []string) []string {
+	if rule.ContentType == "" {
+		return files
+	}
+	var kept []string
+	for _, file := range files {
+		contentType, err := sniffContentType(file)
+		if err != nil {
+			debugf("Skipping %s for rule %s: %v", file, rule.Name, err)
+			continue
+		}
+		if !strings.HasPrefix(contentType, rule.ContentType) {
+			debugf("Skipping %s for rule %s: content type %s", file, rule.Name, contentType)
+			continue
+		}
+		kept = append(kept, file)
+	}
+	return kept
+}
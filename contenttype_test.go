@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that content_type matches files by their sniffed MIME type
+func TestContentType(t *testing.T) {
+	dir := t.TempDir()
+	image := filepath.Join(dir, "photo.dat")
+	text := filepath.Join(dir, "notes.dat")
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	assert.NoError(t, os.WriteFile(image, png, 0644))
+	assert.NoError(t, os.WriteFile(text, []byte("just some notes"), 0644))
+	out := filepath.Join(t.TempDir(), "runs.txt")
+
+	config := Config{
+		Rules: []Rule{{
+			Name:        "images",
+			Patterns:    []string{filepath.Join(dir, "*.dat")},
+			ContentType: "image/",
+			Commands:    []Command{{Cmd: "echo {{.Base}} >> " + out}},
+		}},
+	}
+	assert.NoError(t, config.Validate())
+
+	files := []string{image, text, filepath.Join(dir, "gone.dat")}
+	reports, err := executeBatch(context.Background(), ruleBatch{files: files}, config)
+	assert.NoError(t, err)
+	if assert.Len(t, reports, 1) {
+		assert.Equal(t, []string{image}, reports[0].Files)
+	}
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "photo.dat\n", string(data))
+
+	contentType, err := sniffContentType(text)
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", contentType)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Debounce modes accepted by debounce_mode.
+const (
+	debounceFixed    = "fixed"
+	debounceAdaptive = "adaptive"
+)
+
+// defaultDebounceMaxFactor sets debounce_max, when it is not set, to this
+// many times debounce_min.
+const defaultDebounceMaxFactor = 10
+
+// debouncer decides how long changes must be quiet to settle. A fixed
+// debouncer always waits the debounce time. An adaptive one doubles its
+// window when a change arrives within the current window, and halves it
+// for every window that passed without changes, staying within min and
+// max.
+type debouncer struct {
+	window   time.Duration
+	min, max time.Duration
+	adaptive bool
+	last     time.Time
+}
+
+// newDebouncer returns the debouncer for the configuration, which must be
+// valid. fixed is the debounce time.
+func newDebouncer(config Config, fixed time.Duration) *debouncer {
+	if config.DebounceMode != debounceAdaptive {
+		return &debouncer{window: fixed, min: fixed, max: fixed}
+	}
+	lower, upper, _ := debounceBounds(config, fixed)
+	return &debouncer{window: lower, min: lower, max: upper, adaptive: true}
+}
+
+// debounceBounds returns the debounce_min and debounce_max of an adaptive
+// configuration. debounce_min defaults to the debounce time.
+func debounceBounds(config Config, fixed time.Duration) (lower, upper time.Duration, err error) {
+	lower = fixed
+	if config.DebounceMin != "" {
+		if lower, err = time.ParseDuration(config.DebounceMin); err != nil {
+			return 0, 0, fmt.Errorf("invalid debounce_min: %v", err)
+		}
+	}
+	if lower <= 0 {
+		return 0, 0, fmt.Errorf("adaptive debounce needs a positive debounce_min")
+	}
+	upper = lower * defaultDebounceMaxFactor
+	if config.DebounceMax != "" {
+		if upper, err = time.ParseDuration(config.DebounceMax); err != nil {
+			return 0, 0, fmt.Errorf("invalid debounce_max: %v", err)
+		}
+	}
+	if upper < lower {
+		return 0, 0, fmt.Errorf("debounce_max %s is shorter than debounce_min %s", upper, lower)
+	}
+	return lower, upper, nil
+}
+
+// disabled reports whether changes are handed to the rules without
+// waiting for them to settle.
+func (d *debouncer) disabled() bool {
+	return d.max == 0
+}
+
+// next records a change seen at t and returns how long to wait for the
+// changes to settle.
+func (d *debouncer) next(t time.Time) time.Duration {
+	if d.adaptive && !d.last.IsZero() {
+		previous := d.window
+		if gap := t.Sub(d.last); gap < d.window {
+			d.window = min(d.window*2, d.max)
+		} else {
+			for gap >= d.window && d.window > d.min {
+				gap -= d.window
+				d.window = max(d.window/2, d.min)
+			}
+		}
+		if d.window != previous {
+			debugf("Debounce window is now %s", d.window)
+		}
+	}
+	d.last = t
+	return d.window
+}
+
+var (
+	// jitterRand picks the debounce_jitter delays; tests seed it to get
+	// known delays. Guarded by jitterMu.
+	jitterRand = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	jitterMu   sync.Mutex
+)
+
+// jitterDelay returns a random delay between 0 and bound, inclusive.
+func jitterDelay(bound time.Duration) time.Duration {
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return time.Duration(jitterRand.Int64N(int64(bound) + 1))
+}
+
+// jitterSchedule returns when each of n rules of a cycle started at start
+// may run: a random delay of up to debounce_jitter after start. The delays
+// are picked up front from the start of the cycle, so rules running one
+// after another do not add their delays up. The times are zero without
+// jitter.
+func jitterSchedule(start time.Time, n int, config Config) []time.Time {
+	schedule := make([]time.Time, n)
+	bound, _ := time.ParseDuration(config.DebounceJitter)
+	if bound <= 0 {
+		return schedule
+	}
+	for i := range schedule {
+		schedule[i] = start.Add(jitterDelay(bound))
+	}
+	return schedule
+}
+
+// waitJitter waits until at, the time jitterSchedule picked for a rule. It
+// reports false if ctx was cancelled first.
+func waitJitter(ctx context.Context, at time.Time) bool {
+	delay := time.Until(at)
+	if delay <= 0 {
+		return true
+	}
+	debugf("Delaying rule by %s of jitter", delay)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the adaptive debounce lengthens during bursts and shrinks back
+// when quiet, within its bounds
+func TestAdaptiveDebounce(t *testing.T) {
+	config := Config{DebounceTime: "100ms", DebounceMode: "adaptive", DebounceMax: "1s"}
+	assert.NoError(t, config.Validate())
+	d := newDebouncer(config, 100*time.Millisecond)
+
+	start := time.Now()
+	at := start
+	assert.Equal(t, 100*time.Millisecond, d.next(at))
+
+	// A dense burst doubles the window up to debounce_max
+	var windows []time.Duration
+	for range 6 {
+		at = at.Add(10 * time.Millisecond)
+		windows = append(windows, d.next(at))
+	}
+	assert.Equal(t, []time.Duration{
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+		time.Second,
+	}, windows)
+
+	// One quiet window halves it, a long quiet period returns to debounce_min
+	at = at.Add(time.Second)
+	assert.Equal(t, 500*time.Millisecond, d.next(at))
+	at = at.Add(time.Hour)
+	assert.Equal(t, 100*time.Millisecond, d.next(at))
+
+	// A fixed debounce never changes
+	fixed := newDebouncer(Config{}, 100*time.Millisecond)
+	assert.Equal(t, 100*time.Millisecond, fixed.next(start))
+	assert.Equal(t, 100*time.Millisecond, fixed.next(start.Add(time.Millisecond)))
+
+	for _, invalid := range []Config{
+		{DebounceMode: "sometimes"},
+		{DebounceTime: "0", DebounceMode: "adaptive"},
+		{DebounceMode: "adaptive", DebounceMin: "1s", DebounceMax: "100ms"},
+		{DebounceMode: "adaptive", DebounceMin: "soon"},
+	} {
+		assert.Error(t, invalid.Validate(), "%+v", invalid)
+	}
+}
+
+// Test that debounce_jitter staggers the rules of a batch by seeded delays
+// from the start of the cycle, so the whole batch stays within its bound
+func TestDebounceJitter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "main.go")
+	assert.NoError(t, os.WriteFile(file, nil, 0644))
+	bound := 100 * time.Millisecond
+	config := Config{DebounceJitter: bound.String()}
+	for _, name := range []string{"build", "lint", "test"} {
+		config.Rules = append(config.Rules, Rule{Name: name, Patterns: []string{file}, Commands: []Command{{Cmd: "true"}}})
+	}
+	assert.NoError(t, config.Validate())
+	assert.Error(t, Config{DebounceJitter: "-1s"}.Validate())
+
+	original := jitterRand
+	jitterRand = rand.New(rand.NewPCG(1, 2))
+	defer func() { jitterRand = original }()
+	seeded := rand.New(rand.NewPCG(1, 2))
+	var expected []time.Duration
+	for range config.Rules {
+		delay := time.Duration(seeded.Int64N(int64(bound) + 1))
+		assert.LessOrEqual(t, delay, bound)
+		expected = append(expected, delay)
+	}
+	assert.NotEqual(t, expected[0], expected[1])
+
+	var mu sync.Mutex
+	var started, finished []time.Time
+	defer AddObserver(ObserverFunc(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch e.Kind {
+		case RuleStarted:
+			started = append(started, e.Time)
+		case RuleFinished:
+			finished = append(finished, e.Time)
+		}
+	}))()
+
+	begin := time.Now()
+	_, err := executeBatch(context.Background(), ruleBatch{files: []string{file}}, config)
+	assert.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.Len(t, started, 3) && assert.Len(t, finished, 3) {
+		for i, start := range started {
+			assert.GreaterOrEqual(t, start.Sub(begin), expected[i], "rule %d started before its jitter passed", i)
+		}
+		// The delays add up to more than the bound; run one after another
+		// they would push the last rule well past it.
+		margin := 100 * time.Millisecond
+		assert.Greater(t, expected[0]+expected[1]+expected[2], bound+margin)
+		assert.Less(t, finished[2].Sub(begin), bound+margin, "jitter delays added up")
+	}
+}
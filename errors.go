@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+var (
+	// ErrInvalidConfig is returned when the configuration cannot be loaded
+	// or contains invalid values.
+	ErrInvalidConfig = errors.New("invalid configuration")
+
+	// ErrWatcherInit is returned when the file system watcher cannot be
+	// created.
+	ErrWatcherInit = errors.New("failed to initialize file watcher")
+
+	// ErrCommandFailed is matched by every CommandError.
+	ErrCommandFailed = errors.New("command failed")
+)
+
+// Exit codes used by main for the error kinds above.
+const (
+	exitCodeError         = 1
+	exitCodeInvalidConfig = 2
+	exitCodeWatcherInit   = 3
+)
+
+// CommandError describes a command that did not complete successfully.
+// ExitCode is -1 when the command could not be started or was killed.
+type CommandError struct {
+	Cmd      string
+	ExitCode int
+	Err      error
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("command failed: %s (exit code %d): %v", e.Cmd, e.ExitCode, e.Err)
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is(err, ErrCommandFailed) true for any CommandError.
+func (e *CommandError) Is(target error) bool {
+	return target == ErrCommandFailed
+}
+
+func newCommandError(cmd string, err error) *CommandError {
+	exitCode := -1
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	}
+	return &CommandError{Cmd: cmd, ExitCode: exitCode, Err: err}
+}
+
+// exitCode maps an error returned by run to the process exit code.
+func exitCode(err error) int {
+	var cmdErr *CommandError
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, ErrInvalidConfig):
+		return exitCodeInvalidConfig
+	case errors.Is(err, ErrWatcherInit):
+		return exitCodeWatcherInit
+	case errors.As(err, &cmdErr) && cmdErr.ExitCode > 0:
+		return cmdErr.ExitCode
+	default:
+		return exitCodeError
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test matching wrapped errors against the exported types
+func TestErrorTypes(t *testing.T) {
+	err := executeCommand(context.Background(), Command{Cmd: "exit 3"}, "")
+	assert.True(t, errors.Is(err, ErrCommandFailed))
+
+	var cmdErr *CommandError
+	assert.True(t, errors.As(err, &cmdErr))
+	assert.Equal(t, "exit 3", cmdErr.Cmd)
+	assert.Equal(t, 3, cmdErr.ExitCode)
+	assert.Equal(t, 3, exitCode(fmt.Errorf("rule failed: %w", err)))
+
+	configErr := fmt.Errorf("%w: bad yaml", ErrInvalidConfig)
+	assert.True(t, errors.Is(configErr, ErrInvalidConfig))
+	assert.False(t, errors.Is(configErr, ErrCommandFailed))
+	assert.Equal(t, exitCodeInvalidConfig, exitCode(configErr))
+
+	watcherErr := fmt.Errorf("%w: too many open files", ErrWatcherInit)
+	assert.True(t, errors.Is(watcherErr, ErrWatcherInit))
+	assert.Equal(t, exitCodeWatcherInit, exitCode(watcherErr))
+
+	assert.NoError(t, executeCommand(context.Background(), Command{Cmd: "true"}, ""))
+	assert.Equal(t, 0, exitCode(nil))
+}
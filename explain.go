@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Explanation tells how go-watch treats a path: whether changes to it are
+// dropped and which rules they run.
+type Explanation struct {
+	Path string `json:"path"`
+	// MatchedRules are the active rules a change to the path runs.
+	MatchedRules []ExplainedRule `json:"matched_rules"`
+	// Ignored is set when changes to the path are dropped by an ignore
+	// pattern or because the path is hidden.
+	Ignored bool `json:"ignored"`
+	// Excluded is set when the path lies under a directory every rule
+	// ignores, so it is never watched.
+	Excluded bool `json:"excluded"`
+}
+
+// ExplainedRule is a rule matching an explained path.
+type ExplainedRule struct {
+	Name     string   `json:"name"`
+	Patterns []string `json:"patterns"`
+	Commands []string `json:"commands"`
+}
+
+// explainPath reports how go-watch treats a change to path under config,
+// as JSON with --log-format=json and as text otherwise.
+func explainPath(w io.Writer, path string, config Config) error {
+	e := explain(filepath.Clean(path), config)
+	if *logFormat == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(e)
+	}
+
+	yesNo := map[bool]string{true: "yes", false: "no"}
+	fmt.Fprintf(w, "Path: %s\n", e.Path)
+	fmt.Fprintf(w, "Ignored: %s\n", yesNo[e.Ignored])
+	fmt.Fprintf(w, "Excluded: %s\n", yesNo[e.Excluded])
+	if len(e.MatchedRules) == 0 {
+		fmt.Fprintln(w, "Matched rules: none")
+		return nil
+	}
+	fmt.Fprintln(w, "Matched rules:")
+	for _, rule := range e.MatchedRules {
+		fmt.Fprintf(w, "  %s (%s)\n", rule.Name, strings.Join(rule.Patterns, ", "))
+		for _, cmd := range rule.Commands {
+			fmt.Fprintf(w, "    %s\n", cmd)
+		}
+	}
+	return nil
+}
+
+// explain builds the Explanation of path for the rules of config.
+func explain(path string, config Config) Explanation {
+	e := Explanation{
+		Path:         path,
+		MatchedRules: []ExplainedRule{},
+		Ignored:      isIgnoredFile(path, config),
+		Excluded:     inIgnoredDir(path, config),
+	}
+	for i, rule := range config.Rules {
+		if matched, _ := matchFiles(rule, withoutIgnoredDirs(rule, []string{path}, config)); len(matched) == 0 {
+			continue
+		}
+		// Unnamed rules are numbered as by --config-check
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		commands := make([]string, len(rule.Commands))
+		for j, cmd := range rule.Commands {
+			commands[j] = cmd.String()
+		}
+		e.MatchedRules = append(e.MatchedRules, ExplainedRule{Name: name, Patterns: rule.Patterns, Commands: commands})
+	}
+	return e
+}
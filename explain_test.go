@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test explaining a path matched by two rules
+func TestExplainPath(t *testing.T) {
+	config := Config{
+		IgnoreDirs: []string{"vendor"},
+		Rules: []Rule{
+			{Name: "build", Patterns: []string{"**/*.go"}, Commands: []Command{{Cmd: "go build ./..."}}},
+			{Name: "docs", Patterns: []string{"*.md"}, Commands: []Command{{Cmd: "make docs"}}},
+			{Patterns: []string{"cmd/**"}, Commands: []Command{{Args: []string{"go", "vet", "{{.Dir}}"}}}},
+		},
+	}
+
+	*logFormat = "json"
+	defer func() { *logFormat = "text" }()
+	var out bytes.Buffer
+	assert.NoError(t, explainPath(&out, "./cmd/server/main.go", config))
+
+	var got map[string]any
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	assert.Equal(t, map[string]any{
+		"path": "cmd/server/main.go",
+		"matched_rules": []any{
+			map[string]any{"name": "build", "patterns": []any{"**/*.go"}, "commands": []any{"go build ./..."}},
+			map[string]any{"name": "#3", "patterns": []any{"cmd/**"}, "commands": []any{"go vet {{.Dir}}"}},
+		},
+		"ignored":  false,
+		"excluded": false,
+	}, got)
+
+	out.Reset()
+	assert.NoError(t, explainPath(&out, "vendor/lib/x.go", config))
+	var vendored Explanation
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &vendored))
+	assert.True(t, vendored.Excluded)
+
+	*logFormat = "text"
+	out.Reset()
+	assert.NoError(t, explainPath(&out, "README.md", config))
+	assert.Equal(t, "Path: README.md\nIgnored: no\nExcluded: no\nMatched rules:\n  docs (*.md)\n    make docs\n", out.String())
+}
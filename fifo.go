@@ -0,0 +1,99 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// startTriggerFIFO creates a named pipe at path, unless one exists, and
+// returns the lines written to it. Each line is a path to treat as changed,
+// or "*" for every file the rules match. The pipe is reopened whenever a
+// writer closes it, until the returned function is called, which stops the
+// reader and removes the pipe if it was created here.
+func startTriggerFIFO(path string) (<-chan string, func(), error) {
+	created := false
+	info, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+		if err := syscall.Mkfifo(path, 0600); err != nil {
+			return nil, nil, fmt.Errorf("failed to create trigger FIFO %s: %w", path, err)
+		}
+		created = true
+	case err != nil:
+		return nil, nil, fmt.Errorf("failed to stat trigger FIFO %s: %w", path, err)
+	case info.Mode()&os.ModeNamedPipe == 0:
+		return nil, nil, fmt.Errorf("trigger FIFO %s exists and is not a named pipe", path)
+	}
+
+	lines := make(chan string)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	var mu sync.Mutex
+	var current *os.File
+
+	go func() {
+		defer close(done)
+		for {
+			// Opening blocks until a writer opens the pipe as well
+			f, err := os.Open(path)
+			if err != nil {
+				logger.Printf("Failed to open trigger FIFO %s: %v", path, err)
+				return
+			}
+			mu.Lock()
+			current = f
+			mu.Unlock()
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if line == "" {
+					continue
+				}
+				select {
+				case lines <- line:
+				case <-stop:
+				}
+			}
+			mu.Lock()
+			current = nil
+			mu.Unlock()
+			f.Close()
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+	}()
+
+	return lines, func() {
+		close(stop)
+		for {
+			mu.Lock()
+			if current != nil {
+				current.Close()
+			}
+			mu.Unlock()
+			// Wake up a reader blocked opening the pipe. This fails while
+			// no reader is waiting, so keep trying until it has stopped.
+			if w, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+				w.Close()
+			}
+			select {
+			case <-done:
+				if created {
+					os.Remove(path)
+				}
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}, nil
+}
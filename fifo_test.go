@@ -0,0 +1,72 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that writing to the trigger FIFO runs the rules, also after the
+// previous writer closed it
+func TestTriggerFIFO(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.go")
+	assert.NoError(t, os.WriteFile(file, nil, 0644))
+	out := filepath.Join(t.TempDir(), "runs.txt")
+	fifo := filepath.Join(t.TempDir(), "trigger.fifo")
+	*triggerFIFO = fifo
+	defer func() { *triggerFIFO = "" }()
+
+	config := Config{
+		Rules: []Rule{{
+			Patterns: []string{filepath.Join(dir, "*.go")},
+			Commands: []Command{{Cmd: "echo {{.Base}} >> " + out}},
+		}},
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- watchLoop(context.Background(), config, 50*time.Millisecond, 2)
+	}()
+
+	trigger := func(line string) {
+		assert.Eventually(t, func() bool {
+			_, err := os.Stat(fifo)
+			return err == nil
+		}, time.Second, 10*time.Millisecond, "FIFO not created")
+		f, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+		if assert.NoError(t, err) {
+			_, err = f.WriteString(line + "\n")
+			assert.NoError(t, err)
+			assert.NoError(t, f.Close())
+		}
+	}
+	trigger(file)
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(out)
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond, "path written to the FIFO did not run the rule")
+	trigger("*")
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("second trigger did not run the rule")
+	}
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "main.go\nmain.go\n", string(data))
+	assert.NoFileExists(t, fifo, "FIFO not removed on shutdown")
+}
@@ -0,0 +1,9 @@
+package main
+
+import "errors"
+
+// startTriggerFIFO is not supported on Windows, which has no named pipes in
+// the file system.
+func startTriggerFIFO(path string) (<-chan string, func(), error) {
+	return nil, nil, errors.New("--trigger-fifo is not supported on Windows")
+}
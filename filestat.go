@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// deferBatch queues a batch again once wait has passed. watchLoop sets it
+// while running; without it, files held back by min_age are dropped.
+var deferBatch func(batch ruleBatch, wait time.Duration)
+
+// sizeUnits are the suffixes accepted by parseSize, longest first.
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// parseSize parses a size such as "512", "10KB" or "1.5MB". Units are
+// powers of 1024. An empty string is a size of zero.
+func parseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	number, multiplier := strings.ToUpper(strings.TrimSpace(s)), int64(1)
+	for _, unit := range sizeUnits {
+		if trimmed, ok := strings.CutSuffix(number, unit.suffix); ok {
+			number, multiplier = strings.TrimSpace(trimmed), unit.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// tooLargeToWatch reports whether path is a file larger than the
+// max_watch_file_size of a valid configuration.
+func tooLargeToWatch(path string, config Config) bool {
+	limit, _ := parseSize(config.MaxWatchFileSize)
+	if limit == 0 {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Size() > limit
+}
+
+// statFilter applies the min_age, min_size and max_size filters of a rule.
+// Files outside the size range or gone are dropped. Files modified less
+// than min_age ago are returned as young, along with how long to wait
+// until the youngest of them is old enough.
+func statFilter(rule Rule, files []string) (ready, young []string, wait time.Duration) {
+	if rule.MinAge == "" && rule.MinSize == "" && rule.MaxSize == "" {
+		return files, nil, 0
+	}
+	minAge, _ := time.ParseDuration(rule.MinAge)
+	minSize, _ := parseSize(rule.MinSize)
+	maxSize, _ := parseSize(rule.MaxSize)
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			debugf("Skipping %s for rule %s: %v", file, rule.Name, err)
+			continue
+		}
+		if info.Size() < minSize || (maxSize > 0 && info.Size() > maxSize) {
+			debugf("Skipping %s for rule %s: size %d is out of range", file, rule.Name, info.Size())
+			continue
+		}
+		if age := time.Since(info.ModTime()); age < minAge {
+			young = append(young, file)
+			wait = max(wait, minAge-age)
+			continue
+		}
+		ready = append(ready, file)
+	}
+	return ready, young, wait
+}
+
+// holdBack defers the files of batch for the rule alone until they are
+// old enough, when they are checked again.
+func holdBack(rule Rule, batch ruleBatch, wait time.Duration) {
+	if deferBatch == nil {
+		debugf("Skipping %d files younger than min_age for rule %s", len(batch.files), rule.Name)
+		return
+	}
+	debugf("Holding back %d files for rule %s for %s", len(batch.files), rule.Name, wait)
+	batch.filter = func(r Rule) bool {
+		return r.Name == rule.Name && slices.Equal(r.Patterns, rule.Patterns)
+	}
+	deferBatch(batch, wait)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that files younger than min_age are held back until they settle
+func TestMinAge(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	dir := t.TempDir()
+	out := filepath.Join(t.TempDir(), "runs.txt")
+	config := Config{
+		Rules: []Rule{{
+			Patterns: []string{filepath.Join(dir, "*.log")},
+			MinAge:   "600ms",
+			MinSize:  "1B",
+			Commands: []Command{{Cmd: "echo {{.Base}} >> " + out}},
+		}},
+	}
+	assert.NoError(t, config.Validate())
+	for _, name := range []string{"empty.log", "big.log"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- watchLoop(context.Background(), config, 50*time.Millisecond, 1)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	written := time.Now()
+	assert.NoError(t, os.Chmod(filepath.Join(dir, "empty.log"), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "big.log"), []byte("data"), 0644))
+
+	time.Sleep(300 * time.Millisecond)
+	assert.NoFileExists(t, out, "young file processed before min_age")
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("held back file was not processed")
+	}
+	// Modification times are coarser than the clock
+	assert.GreaterOrEqual(t, time.Since(written), 550*time.Millisecond)
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "big.log\n", string(data))
+}
+
+// Test parsing sizes for min_size and max_size
+func TestParseSize(t *testing.T) {
+	for input, want := range map[string]int64{"": 0, "512": 512, "10KB": 10 << 10, "1.5mb": 3 << 19, "2 GB": 2 << 30} {
+		got, err := parseSize(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+	for _, input := range []string{"big", "-1KB", "KB"} {
+		_, err := parseSize(input)
+		assert.Error(t, err, input)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	// trackedFiles holds the absolute paths of the files git tracks in the
+	// working directory when git_tracked_only is set, or nil when they are
+	// unknown. Guarded by trackedFilesMu.
+	trackedFiles   map[string]bool
+	trackedFilesMu sync.Mutex
+)
+
+// gitTrackedFiles lists the files git tracks under the working directory,
+// and returns them with the git index, as absolute paths.
+func gitTrackedFiles() (map[string]bool, string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, "", err
+	}
+	index, err := exec.Command("git", "rev-parse", "--git-path", "index").Output()
+	if err != nil {
+		return nil, "", fmt.Errorf("not a git repository: %w", err)
+	}
+	out, err := exec.Command("git", "ls-files", "-z").Output()
+	if err != nil {
+		return nil, "", fmt.Errorf("git ls-files: %w", err)
+	}
+	files := make(map[string]bool)
+	for _, name := range bytes.Split(out, []byte{0}) {
+		if len(name) > 0 {
+			files[filepath.Join(wd, filepath.FromSlash(string(name)))] = true
+		}
+	}
+	indexPath, err := filepath.Abs(strings.TrimSpace(string(index)))
+	if err != nil {
+		return nil, "", err
+	}
+	return files, indexPath, nil
+}
+
+// loadTrackedFiles reads the tracked files again and returns the absolute
+// path of the git index, or "" outside a git repository, where every file
+// is watched.
+func loadTrackedFiles() string {
+	files, index, err := gitTrackedFiles()
+	if err != nil {
+		logger.Printf("git_tracked_only: %v, watching untracked files too", err)
+	} else {
+		debugf("git tracks %d files", len(files))
+	}
+	trackedFilesMu.Lock()
+	trackedFiles = files
+	trackedFilesMu.Unlock()
+	return index
+}
+
+// isUntracked reports whether git_tracked_only excludes path: it is not a
+// directory, and git does not track it.
+func isUntracked(path string, config Config) bool {
+	if !isTrue(config.GitTrackedOnly) {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	trackedFilesMu.Lock()
+	files := trackedFiles
+	tracked := files[abs]
+	trackedFilesMu.Unlock()
+	if files == nil || tracked {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err != nil || !info.IsDir()
+}
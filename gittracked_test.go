@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that git_tracked_only watches the files git tracks, and picks up
+// files added to the index later
+func TestGitTrackedOnly(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+	watchedPaths.Clear()
+
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	assert.NoError(t, err)
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+	git := func(args ...string) {
+		out, err := exec.Command("git", args...).CombinedOutput()
+		assert.NoError(t, err, string(out))
+	}
+	git("init", "-q")
+	assert.NoError(t, os.Mkdir("build", 0755))
+	for _, name := range []string{"main.go", "generated.go", filepath.Join("build", "out.go")} {
+		assert.NoError(t, os.WriteFile(name, nil, 0644))
+	}
+	git("add", "main.go")
+
+	config := Config{
+		GitTrackedOnly: boolPtr(true),
+		Rules:          []Rule{{Patterns: []string{"**/*.go", "*.go"}, Commands: []Command{{Cmd: "true"}}}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- watchLoop(ctx, config, 20*time.Millisecond, 0)
+	}()
+	defer func() {
+		cancel()
+		<-done
+		trackedFiles = nil
+	}()
+
+	assert.Eventually(t, func() bool { return isWatched("main.go") }, time.Second, 10*time.Millisecond)
+	assert.False(t, isWatched("generated.go"))
+	assert.False(t, isWatched(filepath.Join("build", "out.go")))
+	assert.True(t, isIgnoredFile("generated.go", config))
+	assert.False(t, isIgnoredFile("main.go", config))
+
+	// Adding a file to the index starts watching it
+	git("add", "generated.go")
+	assert.Eventually(t, func() bool { return isWatched("generated.go") }, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, isWatched(filepath.Join("build", "out.go")))
+}
+
+// Test that git_tracked_only watches every file outside a git repository
+func TestGitTrackedOnlyOutsideRepository(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(dir))
+	assert.NoError(t, os.WriteFile("main.go", nil, 0644))
+
+	assert.Equal(t, "", loadTrackedFiles())
+	defer func() { trackedFiles = nil }()
+	assert.False(t, isUntracked("main.go", Config{GitTrackedOnly: boolPtr(true)}))
+}
@@ -3,6 +3,7 @@ module github.com/niradler/go-watch
 go 1.23.4
 
 require (
+	github.com/creack/pty v1.1.24
 	github.com/fsnotify/fsnotify v1.8.0
 	github.com/gobwas/glob v0.2.3
 	github.com/joho/godotenv v1.5.1
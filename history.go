@@ -0,0 +1,63 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// historySize is how many run cycles are kept for replaying.
+const historySize = 10
+
+// cycle is a run cycle kept in the history: the files each rule ran for
+// and the reports of the rules.
+type cycle struct {
+	Time    time.Time
+	Batch   ruleBatch
+	Reports []RunReport
+}
+
+var (
+	historyMu sync.Mutex
+	// history holds the most recent cycles, oldest first.
+	history []cycle
+)
+
+// recordCycle adds a cycle to the history. The batch is narrowed to the
+// files the rules ran for, so replaying it runs the same rules again.
+func recordCycle(batch ruleBatch, reports []RunReport) {
+	batch.files = reportedFiles(reports)
+	batch.ops = maps.Clone(batch.ops)
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	history = append(history, cycle{Time: time.Now(), Batch: batch, Reports: reports})
+	if len(history) > historySize {
+		history = slices.Delete(history, 0, len(history)-historySize)
+	}
+}
+
+// reportedFiles returns the files the reported rules ran for, without
+// duplicates.
+func reportedFiles(reports []RunReport) []string {
+	var files []string
+	for _, report := range reports {
+		for _, file := range report.Files {
+			if !slices.Contains(files, file) {
+				files = append(files, file)
+			}
+		}
+	}
+	return files
+}
+
+// lastCycle returns the most recent cycle in the history.
+func lastCycle() (cycle, bool) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	if len(history) == 0 {
+		return cycle{}, false
+	}
+	return history[len(history)-1], true
+}
@@ -0,0 +1,66 @@
+package main
+
+// ruleIgnoreDirs returns the directories ignored for rule: its own
+// ignore_dirs, and the global ones unless the rule sets watch_ignored.
+func ruleIgnoreDirs(rule Rule, config Config) []string {
+	if rule.WatchIgnored {
+		return rule.IgnoreDirs
+	}
+	if len(rule.IgnoreDirs) == 0 {
+		return config.IgnoreDirs
+	}
+	return append(append([]string{}, config.IgnoreDirs...), rule.IgnoreDirs...)
+}
+
+// ruleWatchConfig returns config with the ignore dirs of rule, to resolve
+// and watch the rule's patterns.
+func ruleWatchConfig(rule Rule, config Config) Config {
+	config.IgnoreDirs = ruleIgnoreDirs(rule, config)
+	return config
+}
+
+// inIgnoredDir reports whether path lies under a directory every rule
+// ignores, or under a global ignore dir when there are no rules.
+func inIgnoredDir(path string, config Config) bool {
+	if len(config.Rules) == 0 {
+		return isIgnoredDir(path, config.IgnoreDirs)
+	}
+	for _, rule := range config.Rules {
+		if !isIgnoredDir(path, ruleIgnoreDirs(rule, config)) {
+			return false
+		}
+	}
+	return true
+}
+
+// withoutIgnoredDirs returns the files that do not lie under a directory
+// ignored for rule.
+func withoutIgnoredDirs(rule Rule, files []string, config Config) []string {
+	dirs := ruleIgnoreDirs(rule, config)
+	var kept []string
+	for _, file := range files {
+		if !isIgnoredDir(file, dirs) {
+			kept = append(kept, file)
+		}
+	}
+	return kept
+}
+
+// watchOwnedPattern watches a pattern retried after matching nothing, with
+// the ignore dirs of each rule it comes from.
+func watchOwnedPattern(pattern string, config Config) int {
+	found, owned := 0, false
+	for _, rule := range config.Rules {
+		for _, p := range append(append([]string{}, rule.Patterns...), rule.WatchDirs...) {
+			if rulePattern(rule, p) == pattern {
+				owned = true
+				found += watchPattern(pattern, ruleWatchConfig(rule, config))
+				break
+			}
+		}
+	}
+	if !owned {
+		return watchPattern(pattern, config)
+	}
+	return found
+}
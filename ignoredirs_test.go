@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that a rule with watch_ignored watches a globally ignored directory,
+// and that changes there run only that rule
+func TestRuleIgnoreDirs(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+	watchedPaths.Clear()
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+	vendored := filepath.Join("vendor", "lib", "lib.go")
+	fixture := filepath.Join("testdata", "fixture.go")
+	modules := filepath.Join("node_modules", "pkg", "index.go")
+	for _, name := range []string{"main.go", vendored, fixture, modules} {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(name), 0755))
+		assert.NoError(t, os.WriteFile(name, nil, 0644))
+	}
+
+	config := Config{
+		IgnoreDirs: []string{"vendor", "node_modules"},
+		Rules: []Rule{
+			{Name: "build", IgnoreDirs: []string{"testdata"}, Patterns: []string{"**/*.go", "*.go"}, Commands: []Command{{Cmd: "true"}}},
+			{Name: "vendor", WatchIgnored: true, Patterns: []string{"vendor/**/*.go"}, Commands: []Command{{Cmd: "true"}}},
+		},
+	}
+	assert.NoError(t, config.Validate())
+	addPatternsToWatcher(config)
+	assert.True(t, isWatched("main.go"))
+	assert.True(t, isWatched(vendored))
+	assert.False(t, isWatched(fixture))
+	assert.False(t, isWatched(modules))
+
+	assert.Empty(t, dropReason(fsnotify.Event{Name: vendored, Op: fsnotify.Write}, config))
+	assert.NotEmpty(t, dropReason(fsnotify.Event{Name: vendored, Op: fsnotify.Write}, Config{IgnoreDirs: config.IgnoreDirs, Rules: config.Rules[:1]}))
+
+	// ran returns the rules a change to file runs
+	ran := func(file string) []string {
+		reports, err := executeBatch(context.Background(), ruleBatch{files: []string{file}}, config)
+		assert.NoError(t, err)
+		var names []string
+		for _, report := range reports {
+			names = append(names, report.Rule)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"vendor"}, ran(vendored))
+	assert.Equal(t, []string{"build"}, ran("main.go"))
+	assert.Empty(t, ran(fixture))
+	assert.Empty(t, ran(modules))
+
+	assert.Error(t, Config{Rules: []Rule{{IgnoreDirs: []string{" "}}}}.Validate())
+}
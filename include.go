@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// resolveIncludes merges the files listed in config.Include, which was read
+// from path, into config. Includes are resolved relative to path and may
+// be globs; a glob matching nothing is fine, a missing file is an error.
+func resolveIncludes(path string, config Config, stack []string) (Config, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return config, err
+	}
+	if slices.Contains(stack, abs) {
+		return config, fmt.Errorf("include cycle: %s -> %s", strings.Join(stack, " -> "), abs)
+	}
+	stack = append(stack, abs)
+
+	includes := config.Include
+	config.Include = nil
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		files := []string{include}
+		if strings.ContainsAny(include, "*?[") {
+			if files, err = filepath.Glob(include); err != nil {
+				return config, fmt.Errorf("%s: invalid include %q: %v", path, include, err)
+			}
+			slices.Sort(files)
+		}
+		for _, file := range files {
+			fragment, err := readConfigIncludes(file, stack)
+			if err != nil {
+				return config, fmt.Errorf("%s: include %s: %w", path, file, err)
+			}
+			config = includeConfig(config, fragment)
+		}
+	}
+	return config, nil
+}
+
+// includeConfig merges an included fragment into config. Rules and startup
+// commands are appended after those of config. Other settings of config
+// take precedence over the fragment's, and ignore lists are combined.
+func includeConfig(config, fragment Config) Config {
+	merged := mergeConfig(fragment, config)
+	merged.StartupCommands = append(slices.Clone(config.StartupCommands), fragment.StartupCommands...)
+	merged.Rules = append(slices.Clone(config.Rules), fragment.Rules...)
+	return merged
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test composing a configuration from included fragments
+func TestConfigInclude(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+	write("common.yaml", `
+debounce_time: 1s
+ignore_dirs: [tmp]
+rules:
+  - name: lint
+    patterns: ["*.go"]
+    commands: [{cmd: "go vet ./..."}]
+`)
+	write("rules/test.yaml", `
+rules:
+  - name: test
+    patterns: ["*_test.go"]
+    commands: [{cmd: "go test ./..."}]
+`)
+	root := write("go-watch.yaml", `
+include: [common.yaml, "rules/*.yaml"]
+debounce_time: 200ms
+rules:
+  - name: build
+    patterns: ["*.go"]
+    commands: [{cmd: "go build ./..."}]
+`)
+
+	config, err := readConfigFile(root)
+	assert.NoError(t, err)
+	var names []string
+	for _, rule := range config.Rules {
+		names = append(names, rule.Name)
+	}
+	assert.Equal(t, []string{"build", "lint", "test"}, names)
+	assert.Equal(t, "200ms", config.DebounceTime)
+	assert.Equal(t, []string{"tmp"}, config.IgnoreDirs)
+	assert.Empty(t, config.Include)
+	assert.NoError(t, config.Validate())
+
+	missing := write("missing.yaml", "include: [nope.yaml]\n")
+	_, err = readConfigFile(missing)
+	assert.ErrorContains(t, err, "nope.yaml")
+
+	write("a.yaml", "include: [b.yaml]\n")
+	cycle := write("b.yaml", "include: [a.yaml]\n")
+	_, err = readConfigFile(cycle)
+	assert.ErrorContains(t, err, "include cycle")
+}
+
+// Test that rules run in declaration order, then include order
+func TestRuleOrder(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(t.TempDir(), "order.txt")
+	rule := func(name, needs string) string {
+		return "  - name: " + name + "\n    needs: [" + needs + "]\n    patterns: [\"*.go\"]\n" +
+			"    commands: [{cmd: \"echo " + name + " >> " + out + "\"}]\n"
+	}
+	// Fragments are created out of lexical order on purpose
+	for _, fragment := range []struct{ name, rules string }{
+		{"rules/c.yaml", "rules:\n" + rule("c1", "") + rule("c2", "")},
+		{"rules/a.yaml", "rules:\n" + rule("a1", "") + rule("a2", "b")},
+		{"rules/b.yaml", "rules:\n" + rule("b", "")},
+	} {
+		path := filepath.Join(dir, fragment.name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(fragment.rules), 0644))
+	}
+	root := filepath.Join(dir, "go-watch.yaml")
+	assert.NoError(t, os.WriteFile(root, []byte("include: [\"rules/*.yaml\"]\nrules:\n"+rule("main", "")), 0644))
+
+	config, err := readConfigFile(root)
+	assert.NoError(t, err)
+	assert.NoError(t, config.Validate())
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, os.RemoveAll(out))
+		_, err := executeRules(context.Background(), []string{"main.go"}, config)
+		assert.NoError(t, err)
+		data, err := os.ReadFile(out)
+		assert.NoError(t, err)
+		// a2 moves after b, the rule it needs; everything else keeps its place
+		assert.Equal(t, "main\na1\nb\na2\nc1\nc2\n", string(data))
+	}
+
+	config.Rules = append(config.Rules, Rule{Name: "b", Patterns: []string{"*.go"}})
+	assert.ErrorContains(t, config.Validate(), `duplicate rule name "b"`)
+}
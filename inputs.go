@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+)
+
+var (
+	// lastInputs holds the input hash of the last successful run of each
+	// rule with skip_unchanged, by ruleKey. Guarded by lastInputsMu.
+	lastInputs   = make(map[string]string)
+	lastInputsMu sync.Mutex
+)
+
+// inputHash hashes the paths and contents of files, independent of their
+// order. Files that can't be read are hashed as missing. Files larger than
+// max_watch_file_size are not read; their size and modification time are
+// hashed instead.
+func inputHash(files []string, config Config) string {
+	sorted := slices.Sorted(slices.Values(files))
+	sorted = slices.Compact(sorted)
+	h := sha256.New()
+	for _, file := range sorted {
+		io.WriteString(h, file+"\x00")
+		if tooLargeToWatch(file, config) {
+			if info, err := os.Stat(file); err == nil {
+				fmt.Fprintf(h, "large %d %d\x00", info.Size(), info.ModTime().UnixNano())
+				continue
+			}
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			io.WriteString(h, "missing\x00")
+			continue
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			io.WriteString(h, "unreadable\x00")
+		}
+		io.WriteString(h, "\x00")
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// unchangedInputs reports whether the rule last succeeded with the same
+// input hash.
+func unchangedInputs(rule Rule, hash string) bool {
+	lastInputsMu.Lock()
+	defer lastInputsMu.Unlock()
+	return lastInputs[ruleKey(rule)] == hash
+}
+
+// recordInputs remembers the input hash of a successful run of the rule.
+func recordInputs(rule Rule, hash string) {
+	lastInputsMu.Lock()
+	defer lastInputsMu.Unlock()
+	lastInputs[ruleKey(rule)] = hash
+}
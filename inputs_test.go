@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that skip_unchanged skips a rule whose inputs are unchanged since it
+// last succeeded
+func TestSkipUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "main.go")
+	assert.NoError(t, os.WriteFile(source, []byte("package main"), 0644))
+	out := filepath.Join(t.TempDir(), "runs.txt")
+	config := Config{
+		Rules: []Rule{{
+			Name:          "test",
+			Patterns:      []string{filepath.Join(dir, "*.go")},
+			SkipUnchanged: true,
+			Commands:      []Command{{Cmd: "echo run >> " + out + "; test ! -f " + filepath.Join(dir, "fail")}},
+		}},
+	}
+	runs := func() int {
+		t.Helper()
+		_, err := executeBatch(context.Background(), ruleBatch{files: []string{source}}, config)
+		assert.NoError(t, err)
+		data, _ := os.ReadFile(out)
+		return len(data) / len("run\n")
+	}
+
+	assert.Equal(t, 1, runs())
+	assert.Equal(t, 1, runs(), "unchanged input ran the rule again")
+
+	assert.NoError(t, os.WriteFile(source, []byte("package main\n"), 0644))
+	assert.Equal(t, 2, runs(), "changed input did not run the rule")
+
+	// Failed runs are not remembered
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "fail"), nil, 0644))
+	assert.NoError(t, os.WriteFile(source, []byte("package main\n\n"), 0644))
+	assert.Equal(t, 3, runs())
+	assert.NoError(t, os.Remove(filepath.Join(dir, "fail")))
+	assert.Equal(t, 4, runs())
+	assert.Equal(t, 4, runs())
+
+	assert.Equal(t, inputHash([]string{source, out}, Config{}), inputHash([]string{out, source}, Config{}))
+}
+
+// Test that files over max_watch_file_size are neither watched nor read
+// for the input hash, while smaller ones are
+func TestMaxWatchFileSize(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	dir := t.TempDir()
+	small := filepath.Join(dir, "small.bin")
+	large := filepath.Join(dir, "large.bin")
+	assert.NoError(t, os.WriteFile(small, []byte("small"), 0644))
+	assert.NoError(t, os.WriteFile(large, bytes.Repeat([]byte("a"), 2048), 0644))
+	config := Config{MaxWatchFileSize: "1KB"}
+	assert.NoError(t, config.Validate())
+	assert.Error(t, Config{MaxWatchFileSize: "big"}.Validate())
+
+	assert.Equal(t, 2, watchPattern(filepath.Join(dir, "*.bin"), config))
+	assert.True(t, isWatched(small))
+	assert.False(t, isWatched(large))
+
+	// rewrite changes a file's content, keeping its size and modification
+	// time
+	rewrite := func(path string, data []byte) {
+		info, err := os.Stat(path)
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(path, data, 0644))
+		assert.NoError(t, os.Chtimes(path, info.ModTime(), info.ModTime()))
+	}
+	files := []string{small, large}
+	hash := inputHash(files, config)
+	rewrite(large, bytes.Repeat([]byte("b"), 2048))
+	assert.Equal(t, hash, inputHash(files, config), "large file was read")
+	rewrite(small, []byte("SMALL"))
+	assert.NotEqual(t, hash, inputHash(files, config), "small file was not read")
+
+	// Changes to large files still match rules
+	matched, _ := matchFiles(Rule{Patterns: []string{filepath.Join(dir, "*.bin")}}, []string{large})
+	assert.Equal(t, []string{large}, matched)
+}
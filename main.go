@@ -1,15 +1,28 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"maps"
+	"net"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -20,253 +33,3423 @@ import (
 
 // Config represents the application configuration.
 type Config struct {
-	IgnoreDirs   []string `json:"ignore_dirs" yaml:"ignore_dirs"`
-	DebounceTime string   `json:"debounce_time" yaml:"debounce_time"`
-	Rules        []Rule   `json:"rules" yaml:"rules"`
+	// Include lists configuration files merged into this one, relative to
+	// it; globs are allowed. See includeConfig for how they are merged.
+	Include []string `json:"include,omitempty" yaml:"include,omitempty"`
+
+	IgnoreDirs     []string `json:"ignore_dirs" yaml:"ignore_dirs"`
+	IgnorePatterns []string `json:"ignore_patterns,omitempty" yaml:"ignore_patterns,omitempty"`
+	// NoDefaultIgnores drops defaultIgnorePatterns.
+	NoDefaultIgnores *bool `json:"no_default_ignores,omitempty" yaml:"no_default_ignores,omitempty"`
+	// UseDefaultIgnores adds defaultIgnoreDirs to IgnoreDirs unless it is
+	// set to false.
+	UseDefaultIgnores *bool `json:"use_default_ignores,omitempty" yaml:"use_default_ignores,omitempty"`
+	// IgnoreHidden skips paths with an element starting with a dot, unless
+	// it is set to false or a rule pattern names the hidden element.
+	IgnoreHidden *bool  `json:"ignore_hidden,omitempty" yaml:"ignore_hidden,omitempty"`
+	DebounceTime string `json:"debounce_time" yaml:"debounce_time"`
+	// DebounceMode is "fixed" (default) or "adaptive", which adjusts the
+	// debounce time to how often changes arrive, between DebounceMin and
+	// DebounceMax.
+	DebounceMode string `json:"debounce_mode,omitempty" yaml:"debounce_mode,omitempty"`
+	DebounceMin  string `json:"debounce_min,omitempty" yaml:"debounce_min,omitempty"`
+	DebounceMax  string `json:"debounce_max,omitempty" yaml:"debounce_max,omitempty"`
+	// ProjectSettle waits for the whole project to settle before running
+	// any rule, no_debounce rules included, and runs a command shared by
+	// several matching rules once per batch.
+	ProjectSettle *bool `json:"project_settle,omitempty" yaml:"project_settle,omitempty"`
+	// RulesParallel runs the rules matching a batch concurrently, at most
+	// MaxParallel at once (0 means no limit). A rule still waits for the
+	// rules it needs.
+	RulesParallel *bool `json:"rules_parallel,omitempty" yaml:"rules_parallel,omitempty"`
+	MaxParallel   int   `json:"max_parallel,omitempty" yaml:"max_parallel,omitempty"`
+	// MaxWatchFileSize, e.g. "50MB", leaves larger files out of the watch
+	// set and out of the content hash of skip_unchanged.
+	MaxWatchFileSize string `json:"max_watch_file_size,omitempty" yaml:"max_watch_file_size,omitempty"`
+	// GitTrackedOnly limits watching to the files git tracks, which leaves
+	// out build artifacts without listing them in ignore_dirs.
+	GitTrackedOnly *bool `json:"git_tracked_only,omitempty" yaml:"git_tracked_only,omitempty"`
+	// DebounceJitter delays each rule of a settled batch by a random
+	// duration up to this from the start of the cycle, e.g. "200ms", so
+	// rules triggered by the same changes do not all start at once.
+	DebounceJitter  string    `json:"debounce_jitter,omitempty" yaml:"debounce_jitter,omitempty"`
+	StartupCommands []Command `json:"startup_commands,omitempty" yaml:"startup_commands,omitempty"`
+
+	// OnFailure is what a failed command does: "continue" with the next
+	// command, "stop-rule" (default) or "exit" go-watch.
+	OnFailure string `json:"on_failure,omitempty" yaml:"on_failure,omitempty"`
+
+	// CommandTimeout is the timeout of commands without their own, e.g.
+	// "10m". Empty means no timeout.
+	CommandTimeout string `json:"command_timeout,omitempty" yaml:"command_timeout,omitempty"`
+
+	// LogLevel is "info" or "debug", unless --log-level is given.
+	LogLevel string `json:"log_level,omitempty" yaml:"log_level,omitempty"`
+
+	// NetworkCheckAddress is the host:port dialed to tell whether commands
+	// with requires_network can run, unless --network-check-address is given.
+	NetworkCheckAddress string `json:"network_check_address,omitempty" yaml:"network_check_address,omitempty"`
+
+	// WebhookURL receives a JSON RunReport after each rule execution.
+	WebhookURL     string            `json:"webhook_url,omitempty" yaml:"webhook_url,omitempty"`
+	WebhookHeaders map[string]string `json:"webhook_headers,omitempty" yaml:"webhook_headers,omitempty"`
+	WebhookTimeout string            `json:"webhook_timeout,omitempty" yaml:"webhook_timeout,omitempty"`
+
+	// Events is the default events of rules without their own, e.g.
+	// [write, create] to ignore chmod everywhere.
+	Events []string `json:"events,omitempty" yaml:"events,omitempty"`
+
+	// ReadyFile is written once the watcher is set up and whenever no rule
+	// is running, and removed while rules run and on shutdown.
+	ReadyFile string `json:"ready_file,omitempty" yaml:"ready_file,omitempty"`
+
+	Rules []Rule `json:"rules" yaml:"rules"`
 }
 
 // Rule represents a pattern and associated commands.
 type Rule struct {
-	Patterns []string  `json:"patterns" yaml:"patterns"`
-	Commands []Command `json:"commands" yaml:"commands"`
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Root is the directory the patterns are resolved from; defaults to the
+	// working directory.
+	Root     string `json:"root,omitempty" yaml:"root,omitempty"`
+	Disabled bool   `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	// Needs names rules that must run first when a change matches several
+	// rules. A failed rule skips the rules that need it.
+	Needs []string `json:"needs,omitempty" yaml:"needs,omitempty"`
+	// NoDebounce runs the rule for each matching change as soon as it is
+	// seen, without waiting for the changes to settle.
+	NoDebounce bool `json:"no_debounce,omitempty" yaml:"no_debounce,omitempty"`
+	// LogLevel is the level of the messages logged while running the rule,
+	// "info" or "debug"; defaults to info. Failures are always logged.
+	LogLevel string `json:"log_level,omitempty" yaml:"log_level,omitempty"`
+	// Events limits the rule to changes of these kinds: "create", "write",
+	// "remove", "rename" or "chmod". Empty means every kind.
+	Events []string `json:"events,omitempty" yaml:"events,omitempty"`
+	// MinAge holds back files modified more recently than this, e.g. "2s",
+	// until they have been left alone that long. MinSize and MaxSize skip
+	// files outside a size range, e.g. "1KB" or "50MB".
+	MinAge  string `json:"min_age,omitempty" yaml:"min_age,omitempty"`
+	MinSize string `json:"min_size,omitempty" yaml:"min_size,omitempty"`
+	MaxSize string `json:"max_size,omitempty" yaml:"max_size,omitempty"`
+	// ContentType limits the rule to files whose sniffed MIME type starts
+	// with this, e.g. "image/", whatever their extension.
+	ContentType string `json:"content_type,omitempty" yaml:"content_type,omitempty"`
+	// SkipUnchanged skips the rule when the paths and contents of its
+	// matched files are the same as in its last successful run.
+	SkipUnchanged bool `json:"skip_unchanged,omitempty" yaml:"skip_unchanged,omitempty"`
+	// ActiveHours limits the rule to a daily window in local time, e.g.
+	// "09:00-18:00"; "22:00-06:00" spans midnight. OutsideHours is what
+	// happens to changes outside of it: "ignore" (default) or "queue" them
+	// until the window opens.
+	ActiveHours  string `json:"active_hours,omitempty" yaml:"active_hours,omitempty"`
+	OutsideHours string `json:"outside_hours,omitempty" yaml:"outside_hours,omitempty"`
+	// WatchDirs matches any change under these directories, at any depth,
+	// in addition to Patterns.
+	WatchDirs []string `json:"watch_dirs,omitempty" yaml:"watch_dirs,omitempty"`
+	// Env sets environment variables of the rule's commands. Values are
+	// templates with the command placeholders, rendered for each run, e.g.
+	// SERVICE: "{{index .PathSegments 1}}".
+	Env map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	// Extensions is a shorthand for "**/*.<ext>" patterns, with or without
+	// the leading dot. Multi-part extensions such as ".d.ts" match as a
+	// whole.
+	Extensions []string `json:"extensions,omitempty" yaml:"extensions,omitempty"`
+	// IgnoreDirs are directories ignored for this rule only, in addition to
+	// the global ignore_dirs. WatchIgnored drops the global ones, including
+	// the defaults, so the rule can watch e.g. vendor/.
+	IgnoreDirs   []string `json:"ignore_dirs,omitempty" yaml:"ignore_dirs,omitempty"`
+	WatchIgnored bool     `json:"watch_ignored,omitempty" yaml:"watch_ignored,omitempty"`
+	// Container is the default container image of the rule's commands.
+	Container string `json:"container,omitempty" yaml:"container,omitempty"`
+	// PatternsFile lists more patterns, one per line, relative to the
+	// configuration file. They are appended to Patterns when the
+	// configuration is loaded.
+	PatternsFile string    `json:"patterns_file,omitempty" yaml:"patterns_file,omitempty"`
+	Patterns     []string  `json:"patterns" yaml:"patterns"`
+	Commands     []Command `json:"commands" yaml:"commands"`
 }
 
 // Command represents a single command to be executed.
 type Command struct {
-	Cmd      string `json:"cmd" yaml:"cmd"`
-	Parallel bool   `json:"parallel,omitempty" yaml:"parallel,omitempty"`
+	// Name is an optional label used in logs, reports and observer events.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	Cmd  string `json:"cmd,omitempty" yaml:"cmd,omitempty"`
+	// Args runs the command directly instead of through the shell. Only one
+	// of Cmd and Args may be set.
+	Args      []string `json:"args,omitempty" yaml:"args,omitempty"`
+	Parallel  bool     `json:"parallel,omitempty" yaml:"parallel,omitempty"`
+	FilterExt []string `json:"filter_ext,omitempty" yaml:"filter_ext,omitempty"`
+
+	// StdoutFile and StderrFile redirect the command's output to files.
+	// OutputMode is "append" (default) or "truncate".
+	StdoutFile string `json:"stdout_file,omitempty" yaml:"stdout_file,omitempty"`
+	StderrFile string `json:"stderr_file,omitempty" yaml:"stderr_file,omitempty"`
+	OutputMode string `json:"output_mode,omitempty" yaml:"output_mode,omitempty"`
+
+	// QuietPeriod ignores changes for this command for a while after each
+	// launch, e.g. files written by a server while it restarts.
+	QuietPeriod string `json:"quiet_period_after_command,omitempty" yaml:"quiet_period_after_command,omitempty"`
+
+	// OnFailure overrides the global on_failure policy for this command.
+	OnFailure string `json:"on_failure,omitempty" yaml:"on_failure,omitempty"`
+
+	// Retries runs a failed command again up to this many times, waiting
+	// RetryDelay, e.g. "1s", in between. RetryExitCodes limits retries to
+	// failures with these exit codes; empty retries any failure.
+	Retries        int    `json:"retries,omitempty" yaml:"retries,omitempty"`
+	RetryDelay     string `json:"retry_delay,omitempty" yaml:"retry_delay,omitempty"`
+	RetryExitCodes []int  `json:"retry_exit_codes,omitempty" yaml:"retry_exit_codes,omitempty"`
+
+	// WatchOutput adds the paths the command prints, one per line, to the
+	// watcher after it succeeds.
+	WatchOutput bool `json:"watch_output,omitempty" yaml:"watch_output,omitempty"`
+
+	// SuccessPattern and FailurePattern are regular expressions matched
+	// against the command's combined output. A match of FailurePattern fails
+	// the command even when it exits 0; when SuccessPattern is set, the
+	// command succeeds only if its output matches, whatever its exit code.
+	SuccessPattern string `json:"success_pattern,omitempty" yaml:"success_pattern,omitempty"`
+	FailurePattern string `json:"failure_pattern,omitempty" yaml:"failure_pattern,omitempty"`
+
+	// OutputParser reads test results from the command's output, "gotest"
+	// or "jest", and reports them in a tests_summarized event.
+	OutputParser string `json:"output_parser,omitempty" yaml:"output_parser,omitempty"`
+
+	// ConcurrencyKey serializes commands sharing the key, across rules.
+	// A parallel command waits for the key in the background.
+	ConcurrencyKey string `json:"concurrency_key,omitempty" yaml:"concurrency_key,omitempty"`
+
+	// PTY runs the command under a pseudo-terminal, so tools that only
+	// color their output on a terminal keep doing so. Stderr is merged into
+	// stdout.
+	PTY bool `json:"pty,omitempty" yaml:"pty,omitempty"`
+
+	// IdleWarning logs a warning each time the command has written no
+	// output for this long, e.g. "30s", so a quiet command is not mistaken
+	// for a hung one.
+	IdleWarning string `json:"idle_warning,omitempty" yaml:"idle_warning,omitempty"`
+
+	// Timeout stops the command with SIGTERM once it ran this long, e.g.
+	// "2m". It overrides the global command_timeout.
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+
+	// Substitution is how placeholder values are inserted into Cmd: "quote"
+	// (default) shell-quotes each value, "raw" inserts it as is. Args are
+	// never quoted, since they bypass the shell.
+	Substitution string `json:"substitution,omitempty" yaml:"substitution,omitempty"`
+
+	// RequiresNetwork skips the command with a note when the network is
+	// unreachable. Connectivity is checked at most once per run cycle.
+	RequiresNetwork bool `json:"requires_network,omitempty" yaml:"requires_network,omitempty"`
+
+	// SkipIfRunning leaves a still running instance of the command alone
+	// and skips the new run, instead of terminating the old instance.
+	SkipIfRunning bool `json:"skip_if_running,omitempty" yaml:"skip_if_running,omitempty"`
+
+	// Container runs the command inside a container of this image, e.g.
+	// "golang:1.23", with the working directory mounted at /work.
+	Container string `json:"container,omitempty" yaml:"container,omitempty"`
+
+	// StopSignal is the signal stopping the command on restart, timeout
+	// or shutdown, e.g. "SIGINT"; defaults to SIGTERM. StopTimeout is how
+	// long it may take to exit before it is killed; defaults to 5s.
+	StopSignal  string `json:"stop_signal,omitempty" yaml:"stop_signal,omitempty"`
+	StopTimeout string `json:"stop_timeout,omitempty" yaml:"stop_timeout,omitempty"`
+
+	// manifest is the {{.Manifest}} file of this run, removed once the
+	// command exits.
+	manifest string
+	// env holds the rule's rendered env, as KEY=value.
+	env []string
 }
 
 var (
-	configFile   = flag.String("config", "", "Path to the configuration file")
-	ignoreDirs   = flag.String("ignore-dirs", "", "Comma-separated list of directories to ignore")
-	debounceTime = flag.String("debounce-time", "500ms", "Debounce time for file changes")
-	rules        = flag.String("rules", "", "Comma-separated list of rules in the format pattern:command")
-	shell        = flag.String("shell", "sh -c", "Shell to run commands")
-	logger       = log.New(os.Stdout, "[go-watch] ", log.LstdFlags|log.Lshortfile)
-	watcher      *fsnotify.Watcher
-	cmdProcesses = make(map[string]*exec.Cmd)
+	configFile        = flag.String("config", "", "Path to the configuration file")
+	ignoreDirs        = flag.String("ignore-dirs", "", "Comma-separated list of directories to ignore")
+	debounceTime      = flag.String("debounce-time", "500ms", "Debounce time for file changes")
+	rules             = flag.String("rules", "", "Comma-separated list of rules in the format pattern:command")
+	shell             = flag.String("shell", "sh -c", "Shell to run commands")
+	exitOnStdin       = flag.Bool("exit-on-stdin-close", false, "Shut down when stdin is closed")
+	maxEvents         = flag.Int("max-events", 0, "Exit after this many run cycles (0 means no limit)")
+	once              = flag.Bool("once", false, "Exit after the first run cycle, same as --max-events 1")
+	onlyPatterns      = flag.String("only-patterns", "", "Comma-separated globs; keep only rules with a matching pattern")
+	exclPatterns      = flag.String("exclude-patterns", "", "Comma-separated globs; drop rules with a matching pattern")
+	logLevel          = flag.String("log-level", "info", "Log level: info or debug")
+	cwd               = flag.String("cwd", "", "Directory to run in; paths and commands are relative to it")
+	since             = flag.Duration("since", 0, "At startup, run rules for files modified within this window (e.g. 5m)")
+	configCheck       = flag.Bool("config-check", false, "Validate the configuration, print a summary and exit")
+	pollFallback      = flag.Bool("poll-fallback", false, "Poll paths the native file watcher cannot watch")
+	pollInterval      = flag.Duration("poll-interval", time.Second, "Interval between scans of polled paths")
+	tuiMode           = flag.Bool("tui", false, "Show a live status dashboard instead of plain logs")
+	fromFile          = flag.String("from-file", "", "File listing extra paths to watch, one per line")
+	failNoMatch       = flag.Bool("fail-on-no-match", false, "Exit with an error when a rule pattern matches no files at startup")
+	configErrorPolicy = flag.String("restart-on-config-error", configErrorKeep, "When a reloaded configuration is invalid: keep the previous one, or fail")
+	otelEndpoint      = flag.String("otel-endpoint", "", "OTLP/HTTP endpoint receiving a trace per run cycle, e.g. http://localhost:4318")
+	summaryFile       = flag.String("summary-file", "", "On shutdown, write the triggering files and rule results to this file as JSON")
+	triggerFIFO       = flag.String("trigger-fifo", "", "Named pipe to create; writing a path or * to it triggers a change")
+	cpuProfile        = flag.String("cpuprofile", "", "Write a CPU profile to this file")
+	memProfile        = flag.String("memprofile", "", "Write a memory profile to this file on shutdown")
+	waitTimeout       = flag.Duration("wait-timeout", time.Minute, "How long --wait-for waits for its paths")
+	noExec            = flag.Bool("no-exec", false, "Report which files match which rules instead of running commands")
+	logFormat         = flag.String("log-format", "text", "Log format: text or json")
+	explainFlag       = flag.String("explain", "", "Print which rules a change to this path runs, and exit")
+	containerRuntime  = flag.String("container-runtime", runtimeDocker, "CLI running commands with a container image: docker or podman")
+	bellOnFailure     = flag.Bool("bell-on-failure", false, "Ring the terminal bell on stderr when a command fails")
+	bellOnSuccess     = flag.Bool("bell-on-success", false, "Ring the terminal bell on stderr when a command succeeds")
+	verboseMatching   = flag.Bool("verbose-matching", false, "Log how each change is matched against the rules, or why it is dropped")
+	printConfigFlag   = flag.Bool("print-config", false, "Print the effective configuration as YAML, or JSON with --log-format json, and exit")
+	prefixTimes       = flag.Bool("prefix-timestamps", false, "Prefix each line of command output with a timestamp")
+	timeFormat        = flag.String("timestamp-format", time.RFC3339, "Go time layout of --prefix-timestamps")
+	networkCheckAddr  = flag.String("network-check-address", defaultNetworkAddress, "host:port dialed to check the network for commands with requires_network")
+	logger            = log.New(os.Stdout, "[go-watch] ", log.LstdFlags|log.Lshortfile)
+	watcher           *fsnotify.Watcher
+	// cmdProcesses holds the running process of each command string so a new
+	// run can terminate the previous one. Guarded by cmdProcessesMu.
+	cmdProcesses   = make(map[string]*runningProcess)
+	cmdProcessesMu sync.Mutex
+	// commandStdout and commandStderr receive the output of commands
+	// without output files; --tui sends it to its log pane instead. Guarded
+	// by commandOutputMu.
+	commandStdout   io.Writer = os.Stdout
+	commandStderr   io.Writer = os.Stderr
+	commandOutputMu sync.Mutex
+	// addWatch registers a path with the native watcher.
+	addWatch = func(path string) error {
+		return watcher.Add(path)
+	}
+	// watchedPaths holds each path added to the watcher and the pattern
+	// that resolved it.
+	watchedPaths = newWatchSet()
+	// fallbackPoller polls paths the native watcher rejected; nil unless
+	// --poll-fallback is set.
+	fallbackPoller *poller
+	// quietUntil holds, per command, the end of the quiet period started by
+	// its last launch. Guarded by quietUntilMu.
+	quietUntil   = make(map[string]time.Time)
+	quietUntilMu sync.Mutex
+	// activeConfig is the configuration used by the event loop and executor.
+	activeConfig atomic.Pointer[Config]
+	// configPath is the project configuration file loaded by loadConfig,
+	// relative to the working directory, which is reloaded when it changes.
+	// Empty when no file was loaded.
+	configPath string
+	// runningCommands tracks parallel commands so shutdown can wait for them.
+	runningCommands sync.WaitGroup
+	// concurrencyKeys holds a mutex per concurrency_key. Guarded by
+	// concurrencyKeysMu.
+	concurrencyKeys   = make(map[string]*sync.Mutex)
+	concurrencyKeysMu sync.Mutex
+	disableRules      stringList
+	waitFor           stringList
+
+	// maxOutputWatches bounds the paths watched through watch_output.
+	maxOutputWatches = 1000
+	// outputWatchPattern marks watchedPaths entries added from command output.
+	outputWatchPattern = "<command output>"
+
+	// commandWaitDelay is how long a stopped command may take to exit
+	// after its stop signal before it is killed, unless it sets
+	// stop_timeout.
+	commandWaitDelay = 5 * time.Second
+
+	// lazyRegisterInterval is how often patterns without matches are retried.
+	lazyRegisterInterval = 2 * time.Second
+
+	// waitForInterval is how often --wait-for checks for its paths.
+	waitForInterval = 250 * time.Millisecond
+
+	// defaultIgnorePatterns matches temporary files written by common editors.
+	defaultIgnorePatterns = []string{
+		"*.swp", "*.swx", "*.swo", // vim swap files
+		"4913",       // vim write test file
+		"*~",         // backup files
+		".#*", "#*#", // emacs lock and auto-save files
+		"*.tmp",
+	}
+
+	// defaultIgnoreDirs are dependency and build output directories that
+	// are rarely worth watching.
+	defaultIgnoreDirs = []string{".git", "node_modules", "vendor", "dist", "bin"}
 )
 
-func init() {
-	var err error
-	watcher, err = fsnotify.NewWatcher()
-	if err != nil {
-		logger.Fatalf("Failed to initialize file watcher: %v", err)
+// Policies for on_failure.
+const (
+	failureContinue = "continue"
+	failureStopRule = "stop-rule"
+	failureExit     = "exit"
+)
+
+// Policies for --restart-on-config-error.
+const (
+	configErrorKeep = "keep"
+	configErrorFail = "fail"
+)
+
+// runningProcess is a started command and a channel closed once it exited.
+type runningProcess struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+	// stopSignal and stopTimeout are how the process is stopped before
+	// a restart.
+	stopSignal  syscall.Signal
+	stopTimeout time.Duration
+}
+
+// currentConfig returns the active configuration. It is safe to call from
+// any goroutine; the returned value must not be modified.
+func currentConfig() Config {
+	if config := activeConfig.Load(); config != nil {
+		return *config
+	}
+	return Config{}
+}
+
+// setConfig replaces the active configuration.
+func setConfig(config Config) {
+	activeConfig.Store(&config)
+}
+
+// String returns the command line for logs and reports.
+func (c Command) String() string {
+	if len(c.Args) > 0 {
+		return strings.Join(c.Args, " ")
 	}
+	return c.Cmd
+}
+
+// hasPlaceholders reports whether the command uses template placeholders.
+func (c Command) hasPlaceholders() bool {
+	return strings.Contains(c.String(), "{{")
+}
+
+// stringList is a flag.Value that collects repeated flag occurrences.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func init() {
+	flag.Var(&disableRules, "disable-rule", "Name of a rule to disable (repeatable)")
+	flag.Var(&waitFor, "wait-for", "Path that must exist before starting (repeatable)")
+	flag.Usage = usage
 }
 
 func main() {
 	flag.Parse()
+	if flag.Arg(0) == "completion" {
+		os.Exit(runCompletion(os.Stdout, os.Stderr, flag.Args()[1:]))
+	}
 	_ = godotenv.Load()
 
-	config, err := loadConfig(*configFile)
-	if err != nil {
-		logger.Fatalf("Failed to load configuration: %v", err)
+	if err := run(); err != nil {
+		logger.Printf("%v", err)
+		os.Exit(exitCode(err))
 	}
+}
 
-	if *configFile == "" {
-		if *ignoreDirs != "" {
-			config.IgnoreDirs = strings.Split(*ignoreDirs, ",")
-		}
-		config.DebounceTime = *debounceTime
-		if *rules != "" {
-			config.Rules = parseRules(*rules)
+// run loads the configuration and watches until shutdown. Errors wrap
+// ErrInvalidConfig, ErrWatcherInit or a *CommandError.
+func run() error {
+	if *logLevel != "info" && *logLevel != "debug" {
+		return fmt.Errorf("%w: unsupported log level %q", ErrInvalidConfig, *logLevel)
+	}
+	logOutput := logDestination()
+	logger.SetOutput(logOutput)
+	switch *logFormat {
+	case "text":
+	case "json":
+		logger.SetFlags(0)
+		logger.SetPrefix("")
+		logger.SetOutput(jsonLogWriter{w: logOutput})
+	default:
+		return fmt.Errorf("%w: unsupported log format %q", ErrInvalidConfig, *logFormat)
+	}
+	stopProfiling, err := startProfiling(*cpuProfile, *memProfile)
+	if err != nil {
+		return err
+	}
+	defer stopProfiling()
+	if *cwd != "" {
+		if err := os.Chdir(*cwd); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
 		}
 	}
 
-	debounceDuration, err := time.ParseDuration(config.DebounceTime)
+	if *containerRuntime != runtimeDocker && *containerRuntime != runtimePodman {
+		return fmt.Errorf("%w: unsupported --container-runtime %q", ErrInvalidConfig, *containerRuntime)
+	}
+	if *configErrorPolicy != configErrorKeep && *configErrorPolicy != configErrorFail {
+		return fmt.Errorf("%w: unsupported --restart-on-config-error %q", ErrInvalidConfig, *configErrorPolicy)
+	}
+
+	config, err := loadConfig(*configFile)
 	if err != nil {
-		logger.Fatalf("Invalid debounce time: %v", err)
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
 	}
+	config = applyConfigFlags(config)
 
-	logger.Println("Executing initial commands...")
-	executeInitialCommands(config)
+	if *configCheck {
+		return checkConfig(os.Stdout, config)
+	}
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	config = applyRuleFilters(config)
+	// The configured log level applies from here on
+	setConfig(config)
 
-	logger.Println("Starting watcher...")
-	addPatternsToWatcher(config)
+	if *printConfigFlag {
+		return printConfig(os.Stdout, config, *logFormat)
+	}
+	if *explainFlag != "" {
+		return explainPath(os.Stdout, *explainFlag, config)
+	}
+
+	debounceDuration, err := time.ParseDuration(config.DebounceTime)
+	if err != nil {
+		return fmt.Errorf("%w: invalid debounce time: %v", ErrInvalidConfig, err)
+	}
 
+	watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWatcherInit, err)
+	}
 	defer watcher.Close()
 
-	var lastChange time.Time
-	eventQueue := make(chan string)
+	// Cancelling the root context stops every running command.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	var stdinClosed <-chan struct{}
+	if *exitOnStdin {
+		stdinClosed = watchStdinClose(os.Stdin)
+	}
 	go func() {
-		for path := range eventQueue {
-			executeRules(path, config)
+		select {
+		case sig := <-stop:
+			logger.Printf("Received %s, shutting down...", sig)
+		case <-stdinClosed:
+			logger.Println("Stdin closed, shutting down...")
+		case <-ctx.Done():
 		}
+		cancel()
 	}()
 
-	for {
-		select {
-		case event, ok := <-watcher.Events:
-			if !ok {
-				return
-			}
-			if time.Since(lastChange) > debounceDuration {
-				lastChange = time.Now()
-				eventQueue <- event.Name
-				logger.Printf("Change detected: %s", event.Name)
-			}
-		case err, ok := <-watcher.Errors:
-			if !ok {
-				return
-			}
-			logger.Printf("Watcher error: %v", err)
-		}
+	if *tuiMode {
+		defer startTUI(ctx)()
 	}
-}
+	if *otelEndpoint != "" {
+		defer AddObserver(newTracingObserver(newOTLPExporter(*otelEndpoint)))()
+	}
+	defer addBellObserver()()
 
-func parseRules(rules string) []Rule {
-	var parsedRules []Rule
-	rulePairs := strings.Split(rules, ",")
-	for _, pair := range rulePairs {
-		parts := strings.Split(pair, ":")
-		if len(parts) == 2 {
-			parsedRules = append(parsedRules, Rule{
-				Patterns: []string{parts[0]},
-				Commands: []Command{{Cmd: parts[1], Parallel: false}},
-			})
+	if len(waitFor) > 0 {
+		if err := waitForPaths(ctx, waitFor, *waitTimeout); err != nil {
+			return err
 		}
 	}
-	return parsedRules
-}
 
-func loadConfig(path string) (Config, error) {
-	var config Config
+	logger.Println("Executing initial commands...")
+	if err := executeInitialCommands(ctx, config); err != nil {
+		return err
+	}
 
-	if path == "" {
-		// Try default configuration files
-		defaultFiles := []string{"go-watch.config.yaml", "go-watch.config.json"}
-		for _, file := range defaultFiles {
-			if _, err := os.Stat(file); err == nil {
-				path = file
-				break
-			}
+	if *since > 0 {
+		if err := replaySince(ctx, config, *since); err != nil {
+			return err
 		}
 	}
 
-	if path == "" {
-		logger.Println("No configuration file supplied and no default configuration file found.")
-		return config, nil
+	if *pollFallback {
+		fallbackPoller = newPoller(*pollInterval)
 	}
 
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return config, err
+	limit := *maxEvents
+	if *once && limit == 0 {
+		limit = 1
 	}
+	return watchLoop(ctx, config, debounceDuration, limit)
+}
 
-	switch filepath.Ext(path) {
-	case ".yaml", ".yml":
-		if err := yaml.Unmarshal(data, &config); err != nil {
-			return config, err
+// watchLoop registers the rule patterns and runs the rules for settled
+// batches of changes until ctx is cancelled, the watcher closes, or
+// maxEvents cycles have run (0 means no limit).
+func watchLoop(ctx context.Context, config Config, debounceDuration time.Duration, maxEvents int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	setConfig(config)
+
+	var pollEvents <-chan fsnotify.Event
+	if fallbackPoller != nil {
+		pollEvents = fallbackPoller.events
+		go fallbackPoller.Run(ctx)
+	}
+
+	logger.Println("Starting watcher...")
+	var gitIndex string
+	if isTrue(config.GitTrackedOnly) {
+		gitIndex = loadTrackedFiles()
+	}
+	unresolved := addPatternsToWatcher(config)
+	if *failNoMatch && len(unresolved) > 0 {
+		return fmt.Errorf("%w: patterns match no files: %s", ErrInvalidConfig, strings.Join(unresolved, ", "))
+	}
+	for _, pattern := range unresolved {
+		logger.Printf("No matches yet for pattern %s, will retry", pattern)
+	}
+	if *fromFile != "" {
+		if _, err := watchFileList(*fromFile, config); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
 		}
-	case ".json":
-		if err := json.Unmarshal(data, &config); err != nil {
-			return config, err
+	}
+	replay := make(chan os.Signal, 1)
+	if len(replaySignals) > 0 {
+		signal.Notify(replay, replaySignals...)
+		defer signal.Stop(replay)
+	}
+	var triggers <-chan string
+	if *triggerFIFO != "" {
+		var stopTriggers func()
+		var err error
+		if triggers, stopTriggers, err = startTriggerFIFO(*triggerFIFO); err != nil {
+			return err
 		}
-	default:
-		return config, fmt.Errorf("unsupported configuration file format: %s", path)
+		defer stopTriggers()
 	}
+	if config.ReadyFile != "" {
+		defer startReadyFile(config.ReadyFile)()
+	}
+	// The tracked files are read again once changes to the git index
+	// settled. The git directory is watched rather than the index, which
+	// git replaces on every update.
+	retrack := time.NewTimer(debounceDuration)
+	retrack.Stop()
+	if gitIndex != "" {
+		watchPath(filepath.Dir(gitIndex), filepath.Dir(gitIndex))
+	}
+	// Edits of the configuration file are applied once they settled, and
+	// reloadSignals apply it right away.
+	reload := time.NewTimer(debounceDuration)
+	reload.Stop()
+	if configPath != "" {
+		watchPath(configPath, configPath)
+	}
+	reloadRequested := make(chan os.Signal, 1)
+	if len(reloadSignals) > 0 {
+		signal.Notify(reloadRequested, reloadSignals...)
+		defer signal.Stop(reloadRequested)
+	}
+	retry := time.NewTicker(lazyRegisterInterval)
+	defer retry.Stop()
+	changes := newChangeLogger(changeLogWindow)
 
-	return config, nil
-}
+	// Events are collected until no change has been seen for the debounce
+	// duration, then the settled batch is handed to the rules at once. A
+	// debounce of zero hands every event to the rules on its own, and so do
+	// rules with no_debounce, unless project_settle holds them back too.
+	var pending []string
+	// ops holds the operations seen for each pending path.
+	ops := make(map[string]fsnotify.Op)
+	debounce := newDebouncer(config, debounceDuration)
+	settle := time.NewTimer(debounceDuration)
+	settle.Stop()
+	eventQueue := make(chan ruleBatch)
 
-func addPatternsToWatcher(config Config) {
-	for _, rule := range config.Rules {
-		for _, pattern := range rule.Patterns {
-			matches, err := filepath.Glob(pattern)
+	// Files held back by a rule's min_age come back through deferred.
+	deferred := make(chan ruleBatch)
+	deferBatch = func(batch ruleBatch, wait time.Duration) {
+		time.AfterFunc(wait, func() {
+			select {
+			case deferred <- batch:
+			case <-ctx.Done():
+			}
+		})
+	}
+
+	// limitReached is closed by the executor once maxEvents cycles ran, or
+	// once a command failed with the "exit" policy, recorded in fatal.
+	limitReached := make(chan struct{})
+	var fatal error
+	// summary collects the reports for --summary-file.
+	var summary RunSummary
+	executorDone := make(chan struct{})
+	go func() {
+		defer close(executorDone)
+		cycles := 0
+		stopped := false
+		for batch := range eventQueue {
+			if stopped {
+				continue
+			}
+			config := currentConfig()
+			reports, err := executeBatch(ctx, batch, config)
+			summary.add(reports)
 			if err != nil {
-				logger.Printf("Failed to resolve pattern %s: %v", pattern, err)
+				logger.Printf("Shutting down due to failure: %v", err)
+				fatal = err
+				stopped = true
+				close(limitReached)
 				continue
 			}
-			for _, match := range matches {
-				if isIgnoredDir(match, config.IgnoreDirs) {
-					continue
-				}
-				err := watcher.Add(match)
-				if err != nil {
-					logger.Printf("Failed to watch file %s: %v", match, err)
-				} else {
-					logger.Printf("Watching file: %s", match)
-				}
+			if len(reports) == 0 {
+				continue
+			}
+			recordCycle(batch, reports)
+			cycles++
+			if maxEvents > 0 && cycles == maxEvents {
+				logger.Printf("Reached %d run cycles, shutting down...", maxEvents)
+				stopped = true
+				close(limitReached)
 			}
 		}
+	}()
+	defer func() {
+		cancel()
+		close(eventQueue)
+		<-executorDone
+		deferBatch = nil
+		runningCommands.Wait()
+		if *summaryFile != "" {
+			if err := writeSummary(*summaryFile, summary); err != nil {
+				logger.Printf("Failed to write summary file %s: %v", *summaryFile, err)
+			}
+		}
+	}()
+
+	// send queues a batch and reports false once the loop should stop.
+	send := func(batch ruleBatch) bool {
+		select {
+		case eventQueue <- batch:
+			return true
+		case <-limitReached:
+			return false
+		}
 	}
-}
 
-func isIgnoredDir(path string, ignoreDirs []string) bool {
-	for _, ignore := range ignoreDirs {
-		if strings.Contains(path, ignore) {
+	// handleEvent queues a change and reports false once the loop should stop.
+	handleEvent := func(event fsnotify.Event) bool {
+		config := currentConfig()
+		if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+			if pattern, orphaned := releaseWatch(event.Name); orphaned {
+				unresolved = append(unresolved, pattern)
+			}
+		}
+		if event.Has(fsnotify.Create) && len(unresolved) > 0 {
+			unresolved = registerPendingPatterns(unresolved, config)
+		}
+		if event.Has(fsnotify.Create) {
+			watchNewDir(event.Name, config)
+		}
+		if configPath != "" && filepath.Clean(event.Name) == filepath.Clean(configPath) {
+			reload.Reset(debounceDuration)
+		}
+		if gitIndex != "" && event.Name == gitIndex {
+			retrack.Reset(debounceDuration)
+		}
+		if !admitEvent(event, config) {
 			return true
 		}
+		changes.Record(event)
+		if debounce.disabled() {
+			traceMatch(event, "handed to the rules right away, the debounce time is 0")
+			return send(ruleBatch{files: []string{event.Name}, ops: map[string]fsnotify.Op{event.Name: event.Op}})
+		}
+		if !isTrue(config.ProjectSettle) && matchesAnyRule(config.Rules, event.Name, noDebounce) {
+			traceMatch(event, "handed to the no_debounce rules right away")
+			batch := ruleBatch{files: []string{event.Name}, ops: map[string]fsnotify.Op{event.Name: event.Op}, filter: noDebounce}
+			if !send(batch) {
+				return false
+			}
+			// Changes only no_debounce rules care about must not delay
+			// the settled batch.
+			if !matchesAnyRule(config.Rules, event.Name, debounced) {
+				return true
+			}
+		}
+		if _, ok := ops[event.Name]; !ok {
+			pending = append(pending, event.Name)
+		}
+		ops[event.Name] |= event.Op
+		wait := debounce.next(time.Now())
+		traceMatch(event, "debounced, the batch settles after %s without changes", wait)
+		settle.Reset(wait)
+		return true
 	}
-	return false
-}
 
-func executeInitialCommands(config Config) {
-	for _, rule := range config.Rules {
-		for _, cmd := range rule.Commands {
-			logger.Printf("Executing initial command: %s", cmd.Cmd)
-			if !executeCommand(cmd) {
-				logger.Printf("Initial command failed: %s", cmd.Cmd)
+	// applyReload reads the configuration file and the --from-file list
+	// again and swaps them in. It returns an error only when either is
+	// invalid and the policy is to fail.
+	applyReload := func() error {
+		reloaded, err := reloadConfig(configPath)
+		var listed []string
+		if err == nil && *fromFile != "" {
+			listed, err = readFileList(*fromFile)
+		}
+		if err != nil {
+			if *configErrorPolicy == configErrorFail {
+				return fmt.Errorf("%w: reloading %s: %v", ErrInvalidConfig, configPath, err)
 			}
+			logger.Printf("Failed to reload %s, keeping the previous configuration: %v", configPath, err)
+			return nil
+		}
+		logger.Printf("Reloaded configuration %s", configPath)
+		setConfig(reloaded)
+		keep := []string{configPath}
+		if gitIndex != "" {
+			keep = append(keep, filepath.Dir(gitIndex))
 		}
+		unresolved = rewatch(reloaded, listed, keep...)
+		return nil
 	}
-}
 
-func executeRules(filePath string, config Config) {
-	for _, rule := range config.Rules {
-		for _, pattern := range rule.Patterns {
-			// Use gobwas/glob to match the file path with the pattern
-			g := glob.MustCompile(pattern)
-			if g.Match(filePath) {
-				for _, cmd := range rule.Commands {
-					logger.Printf("Executing command: %s", cmd.Cmd)
-					if !executeCommand(cmd) {
-						// Stop executing further commands if one fails in non-parallel mode
-						if !cmd.Parallel {
-							logger.Printf("Stopping execution due to failure of command: %s", cmd.Cmd)
-							break
-						}
-					}
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				logger.Println("Watcher closed, shutting down...")
+				return nil
+			}
+			if !handleEvent(event) {
+				return fatal
+			}
+		case event := <-pollEvents:
+			if !handleEvent(event) {
+				return fatal
+			}
+		case path := <-triggers:
+			// "*" stands for every file the rules currently match
+			paths := []string{path}
+			if path == "*" {
+				paths = recentlyModified(currentConfig(), time.Time{})
+			}
+			logger.Printf("Triggered %s through the FIFO", path)
+			for _, path := range paths {
+				if !handleEvent(fsnotify.Event{Name: path, Op: fsnotify.Write}) {
+					return fatal
 				}
 			}
+		case <-replay:
+			last, ok := lastCycle()
+			if !ok {
+				logger.Println("Nothing to replay yet")
+				continue
+			}
+			logger.Printf("Replaying the run cycle of %s", last.Time.Format(time.TimeOnly))
+			if !send(last.Batch) {
+				return fatal
+			}
+		case <-reload.C:
+			if err := applyReload(); err != nil {
+				return err
+			}
+		case sig := <-reloadRequested:
+			if configPath == "" {
+				logger.Printf("Received %s, but there is no configuration file to reload", sig)
+				continue
+			}
+			logger.Printf("Received %s, reloading %s", sig, configPath)
+			if err := applyReload(); err != nil {
+				return err
+			}
+		case <-retrack.C:
+			loadTrackedFiles()
+			unresolved = append(unresolved, addPatternsToWatcher(currentConfig())...)
+		case <-retry.C:
+			if len(unresolved) > 0 {
+				unresolved = registerPendingPatterns(unresolved, currentConfig())
+			}
+		case <-settle.C:
+			batch := ruleBatch{files: pending, ops: ops, filter: debounced}
+			if isTrue(currentConfig().ProjectSettle) {
+				batch.filter = nil
+			}
+			pending = nil
+			ops = make(map[string]fsnotify.Op)
+			if !send(batch) {
+				return fatal
+			}
+		case batch := <-deferred:
+			if !send(batch) {
+				return fatal
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				logger.Println("Watcher closed, shutting down...")
+				return nil
+			}
+			logger.Printf("Watcher error: %v", err)
+		case <-limitReached:
+			return fatal
+		case <-ctx.Done():
+			return nil
 		}
 	}
 }
 
-func executeCommand(cmd Command) bool {
-	// Terminate any existing process for the command
-	if existingCmd, exists := cmdProcesses[cmd.Cmd]; exists && existingCmd.Process != nil {
-		logger.Printf("Terminating existing command: %s", cmd.Cmd)
-		if err := existingCmd.Process.Signal(syscall.SIGTERM); err != nil {
-			logger.Printf("Failed to terminate command: %s, Error: %v", cmd.Cmd, err)
+// waitForPaths blocks until every path exists, checking periodically. It
+// fails when the timeout passes first or ctx is cancelled.
+func waitForPaths(ctx context.Context, paths []string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(waitForInterval)
+	defer ticker.Stop()
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		logger.Printf("Waiting for %s...", path)
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return fmt.Errorf("gave up waiting for %s: %w", path, ctx.Err())
+			}
+			if _, err := os.Stat(path); err == nil {
+				break
+			}
 		}
-		existingCmd.Wait()
 	}
+	return nil
+}
 
-	var command *exec.Cmd
-	shellArgs := strings.Split(*shell, " ")
-	command = exec.Command(shellArgs[0], append(shellArgs[1:], cmd.Cmd)...)
-	command.Stdout = os.Stdout
-	command.Stderr = os.Stderr
-	command.Env = os.Environ()
-
-	cmdProcesses[cmd.Cmd] = command
+// watchStdinClose returns a channel that is closed once r reaches EOF or
+// fails, which lets a supervisor stop go-watch by closing its stdin.
+func watchStdinClose(r io.Reader) <-chan struct{} {
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		_, _ = io.Copy(io.Discard, r)
+	}()
+	return closed
+}
 
-	if cmd.Parallel {
-		go func() {
-			if err := command.Run(); err != nil {
-				logger.Printf("Command failed: %s, Error: %v", cmd.Cmd, err)
-			}
-		}()
-		return true
-	} else {
-		if err := command.Run(); err != nil {
-			logger.Printf("Command failed: %s, Error: %v", cmd.Cmd, err)
-			return false
+// Validate checks the configuration for values that cannot be run.
+func (config Config) Validate() error {
+	if config.LogLevel != "" && config.LogLevel != "info" && config.LogLevel != "debug" {
+		return fmt.Errorf("unsupported log level %q", config.LogLevel)
+	}
+	if config.DebounceTime != "" {
+		debounce, err := time.ParseDuration(config.DebounceTime)
+		if err != nil {
+			return fmt.Errorf("invalid debounce time: %v", err)
+		}
+		if debounce < 0 {
+			return fmt.Errorf("debounce time must not be negative: %s", config.DebounceTime)
+		}
+	}
+	switch config.DebounceMode {
+	case "", debounceFixed:
+	case debounceAdaptive:
+		fixed, _ := time.ParseDuration(config.DebounceTime)
+		if _, _, err := debounceBounds(config, fixed); err != nil {
+			return err
 		}
+	default:
+		return fmt.Errorf("unsupported debounce_mode %q", config.DebounceMode)
+	}
+	if config.MaxParallel < 0 {
+		return fmt.Errorf("max_parallel must not be negative: %d", config.MaxParallel)
+	}
+	if _, err := parseSize(config.MaxWatchFileSize); err != nil {
+		return fmt.Errorf("invalid max_watch_file_size: %v", err)
+	}
+	if config.DebounceJitter != "" {
+		jitter, err := time.ParseDuration(config.DebounceJitter)
+		if err != nil {
+			return fmt.Errorf("invalid debounce_jitter: %v", err)
+		}
+		if jitter < 0 {
+			return fmt.Errorf("debounce_jitter must not be negative: %s", config.DebounceJitter)
+		}
+	}
+	if !validFailurePolicy(config.OnFailure) {
+		return fmt.Errorf("unsupported on_failure policy %q", config.OnFailure)
+	}
+	if config.WebhookTimeout != "" {
+		if _, err := time.ParseDuration(config.WebhookTimeout); err != nil {
+			return fmt.Errorf("invalid webhook timeout: %v", err)
+		}
+	}
+	if config.CommandTimeout != "" {
+		if d, err := time.ParseDuration(config.CommandTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid command timeout %q: must be a positive duration", config.CommandTimeout)
+		}
+	}
+	if config.NetworkCheckAddress != "" {
+		if _, _, err := net.SplitHostPort(config.NetworkCheckAddress); err != nil {
+			return fmt.Errorf("invalid network check address %q: %v", config.NetworkCheckAddress, err)
+		}
+	}
+	for _, event := range config.Events {
+		if _, ok := eventOps[event]; !ok {
+			return fmt.Errorf("unsupported event %q", event)
+		}
+	}
+	for _, pattern := range config.IgnorePatterns {
+		if _, err := glob.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid ignore pattern %q: %v", pattern, err)
+		}
+	}
+
+	// Names must be unique, or needs and the rule order would depend on
+	// which of the duplicates is picked.
+	names := make(map[string]bool)
+	for _, rule := range config.Rules {
+		if rule.Name != "" && names[rule.Name] {
+			return fmt.Errorf("duplicate rule name %q", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+	for _, rule := range config.Rules {
+		for _, pattern := range rule.Patterns {
+			if _, err := glob.Compile(stripCaptures(pattern)); err != nil {
+				return fmt.Errorf("rule %q has an invalid pattern %q: %v", rule.Name, pattern, err)
+			}
+			if hasCaptures(pattern) {
+				if _, err := captureRegexp(pattern); err != nil {
+					return fmt.Errorf("rule %q has invalid captures in pattern %q: %v", rule.Name, pattern, err)
+				}
+			}
+		}
+		if n, ok := missingCapture(rule); ok {
+			return fmt.Errorf("rule %q uses {{.%d}}, but none of its patterns has capture group %d", rule.Name, n, n)
+		}
+		for _, event := range rule.Events {
+			if _, ok := eventOps[event]; !ok {
+				return fmt.Errorf("rule %q has an unsupported event %q", rule.Name, event)
+			}
+		}
+		if rule.LogLevel != "" && rule.LogLevel != "info" && rule.LogLevel != "debug" {
+			return fmt.Errorf("rule %q has an unsupported log level %q", rule.Name, rule.LogLevel)
+		}
+		for _, dir := range rule.WatchDirs {
+			if strings.TrimSpace(dir) == "" {
+				return fmt.Errorf("rule %q has an empty watch_dirs entry", rule.Name)
+			}
+		}
+		for _, dir := range rule.IgnoreDirs {
+			if strings.TrimSpace(dir) == "" {
+				return fmt.Errorf("rule %q has an empty ignore_dirs entry", rule.Name)
+			}
+		}
+		for key := range rule.Env {
+			if key == "" || strings.ContainsAny(key, "= ") {
+				return fmt.Errorf("rule %q has an invalid env name %q", rule.Name, key)
+			}
+		}
+		for _, ext := range rule.Extensions {
+			if strings.Trim(ext, ". ") == "" {
+				return fmt.Errorf("rule %q has an empty extensions entry", rule.Name)
+			}
+		}
+		if rule.ActiveHours != "" {
+			if _, _, err := parseActiveHours(rule.ActiveHours); err != nil {
+				return fmt.Errorf("rule %q: %v", rule.Name, err)
+			}
+		}
+		if rule.OutsideHours != "" && rule.OutsideHours != outsideHoursIgnore && rule.OutsideHours != outsideHoursQueue {
+			return fmt.Errorf("rule %q has an unsupported outside_hours %q", rule.Name, rule.OutsideHours)
+		}
+		if rule.MinAge != "" {
+			if _, err := time.ParseDuration(rule.MinAge); err != nil {
+				return fmt.Errorf("rule %q has an invalid min_age: %v", rule.Name, err)
+			}
+		}
+		for _, size := range []string{rule.MinSize, rule.MaxSize} {
+			if _, err := parseSize(size); err != nil {
+				return fmt.Errorf("rule %q has an invalid size: %v", rule.Name, err)
+			}
+		}
+		for _, need := range rule.Needs {
+			if !names[need] {
+				return fmt.Errorf("rule %q needs unknown rule %q", rule.Name, need)
+			}
+		}
+	}
+	if _, err := sortRules(config.Rules); err != nil {
+		return err
+	}
+
+	commands := append([]Command{}, config.StartupCommands...)
+	for _, rule := range config.Rules {
+		commands = append(commands, rule.Commands...)
+	}
+	for _, cmd := range commands {
+		if cmd.Cmd != "" && len(cmd.Args) > 0 {
+			return fmt.Errorf("command %q sets both cmd and args", cmd.Cmd)
+		}
+		if cmd.OutputParser != "" && cmd.OutputParser != parserGoTest && cmd.OutputParser != parserJest {
+			return fmt.Errorf("command %q has an unsupported output_parser %q", cmd, cmd.OutputParser)
+		}
+		if cmd.OutputMode != "" && cmd.OutputMode != "append" && cmd.OutputMode != "truncate" {
+			return fmt.Errorf("command %q has an unsupported output mode %q", cmd, cmd.OutputMode)
+		}
+		if !validFailurePolicy(cmd.OnFailure) {
+			return fmt.Errorf("command %q has an unsupported on_failure policy %q", cmd, cmd.OnFailure)
+		}
+		if cmd.Retries < 0 {
+			return fmt.Errorf("command %q has negative retries", cmd)
+		}
+		if cmd.RetryDelay != "" {
+			if _, err := time.ParseDuration(cmd.RetryDelay); err != nil {
+				return fmt.Errorf("command %q has an invalid retry_delay: %v", cmd, err)
+			}
+		}
+		if cmd.QuietPeriod != "" {
+			if _, err := time.ParseDuration(cmd.QuietPeriod); err != nil {
+				return fmt.Errorf("command %q has an invalid quiet period: %v", cmd, err)
+			}
+		}
+		if cmd.Timeout != "" {
+			if d, err := time.ParseDuration(cmd.Timeout); err != nil || d <= 0 {
+				return fmt.Errorf("command %q has an invalid timeout %q: must be a positive duration", cmd, cmd.Timeout)
+			}
+		}
+		if _, err := parseStopSignal(cmd.StopSignal); err != nil {
+			return fmt.Errorf("command %q: %v", cmd, err)
+		}
+		if cmd.StopTimeout != "" {
+			if d, err := time.ParseDuration(cmd.StopTimeout); err != nil || d <= 0 {
+				return fmt.Errorf("command %q has an invalid stop_timeout %q", cmd, cmd.StopTimeout)
+			}
+		}
+		if cmd.IdleWarning != "" {
+			if idle, err := time.ParseDuration(cmd.IdleWarning); err != nil || idle <= 0 {
+				return fmt.Errorf("command %q has an invalid idle_warning %q", cmd, cmd.IdleWarning)
+			}
+		}
+		if cmd.Substitution != "" && cmd.Substitution != substitutionQuote && cmd.Substitution != substitutionRaw {
+			return fmt.Errorf("command %q has an unsupported substitution %q", cmd, cmd.Substitution)
+		}
+		if cmd.PTY && cmd.StderrFile != "" {
+			return fmt.Errorf("command %q sets stderr_file, but pty merges stderr into stdout", cmd)
+		}
+		if _, err := regexp.Compile(cmd.SuccessPattern); err != nil {
+			return fmt.Errorf("command %q has an invalid success_pattern: %v", cmd, err)
+		}
+		if _, err := regexp.Compile(cmd.FailurePattern); err != nil {
+			return fmt.Errorf("command %q has an invalid failure_pattern: %v", cmd, err)
+		}
+	}
+	return nil
+}
+
+// logDestination returns where log lines go. The printed configuration and
+// the --no-exec match reports own stdout so they can be piped, and must not
+// be mixed with log lines, which go to stderr then.
+func logDestination() io.Writer {
+	if *printConfigFlag || *noExec {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// printConfig writes the configuration as JSON when format is "json", and
+// as YAML otherwise.
+func printConfig(w io.Writer, config Config, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(config)
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(config); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// checkConfig validates the configuration and writes a summary of its
+// rules, patterns and commands, without starting the watcher.
+func checkConfig(w io.Writer, config Config) error {
+	fmt.Fprintf(w, "Debounce time: %s\n", config.DebounceTime)
+	if config.DebounceMode == debounceAdaptive {
+		fixed, _ := time.ParseDuration(config.DebounceTime)
+		if lower, upper, err := debounceBounds(config, fixed); err == nil {
+			fmt.Fprintf(w, "Adaptive debounce: %s to %s\n", lower, upper)
+		}
+	}
+	if config.DebounceJitter != "" {
+		fmt.Fprintf(w, "Debounce jitter: up to %s\n", config.DebounceJitter)
+	}
+	if isTrue(config.ProjectSettle) {
+		fmt.Fprintln(w, "Project settle: every rule waits for the whole project")
+	}
+	if len(config.IgnoreDirs) > 0 {
+		fmt.Fprintf(w, "Ignore dirs: %s\n", strings.Join(config.IgnoreDirs, ", "))
+	}
+	for _, cmd := range config.StartupCommands {
+		fmt.Fprintf(w, "Startup command: %s\n", cmd)
+	}
+	fmt.Fprintf(w, "Rules: %d\n", len(config.Rules))
+	for i, rule := range config.Rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if rule.Disabled {
+			name += " (disabled)"
+		}
+		fmt.Fprintf(w, "  Rule %s\n", name)
+		for _, pattern := range rule.Patterns {
+			fmt.Fprintf(w, "    pattern: %s\n", pattern)
+		}
+		for _, cmd := range rule.Commands {
+			fmt.Fprintf(w, "    command: %s\n", cmd)
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		fmt.Fprintf(w, "Configuration invalid: %v\n", err)
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	fmt.Fprintln(w, "Configuration OK")
+	return nil
+}
+
+// debugEnabled reports whether debug logging was requested, with
+// --log-level or the log_level of the active configuration.
+func debugEnabled() bool {
+	if level := currentConfig().LogLevel; level != "" {
+		return level == "debug"
+	}
+	return *logLevel == "debug"
+}
+
+// debugf logs only when the log level is debug.
+func debugf(format string, args ...interface{}) {
+	if debugEnabled() {
+		logger.Output(2, "[debug] "+fmt.Sprintf(format, args...))
+	}
+}
+
+// logAt logs to l at the given level. Debug messages only appear when the
+// log level is debug; any other level logs as info.
+func logAt(l *log.Logger, level string, format string, args ...interface{}) {
+	if level == "debug" {
+		if debugEnabled() {
+			l.Output(2, "[debug] "+fmt.Sprintf(format, args...))
+		}
+		return
+	}
+	l.Output(2, fmt.Sprintf(format, args...))
+}
+
+// isFlagSet reports whether the named flag was given on the command line.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func parseRules(rules string) []Rule {
+	var parsedRules []Rule
+	rulePairs := strings.Split(rules, ",")
+	for _, pair := range rulePairs {
+		parts := strings.Split(pair, ":")
+		if len(parts) == 2 {
+			parsedRules = append(parsedRules, Rule{
+				Patterns: []string{parts[0]},
+				Commands: []Command{{Cmd: parts[1], Parallel: false}},
+			})
+		}
+	}
+	return parsedRules
+}
+
+// enabledRules returns the rules that are neither marked disabled nor named
+// in the disabled list.
+func enabledRules(rules []Rule, disabled []string) []Rule {
+	var enabled []Rule
+	for _, rule := range rules {
+		if rule.Disabled || (rule.Name != "" && containsString(disabled, rule.Name)) {
+			logger.Printf("Rule disabled: %s", rule.Name)
+			continue
+		}
+		enabled = append(enabled, rule)
+	}
+	return enabled
+}
+
+// filterRulesByPatterns keeps the rules with a pattern matching one of the
+// only globs (when given) and drops those with a pattern matching one of the
+// exclude globs.
+func filterRulesByPatterns(rules []Rule, only, exclude []string) []Rule {
+	if len(only) == 0 && len(exclude) == 0 {
+		return rules
+	}
+	var filtered []Rule
+	for _, rule := range rules {
+		if len(only) > 0 && !rulePatternMatches(rule, only) {
+			logger.Printf("Rule filtered out by --only-patterns: %s", rule.Name)
+			continue
+		}
+		if rulePatternMatches(rule, exclude) {
+			logger.Printf("Rule filtered out by --exclude-patterns: %s", rule.Name)
+			continue
+		}
+		filtered = append(filtered, rule)
+	}
+	return filtered
+}
+
+// rulePatternMatches reports whether any of the rule's patterns equals or
+// matches one of the filter globs.
+func rulePatternMatches(rule Rule, filters []string) bool {
+	for _, filter := range filters {
+		g, err := glob.Compile(filter)
+		if err != nil {
+			logger.Printf("Invalid pattern filter %s: %v", filter, err)
+			continue
+		}
+		for _, pattern := range rule.Patterns {
+			if pattern == filter || g.Match(pattern) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if strings.TrimSpace(item) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// loadConfig loads the project configuration merged over the user-global
+// configuration. Project values take precedence; see mergeConfig.
+func loadConfig(path string) (Config, error) {
+	var config Config
+
+	if globalPath := globalConfigPath(); globalPath != "" {
+		global, err := readConfigFile(globalPath)
+		if err != nil {
+			return config, fmt.Errorf("global configuration %s: %w", globalPath, err)
+		}
+		logger.Printf("Loaded global configuration: %s", globalPath)
+		config = global
+	}
+
+	if path == "" {
+		// Try default configuration files in the working directory and its
+		// ancestors
+		if wd, err := os.Getwd(); err == nil {
+			path = findDefaultConfig(wd)
+		}
+		if dir := filepath.Dir(path); path != "" && dir != "." {
+			// Patterns and commands are relative to the project root
+			if err := os.Chdir(dir); err != nil {
+				return config, err
+			}
+			logger.Printf("Using configuration %s, running from %s", path, dir)
+			path = filepath.Base(path)
+		}
+	}
+
+	if path == "" {
+		logger.Println("No configuration file supplied and no default configuration file found.")
+		return config, nil
+	}
+
+	project, err := readConfigFile(path)
+	if err != nil {
+		return config, err
+	}
+	configPath = path
+
+	config = mergeConfig(config, project)
+	return config, nil
+}
+
+// reloadConfig reads the configuration file again the way run reads it at
+// startup.
+func reloadConfig(path string) (Config, error) {
+	config, err := loadConfig(path)
+	if err != nil {
+		return config, err
+	}
+	return normalizeConfig(config)
+}
+
+// normalizeConfig applies the flags and defaults to a loaded configuration,
+// validates it and drops the disabled rules, as run does at startup.
+func normalizeConfig(config Config) (Config, error) {
+	config = applyConfigFlags(config)
+	if err := config.Validate(); err != nil {
+		return config, err
+	}
+	return applyRuleFilters(config), nil
+}
+
+// applyConfigFlags applies the command-line flags that take the place of a
+// configuration file, --log-level over log_level, --network-check-address
+// over network_check_address, the default ignore dirs and the extensions
+// shorthand.
+func applyConfigFlags(config Config) Config {
+	if *configFile == "" {
+		if *ignoreDirs != "" {
+			config.IgnoreDirs = strings.Split(*ignoreDirs, ",")
+		}
+		if isFlagSet("debounce-time") || config.DebounceTime == "" {
+			config.DebounceTime = *debounceTime
+		}
+		if *rules != "" {
+			config.Rules = parseRules(*rules)
+		}
+	}
+	if isFlagSet("log-level") || config.LogLevel == "" {
+		config.LogLevel = *logLevel
+	}
+	if isFlagSet("network-check-address") || config.NetworkCheckAddress == "" {
+		config.NetworkCheckAddress = *networkCheckAddr
+	}
+	config.IgnoreDirs = withDefaultIgnoreDirs(config)
+	config.Rules = withExtensionPatterns(config.Rules)
+	return config
+}
+
+// applyRuleFilters drops the rules disabled with --disable-rule or
+// GO_WATCH_DISABLE_RULES, and those filtered by --only-patterns and
+// --exclude-patterns.
+func applyRuleFilters(config Config) Config {
+	disabled := []string(disableRules)
+	if env := os.Getenv("GO_WATCH_DISABLE_RULES"); env != "" {
+		disabled = append(disabled, strings.Split(env, ",")...)
+	}
+	config.Rules = enabledRules(config.Rules, disabled)
+	config.Rules = filterRulesByPatterns(config.Rules, splitList(*onlyPatterns), splitList(*exclPatterns))
+	return config
+}
+
+// findDefaultConfig returns the nearest default configuration file in dir
+// or one of its ancestors. A file in dir itself is returned as a bare file
+// name; an empty string means none was found.
+func findDefaultConfig(dir string) string {
+	defaultFiles := []string{"go-watch.config.yaml", "go-watch.config.json"}
+	for current := dir; ; current = filepath.Dir(current) {
+		for _, file := range defaultFiles {
+			candidate := filepath.Join(current, file)
+			if _, err := os.Stat(candidate); err == nil {
+				if current == dir {
+					return file
+				}
+				return candidate
+			}
+		}
+		if filepath.Dir(current) == current {
+			return ""
+		}
+	}
+}
+
+// globalConfigPath returns the user-global configuration file under
+// $XDG_CONFIG_HOME/go-watch (falling back to ~/.config/go-watch), or an
+// empty string if none exists.
+func globalConfigPath() string {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		base = filepath.Join(home, ".config")
+	}
+	for _, name := range []string{"config.yaml", "config.yml", "config.json"} {
+		file := filepath.Join(base, "go-watch", name)
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+	}
+	return ""
+}
+
+func readConfigFile(path string) (Config, error) {
+	return readConfigIncludes(path, nil)
+}
+
+// readConfigIncludes reads the configuration file at path along with its
+// includes. stack holds the absolute paths of the files including it.
+func readConfigIncludes(path string, stack []string) (Config, error) {
+	var config Config
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return config, err
+		}
+	case ".json":
+		if err := json.Unmarshal(data, &config); err != nil {
+			return config, err
+		}
+	default:
+		return config, fmt.Errorf("unsupported configuration file format: %s", path)
+	}
+
+	config = expandConfigEnv(config)
+	if config, err = readPatternsFiles(path, config); err != nil {
+		return config, err
+	}
+	if len(config.Include) > 0 {
+		return resolveIncludes(path, config, stack)
+	}
+	return config, nil
+}
+
+// expandConfigEnv expands ${VAR} references in path-like configuration
+// values. "$$" yields a literal "$". Commands are left alone since the shell
+// expands them.
+func expandConfigEnv(config Config) Config {
+	config.Include = expandEnvList(config.Include)
+	config.IgnoreDirs = expandEnvList(config.IgnoreDirs)
+	config.IgnorePatterns = expandEnvList(config.IgnorePatterns)
+	config.WebhookURL = expandEnv(config.WebhookURL)
+	config.ReadyFile = expandEnv(config.ReadyFile)
+	if config.WebhookHeaders != nil {
+		headers := make(map[string]string, len(config.WebhookHeaders))
+		for key, value := range config.WebhookHeaders {
+			headers[key] = expandEnv(value)
+		}
+		config.WebhookHeaders = headers
+	}
+	config.StartupCommands = expandCommandsEnv(config.StartupCommands)
+
+	rules := make([]Rule, len(config.Rules))
+	for i, rule := range config.Rules {
+		rule.Root = expandEnv(rule.Root)
+		rule.IgnoreDirs = expandEnvList(rule.IgnoreDirs)
+		rule.PatternsFile = expandEnv(rule.PatternsFile)
+		rule.Patterns = expandEnvList(rule.Patterns)
+		rule.Commands = expandCommandsEnv(rule.Commands)
+		rules[i] = rule
+	}
+	if config.Rules != nil {
+		config.Rules = rules
+	}
+	return config
+}
+
+func expandCommandsEnv(commands []Command) []Command {
+	if commands == nil {
+		return nil
+	}
+	expanded := make([]Command, len(commands))
+	for i, cmd := range commands {
+		cmd.StdoutFile = expandEnv(cmd.StdoutFile)
+		cmd.StderrFile = expandEnv(cmd.StderrFile)
+		expanded[i] = cmd
+	}
+	return expanded
+}
+
+func expandEnvList(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	expanded := make([]string, len(values))
+	for i, value := range values {
+		expanded[i] = expandEnv(value)
+	}
+	return expanded
+}
+
+func expandEnv(value string) string {
+	return os.Expand(value, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		return os.Getenv(name)
+	})
+}
+
+// mergeConfig layers override on top of base. Ignore dirs are combined,
+// other values from override replace those in base when set.
+func mergeConfig(base, override Config) Config {
+	merged := base
+	for _, dir := range override.IgnoreDirs {
+		if !containsString(merged.IgnoreDirs, dir) {
+			merged.IgnoreDirs = append(merged.IgnoreDirs, dir)
+		}
+	}
+	for _, pattern := range override.IgnorePatterns {
+		if !containsString(merged.IgnorePatterns, pattern) {
+			merged.IgnorePatterns = append(merged.IgnorePatterns, pattern)
+		}
+	}
+	if override.NoDefaultIgnores != nil {
+		merged.NoDefaultIgnores = override.NoDefaultIgnores
+	}
+	if override.GitTrackedOnly != nil {
+		merged.GitTrackedOnly = override.GitTrackedOnly
+	}
+	if override.RulesParallel != nil {
+		merged.RulesParallel = override.RulesParallel
+	}
+	if override.ProjectSettle != nil {
+		merged.ProjectSettle = override.ProjectSettle
+	}
+	if override.LogLevel != "" {
+		merged.LogLevel = override.LogLevel
+	}
+	if override.NetworkCheckAddress != "" {
+		merged.NetworkCheckAddress = override.NetworkCheckAddress
+	}
+	if override.MaxParallel != 0 {
+		merged.MaxParallel = override.MaxParallel
+	}
+	if override.UseDefaultIgnores != nil {
+		merged.UseDefaultIgnores = override.UseDefaultIgnores
+	}
+	if override.IgnoreHidden != nil {
+		merged.IgnoreHidden = override.IgnoreHidden
+	}
+	if override.OnFailure != "" {
+		merged.OnFailure = override.OnFailure
+	}
+	if override.CommandTimeout != "" {
+		merged.CommandTimeout = override.CommandTimeout
+	}
+	if override.DebounceTime != "" {
+		merged.DebounceTime = override.DebounceTime
+	}
+	if override.DebounceMode != "" {
+		merged.DebounceMode = override.DebounceMode
+		merged.DebounceMin = override.DebounceMin
+		merged.DebounceMax = override.DebounceMax
+	}
+	if override.MaxWatchFileSize != "" {
+		merged.MaxWatchFileSize = override.MaxWatchFileSize
+	}
+	if override.DebounceJitter != "" {
+		merged.DebounceJitter = override.DebounceJitter
+	}
+	if len(override.Events) > 0 {
+		merged.Events = override.Events
+	}
+	if override.ReadyFile != "" {
+		merged.ReadyFile = override.ReadyFile
+	}
+	if override.WebhookURL != "" {
+		merged.WebhookURL = override.WebhookURL
+		merged.WebhookHeaders = override.WebhookHeaders
+		merged.WebhookTimeout = override.WebhookTimeout
+	}
+	if len(override.StartupCommands) > 0 {
+		merged.StartupCommands = override.StartupCommands
+	}
+	if len(override.Rules) > 0 {
+		merged.Rules = override.Rules
+	}
+	return merged
+}
+
+// rewatch replaces the watched paths with those of a reloaded
+// configuration: its patterns are resolved again, the paths listed by
+// --from-file are added, and the paths in keep stay. Paths watched for
+// command output are kept as well. The new watch set is diffed against the
+// previous one, and paths only the previous configuration covered are
+// removed from the watcher. It returns the patterns that match nothing yet.
+func rewatch(config Config, listed []string, keep ...string) []string {
+	previous := watchedPaths.Paths()
+	watchedPaths.Clear()
+	for path, entry := range previous {
+		if entry.pattern == outputWatchPattern || slices.Contains(keep, path) {
+			watchedPaths.Add(path, entry.pattern)
+			if entry.polled {
+				watchedPaths.SetPolled(path)
+			}
+		}
+	}
+	unresolved := addPatternsToWatcher(config)
+	watchListedPaths(*fromFile, listed, config)
+	for path, entry := range previous {
+		if !watchedPaths.Has(path) {
+			unwatch(path, entry.polled)
+			debugf("Stopped watching %s, the configuration no longer covers it", path)
+		}
+	}
+	return unresolved
+}
+
+// unwatch removes a path from the native watcher, or from the fallback
+// poller when it is polled.
+func unwatch(path string, polled bool) {
+	if polled {
+		fallbackPoller.Remove(path)
+		return
+	}
+	// The kernel drops watches of deleted paths itself, so a failure here
+	// only means there was nothing left to release.
+	_ = watcher.Remove(path)
+}
+
+// addPatternsToWatcher registers the current matches of every rule pattern
+// and returns the patterns that matched nothing yet, so they can be retried
+// once the paths appear.
+func addPatternsToWatcher(config Config) []string {
+	start := time.Now()
+	var unresolved []string
+	for _, rule := range config.Rules {
+		ruleConfig := ruleWatchConfig(rule, config)
+		for _, pattern := range rule.Patterns {
+			pattern = rulePattern(rule, pattern)
+			if watchPattern(pattern, ruleConfig) == 0 {
+				unresolved = append(unresolved, pattern)
+			}
+		}
+		for _, dir := range rule.WatchDirs {
+			dir = rulePattern(rule, dir)
+			if watchDirTree(dir, ruleConfig) == 0 {
+				unresolved = append(unresolved, dir)
+			}
+		}
+	}
+	logger.Printf("Watching %d paths in %dms", watchedPaths.Len(), time.Since(start).Milliseconds())
+	return unresolved
+}
+
+// registerPendingPatterns retries patterns that matched nothing before and
+// returns the ones that still match nothing.
+func registerPendingPatterns(patterns []string, config Config) []string {
+	var unresolved []string
+	for _, pattern := range patterns {
+		if watchOwnedPattern(pattern, config) == 0 {
+			unresolved = append(unresolved, pattern)
+		} else {
+			logger.Printf("Pattern resolved: %s", pattern)
+		}
+	}
+	return unresolved
+}
+
+// resolvePattern returns the existing paths matching a pattern. Paths are
+// matched with the same matcher as changes, so every path it returns also
+// matches its changes. Ignored directories are not searched, and neither
+// are hidden ones unless the pattern names a hidden element; they are
+// returned themselves when they match.
+func resolvePattern(pattern string, config Config) ([]string, error) {
+	pattern = stripCaptures(pattern)
+	if !strings.ContainsAny(pattern, "*?[{") {
+		path := unescapePattern(pattern)
+		if _, err := os.Lstat(path); err != nil {
+			return nil, nil
+		}
+		return []string{path}, nil
+	}
+	m := compiledPattern(pattern)
+	root := unescapePattern(patternRoot(pattern))
+	if root == "" {
+		root = "."
+	}
+	// Without "**", a pattern only matches paths as deep as itself
+	depth := -1
+	if !strings.Contains(pattern, "**") {
+		depth = len(strings.Split(filepath.ToSlash(pattern), "/"))
+		if root != "." {
+			depth -= len(strings.Split(filepath.ToSlash(root), "/"))
+		}
+	}
+	hidden := ignoreHidden(config) && !hasHiddenSegment(pattern)
+	var matches []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root && os.IsNotExist(err) {
+				return fs.SkipAll
+			}
+			return nil
+		}
+		if path == root {
+			return nil
+		}
+		if m.Match(path) {
+			matches = append(matches, path)
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if isIgnoredDir(path, config.IgnoreDirs) || (hidden && isHidden(path)) {
+			return filepath.SkipDir
+		}
+		if depth >= 0 && pathDepth(root, path) >= depth {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return matches, err
+}
+
+// pathDepth returns how many elements path has below root.
+func pathDepth(root, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(filepath.ToSlash(rel), "/") + 1
+}
+
+// watchPattern adds every path matching the pattern to the watcher and
+// returns the number of matches.
+func watchPattern(pattern string, config Config) int {
+	matches, err := resolvePattern(pattern, config)
+	if err != nil {
+		logger.Printf("Failed to resolve pattern %s: %v", pattern, err)
+		return 0
+	}
+	added := 0
+	for _, match := range matches {
+		if isIgnoredDir(match, config.IgnoreDirs) {
+			continue
+		}
+		if ignoreHidden(config) && isHidden(match) && !hasHiddenSegment(pattern) {
+			continue
+		}
+		if isWatched(match) || isUntracked(match, config) {
+			continue
+		}
+		if tooLargeToWatch(match, config) {
+			debugf("Not watching %s, it is larger than max_watch_file_size", match)
+			continue
+		}
+		added++
+		watchPath(match, pattern)
+	}
+	if len(matches) > 0 && added == 0 {
+		debugf("Pattern %s adds no new watches, all its paths are already watched by other patterns", pattern)
+	}
+	return len(matches)
+}
+
+// watchPath adds a path resolved from pattern to the watcher, falling back
+// to polling when enabled and the native watcher cannot take it.
+// A path already watched is left alone.
+func watchPath(path, pattern string) {
+	if !watchedPaths.Add(path, pattern) {
+		return
+	}
+	err := addWatch(path)
+	if err != nil && fallbackPoller != nil && isPollable(err) {
+		// Polled paths stay in the set, so retries and reloads do not
+		// fall back for them again
+		if pollErr := fallbackPoller.Add(path); pollErr == nil {
+			watchedPaths.SetPolled(path)
+			logger.Printf("Falling back to polling for %s: %v", path, err)
+			return
+		}
+	}
+	if err != nil {
+		watchedPaths.Remove(path)
+		logger.Printf("Failed to watch file %s: %v", path, err)
+		return
+	}
+	debugf("Watching file: %s", path)
+}
+
+// isWatched reports whether a path was already added to the watcher.
+func isWatched(path string) bool {
+	return watchedPaths.Has(path)
+}
+
+// watchFileList adds the paths listed in a file, one per line, to the
+// watcher and returns how many were added. Ignored and missing paths are
+// skipped; missing ones with a warning. Each path is its own pattern, so a
+// deleted path is retried like an unmatched pattern.
+func watchFileList(listPath string, config Config) (int, error) {
+	paths, err := readFileList(listPath)
+	if err != nil {
+		return 0, err
+	}
+	return watchListedPaths(listPath, paths, config), nil
+}
+
+// readFileList returns the paths listed in a file, one per line, skipping
+// blank lines.
+func readFileList(listPath string) ([]string, error) {
+	data, err := os.ReadFile(listPath)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if path := strings.TrimSpace(line); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// watchListedPaths adds the paths read from listPath to the watcher and
+// returns how many were added.
+func watchListedPaths(listPath string, paths []string, config Config) int {
+	added := 0
+	for _, path := range paths {
+		if isWatched(path) {
+			continue
+		}
+		if isIgnoredDir(path, config.IgnoreDirs) || isIgnoredFile(path, config) {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			logger.Printf("Skipping path from %s: %v", listPath, err)
+			continue
+		}
+		if !watchedPaths.Add(path, path) {
+			continue
+		}
+		if err := addWatch(path); err != nil {
+			watchedPaths.Remove(path)
+			logger.Printf("Failed to watch file %s: %v", path, err)
+			continue
+		}
+		debugf("Watching file: %s", path)
+		added++
+	}
+	return added
+}
+
+// releaseWatch removes a deleted or renamed path from the watcher to free
+// its descriptor. It returns the pattern that resolved the path when no
+// other watched path came from it, so the pattern can be retried.
+func releaseWatch(path string) (string, bool) {
+	polled := watchedPaths.Polled(path)
+	pattern, ok := watchedPaths.Remove(path)
+	if !ok {
+		return "", false
+	}
+	unwatch(path, polled)
+	logger.Printf("Stopped watching removed path: %s", path)
+
+	// Paths from command output have no pattern to retry
+	if pattern == outputWatchPattern || watchedPaths.Count(pattern) > 0 {
+		return "", false
+	}
+	return pattern, true
+}
+
+// withDefaultIgnoreDirs returns the configured ignore dirs followed by the
+// default ones, unless use_default_ignores is false.
+func withDefaultIgnoreDirs(config Config) []string {
+	if config.UseDefaultIgnores != nil && !*config.UseDefaultIgnores {
+		return config.IgnoreDirs
+	}
+	dirs := append([]string{}, config.IgnoreDirs...)
+	for _, dir := range defaultIgnoreDirs {
+		if !containsString(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// withExtensionPatterns returns the rules with a "**/*.<ext>" pattern added
+// for each of their extensions. Empty extensions are left to Validate.
+func withExtensionPatterns(rules []Rule) []Rule {
+	out := make([]Rule, len(rules))
+	for i, rule := range rules {
+		out[i] = rule
+		if len(rule.Extensions) == 0 {
+			continue
+		}
+		patterns := append([]string{}, rule.Patterns...)
+		for _, ext := range rule.Extensions {
+			if ext = strings.TrimPrefix(strings.TrimSpace(ext), "."); ext != "" {
+				patterns = append(patterns, "{*."+ext+",**/*."+ext+"}")
+			}
+		}
+		out[i].Patterns = patterns
+	}
+	return out
+}
+
+// isIgnoredDir reports whether a path is inside an ignored directory. A
+// plain name matches whole path elements only, so ".git" does not ignore
+// ".github" and "bin" does not ignore "cabinet.go"; an entry containing a
+// separator matches anywhere in the path.
+func isIgnoredDir(path string, ignoreDirs []string) bool {
+	elements := strings.Split(filepath.ToSlash(path), "/")
+	for _, ignore := range ignoreDirs {
+		if strings.ContainsAny(ignore, `/\`) {
+			if strings.Contains(path, ignore) {
+				return true
+			}
+		} else if containsString(elements, ignore) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoreHidden reports whether hidden paths are ignored, the default.
+func ignoreHidden(config Config) bool {
+	return config.IgnoreHidden == nil || *config.IgnoreHidden
+}
+
+// isTrue reports whether an optional setting is set to true.
+func isTrue(b *bool) bool {
+	return b != nil && *b
+}
+
+// isHidden reports whether an element of the path starts with a dot. Paths
+// inside the working directory are checked relative to it, so a project in
+// a hidden directory is not hidden itself.
+func isHidden(path string) bool {
+	if abs, err := filepath.Abs(path); err == nil {
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				path = rel
+			}
+		}
+	}
+	return hasHiddenSegment(path)
+}
+
+// hasHiddenSegment reports whether an element of a path or pattern starts
+// with a dot, other than "." and "..".
+func hasHiddenSegment(path string) bool {
+	for _, element := range strings.Split(filepath.ToSlash(path), "/") {
+		if strings.HasPrefix(element, ".") && element != "." && element != ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// explicitlyWatched reports whether a rule pattern naming a hidden element
+// matches the path, which exempts it from ignore_hidden.
+func explicitlyWatched(path string, config Config) bool {
+	for _, rule := range config.Rules {
+		for _, pattern := range rule.Patterns {
+			if hasHiddenSegment(pattern) && matchPattern(rule, pattern, path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isIgnoredFile reports whether a changed path is one of go-watch's own
+// files or matches one of the ignore patterns. Patterns are matched against
+// both the full path and the file name, so "*.swp" ignores swap files in
+// any directory.
+func isIgnoredFile(path string, config Config) bool {
+	return ignoreReason(path, config) != ""
+}
+
+// ignoreReason returns why changes to path are ignored, or "" when they
+// are not.
+func ignoreReason(path string, config Config) string {
+	if isOwnFile(path, config) {
+		return "written by go-watch itself"
+	}
+	if isUntracked(path, config) {
+		return "not tracked by git (git_tracked_only)"
+	}
+	if ignoreHidden(config) && isHidden(path) && !explicitlyWatched(path, config) {
+		return "hidden (ignore_hidden)"
+	}
+	patterns := config.IgnorePatterns
+	if !isTrue(config.NoDefaultIgnores) {
+		patterns = append(append([]string{}, defaultIgnorePatterns...), patterns...)
+	}
+	base := filepath.Base(path)
+	for _, pattern := range patterns {
+		g, err := glob.Compile(pattern)
+		if err != nil {
+			logger.Printf("Invalid ignore pattern %s: %v", pattern, err)
+			continue
+		}
+		if g.Match(path) || g.Match(base) {
+			return fmt.Sprintf("matches ignore pattern %s", pattern)
+		}
+	}
+	return ""
+}
+
+// executeInitialCommands runs once before watching. Configured startup
+// commands take the place of the rule commands. It returns the command error
+// of a failed command with the "exit" policy.
+func executeInitialCommands(ctx context.Context, config Config) error {
+	if *noExec {
+		logger.Println("Skipping initial commands with --no-exec")
+		return nil
+	}
+	ctx = withRunID(withNetworkCheck(ctx))
+	if len(config.StartupCommands) > 0 {
+		for _, cmd := range withDefaultTimeout(config.StartupCommands, config.CommandTimeout) {
+			if cmd.RequiresNetwork && !online(ctx) {
+				cycleLogger(ctx).Printf("Skipping startup command while offline: %s", cmd)
+				continue
+			}
+			err := runCommand(ctx, Rule{}, cmd, nil, func(ctx context.Context) error {
+				return executeCommand(ctx, cmd, "")
+			})
+			if err == nil || cmd.Parallel {
+				continue
+			}
+			switch failurePolicy(cmd, config.OnFailure) {
+			case failureContinue:
+				continue
+			case failureExit:
+				return err
+			}
+			cycleLogger(ctx).Printf("Stopping startup due to failure of command: %s", cmd)
+			break
+		}
+		return nil
+	}
+
+	for _, rule := range config.Rules {
+		for _, cmd := range withDefaultContainer(withDefaultTimeout(rule.Commands, config.CommandTimeout), rule.Container) {
+			// Placeholders only make sense for a matched file
+			if cmd.hasPlaceholders() {
+				cycleLogger(ctx).Printf("Skipping initial command with placeholders: %s", cmd)
+				continue
+			}
+			if cmd.RequiresNetwork && !online(ctx) {
+				cycleLogger(ctx).Printf("Skipping initial command while offline: %s", cmd)
+				continue
+			}
+			err := runCommand(ctx, rule, cmd, nil, func(ctx context.Context) error {
+				return executeCommand(ctx, cmd, "")
+			})
+			if err != nil {
+				cycleLogger(ctx).Printf("Initial command failed: %s", cmd)
+				if failurePolicy(cmd, config.OnFailure) == failureExit {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// replaySince runs the rules once for the files matched by the rule
+// patterns that were modified within the window.
+func replaySince(ctx context.Context, config Config, window time.Duration) error {
+	files := recentlyModified(config, time.Now().Add(-window))
+	if len(files) == 0 {
+		logger.Printf("No files modified in the last %s", window)
+		return nil
+	}
+	logger.Printf("Replaying %d files modified in the last %s", len(files), window)
+	_, err := executeRules(ctx, files, config)
+	return err
+}
+
+// recentlyModified returns the files resolved by the rule patterns, or
+// found below resolved directories, that were modified after cutoff.
+func recentlyModified(config Config, cutoff time.Time) []string {
+	var files []string
+	seen := make(map[string]bool)
+	add := func(path string, info os.FileInfo) {
+		if !seen[path] && !info.IsDir() && info.ModTime().After(cutoff) && !isIgnoredFile(path, config) {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+	for _, rule := range config.Rules {
+		ruleConfig := ruleWatchConfig(rule, config)
+		for _, pattern := range rule.Patterns {
+			matches, err := resolvePattern(rulePattern(rule, pattern), ruleConfig)
+			if err != nil {
+				continue
+			}
+			for _, match := range matches {
+				if isIgnoredDir(match, ruleConfig.IgnoreDirs) {
+					continue
+				}
+				_ = filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+					if err != nil {
+						return nil
+					}
+					if info.IsDir() && path != match && isIgnoredDir(path, ruleConfig.IgnoreDirs) {
+						return filepath.SkipDir
+					}
+					add(path, info)
+					return nil
+				})
+			}
+		}
+	}
+	return files
+}
+
+// executeRules runs the commands of every rule matching at least one file
+// of the batch. Each rule runs once per batch, with the matched files
+// exposed to its commands. It reports whether any rule matched, and returns
+// the command error that should terminate go-watch, if any.
+func executeRules(ctx context.Context, files []string, config Config) (bool, error) {
+	reports, err := executeBatch(ctx, ruleBatch{files: files}, config)
+	return len(reports) > 0, err
+}
+
+// executeBatch is executeRules for a batch, running only the rules selected
+// by its filter and subscribed to its operations. It returns a report for
+// every matching rule, including skipped ones.
+func executeBatch(ctx context.Context, batch ruleBatch, config Config) (reports []RunReport, err error) {
+	ctx = withRunID(withNetworkCheck(ctx))
+	if isTrue(config.ProjectSettle) {
+		ctx = withCommandDedup(ctx)
+	}
+	start := time.Now()
+	emit(Event{Kind: CycleStarted, Time: start, RunID: runID(ctx), Files: batch.files})
+	defer func() {
+		failed := err != nil
+		for _, report := range reports {
+			failed = failed || report.Failed()
+		}
+		emit(Event{Kind: CycleFinished, RunID: runID(ctx), Files: batch.files, Duration: time.Since(start), Failed: failed})
+	}()
+	rules := withDefaultEvents(config.Rules, config.Events)
+	if batch.filter != nil {
+		rules = selectRules(rules, batch.filter)
+	}
+	parallel := isTrue(config.RulesParallel)
+	ordered, sortErr := sortRules(rules)
+	if sortErr != nil {
+		cycleLogger(ctx).Printf("Failed to order rules, using configuration order: %v", sortErr)
+		ordered = rules
+		// Waiting for the needs of rules in a cycle would never end
+		parallel = false
+	}
+	schedule := jitterSchedule(start, len(ordered), config)
+	if parallel {
+		return executeRulesParallel(ctx, ordered, batch, config, schedule)
+	}
+
+	// failed holds rules that failed or were skipped, so their dependents
+	// are skipped as well.
+	failed := make(map[string]bool)
+	for i, rule := range ordered {
+		report, err := executeRule(ctx, rule, batch, config, failed, schedule[i])
+		if report == nil {
+			continue
+		}
+		reports = append(reports, *report)
+		if err != nil {
+			return reports, err
+		}
+		if rule.Name != "" && (report.Skipped || report.Failed()) {
+			failed[rule.Name] = true
+		}
+	}
+	return reports, nil
+}
+
+// executeRule runs a rule of executeBatch for the files of the batch it
+// matches. failed holds the rules that failed or were skipped, so a rule
+// needing one of them is skipped. With debounce_jitter, the rule waits until
+// runAt before running. The report is nil when the rule does not run for the
+// batch.
+func executeRule(ctx context.Context, rule Rule, batch ruleBatch, config Config, failed map[string]bool, runAt time.Time) (*RunReport, error) {
+	matched, matchedPattern := matchFiles(rule, withoutIgnoredDirs(rule, filesForEvents(rule, batch), config))
+	matched, young, wait := statFilter(rule, matched)
+	if len(young) > 0 {
+		holdBack(rule, ruleBatch{files: young, ops: batch.ops}, wait)
+	}
+	matched = contentTypeFilter(rule, matched)
+	if len(matched) == 0 {
+		return nil, nil
+	}
+	if active, wait := activeAt(rule, now()); !active {
+		if rule.OutsideHours == outsideHoursQueue {
+			queueOutsideHours(rule, ruleBatch{files: matched, ops: batch.ops}, wait)
+		} else {
+			logAt(cycleLogger(ctx), rule.LogLevel, "Ignoring changes outside the active hours of rule %s", rule.Name)
+		}
+		return nil, nil
+	}
+	if rule.OutsideHours == outsideHoursQueue {
+		matched = takeQueued(rule, matched)
+	}
+	if *noExec {
+		reportMatch(matchOutput, rule, matchedPattern, matched)
+		return &RunReport{Rule: rule.Name, RunID: runID(ctx), Patterns: rule.Patterns, Files: matched}, nil
+	}
+
+	if need := failedNeed(rule, failed); need != "" {
+		cycleLogger(ctx).Printf("Skipping rule %s because %s failed", rule.Name, need)
+		return &RunReport{Rule: rule.Name, RunID: runID(ctx), Patterns: rule.Patterns, Files: matched, Skipped: true}, nil
+	}
+
+	var inputs string
+	if rule.SkipUnchanged {
+		inputs = inputHash(matched, config)
+		if unchangedInputs(rule, inputs) {
+			logAt(cycleLogger(ctx), rule.LogLevel, "Skipping rule %s, its files are unchanged since it last succeeded", rule.Name)
+			return nil, nil
+		}
+	}
+
+	if !runAt.IsZero() && !waitJitter(ctx, runAt) {
+		return nil, nil
+	}
+	rule.Commands = withDefaultContainer(withDefaultTimeout(rule.Commands, config.CommandTimeout), rule.Container)
+	report, err := runRule(ctx, rule, matched, matchedPattern, config.OnFailure)
+	if rule.SkipUnchanged && err == nil && !report.Failed() {
+		recordInputs(rule, inputs)
+	}
+	if config.WebhookURL != "" {
+		sendWebhook(config, report)
+	}
+	return &report, err
+}
+
+// ruleBatch is a set of changes handed to the rules selected by filter, or
+// to every rule when filter is nil. ops holds the operations seen for each
+// file; files without ops match rules of every event kind.
+type ruleBatch struct {
+	files  []string
+	ops    map[string]fsnotify.Op
+	filter func(Rule) bool
+}
+
+// eventOps maps the names accepted by a rule's events to fsnotify ops.
+var eventOps = map[string]fsnotify.Op{
+	"create": fsnotify.Create,
+	"write":  fsnotify.Write,
+	"remove": fsnotify.Remove,
+	"rename": fsnotify.Rename,
+	"chmod":  fsnotify.Chmod,
+}
+
+// filesForEvents returns the files of the batch with an operation the rule
+// subscribes to.
+func filesForEvents(rule Rule, batch ruleBatch) []string {
+	if len(rule.Events) == 0 {
+		return batch.files
+	}
+	var files []string
+	for _, file := range batch.files {
+		op, ok := batch.ops[file]
+		if !ok {
+			files = append(files, file)
+			continue
+		}
+		for _, event := range rule.Events {
+			if op.Has(eventOps[event]) {
+				files = append(files, file)
+				break
+			}
+		}
+	}
+	return files
+}
+
+// withDefaultEvents returns the rules with the given events set on those
+// without their own.
+func withDefaultEvents(rules []Rule, events []string) []Rule {
+	if len(events) == 0 {
+		return rules
+	}
+	resolved := make([]Rule, len(rules))
+	for i, rule := range rules {
+		if len(rule.Events) == 0 {
+			rule.Events = events
+		}
+		resolved[i] = rule
+	}
+	return resolved
+}
+
+// subscribed reports whether any of the rules reacts to the operation.
+func subscribed(rules []Rule, op fsnotify.Op) bool {
+	for _, rule := range rules {
+		if len(rule.Events) == 0 {
+			return true
+		}
+		for _, event := range rule.Events {
+			if op.Has(eventOps[event]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func noDebounce(rule Rule) bool {
+	return rule.NoDebounce
+}
+
+func debounced(rule Rule) bool {
+	return !rule.NoDebounce
+}
+
+// selectRules returns the rules keep reports true for.
+func selectRules(rules []Rule, keep func(Rule) bool) []Rule {
+	var selected []Rule
+	for _, rule := range rules {
+		if keep(rule) {
+			selected = append(selected, rule)
+		}
+	}
+	return selected
+}
+
+// matchesAnyRule reports whether a rule selected by keep matches the path.
+func matchesAnyRule(rules []Rule, path string, keep func(Rule) bool) bool {
+	for _, rule := range selectRules(rules, keep) {
+		if matched, _ := matchFiles(rule, []string{path}); len(matched) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// withDefaultTimeout returns the commands with the global timeout set on
+// those without their own.
+func withDefaultTimeout(cmds []Command, timeout string) []Command {
+	if timeout == "" {
+		return cmds
+	}
+	resolved := make([]Command, len(cmds))
+	for i, cmd := range cmds {
+		if cmd.Timeout == "" {
+			cmd.Timeout = timeout
+		}
+		resolved[i] = cmd
+	}
+	return resolved
+}
+
+// failedNeed returns the first rule the given rule needs that failed.
+func failedNeed(rule Rule, failed map[string]bool) string {
+	for _, need := range rule.Needs {
+		if failed[need] {
+			return need
+		}
+	}
+	return ""
+}
+
+// sortRules orders rules so every rule comes after the rules it needs,
+// keeping the configuration order otherwise. The sort is stable, so rules
+// run in the same order on every change. Needs naming unknown rules
+// are ignored; a dependency cycle is an error.
+func sortRules(rules []Rule) ([]Rule, error) {
+	index := make(map[string]int)
+	for i, rule := range rules {
+		if rule.Name != "" {
+			index[rule.Name] = i
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(rules))
+	ordered := make([]Rule, 0, len(rules))
+	var visit func(i int, path []string) error
+	visit = func(i int, path []string) error {
+		switch state[i] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("rule dependency cycle: %s", strings.Join(append(path, rules[i].Name), " -> "))
+		}
+		state[i] = visiting
+		for _, need := range rules[i].Needs {
+			if j, ok := index[need]; ok {
+				if err := visit(j, append(path, rules[i].Name)); err != nil {
+					return err
+				}
+			}
+		}
+		state[i] = done
+		ordered = append(ordered, rules[i])
+		return nil
+	}
+	for i := range rules {
+		if err := visit(i, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// matchFiles returns the files matched by any of the rule's patterns or
+// lying under one of its watch_dirs, and the first pattern or directory
+// that matched, joined with the rule root.
+func matchFiles(rule Rule, files []string) ([]string, string) {
+	var matched []string
+	var matchedPattern string
+files:
+	for _, file := range files {
+		for _, pattern := range rule.Patterns {
+			if matchPattern(rule, pattern, file) {
+				if matchedPattern == "" {
+					matchedPattern = rulePattern(rule, pattern)
+				}
+				matched = append(matched, file)
+				continue files
+			}
+		}
+		if dir, ok := matchWatchDir(rule, file); ok {
+			if matchedPattern == "" {
+				matchedPattern = dir
+			}
+			matched = append(matched, file)
+		}
+	}
+	return matched, matchedPattern
+}
+
+// matchPattern matches a changed path against a rule pattern. A pattern
+// starting with "./" is anchored at the rule root, or the working directory
+// without one. Absolute paths match by absolute path, even outside the rule
+// root and the working directory. As in .gitignore, other patterns without
+// a "/" also match the file name at any depth, so "main.go" matches
+// "cmd/main.go".
+func matchPattern(rule Rule, pattern, file string) bool {
+	if anchored, ok := anchoredPattern(pattern); ok {
+		root := rule.Root
+		if root == "" {
+			root = "."
+		}
+		rel, ok := withinDir(root, file)
+		return ok && compiledPattern(stripCaptures(anchored)).Match(filepath.ToSlash(rel))
+	}
+	g := compiledPattern(stripCaptures(pattern))
+	if filepath.IsAbs(pattern) {
+		if g.Match(file) {
+			return true
+		}
+		abs, err := filepath.Abs(file)
+		return err == nil && g.Match(abs)
+	}
+	if matchRulePath(rule, g, file) {
+		return true
+	}
+	if strings.Contains(pattern, "/") {
+		return false
+	}
+	if rule.Root != "" {
+		if _, ok := withinDir(rule.Root, file); !ok {
+			return false
+		}
+	}
+	return g.Match(filepath.Base(file))
+}
+
+// anchoredPattern reports whether a pattern is anchored with a leading "./"
+// and returns it relative to the root.
+func anchoredPattern(pattern string) (string, bool) {
+	rel, ok := strings.CutPrefix(pattern, "./")
+	return rel, ok && rel != ""
+}
+
+// matchRulePath matches a changed path against a compiled rule pattern.
+// For rules with a root, the path is matched relative to that root and
+// paths outside of it never match.
+func matchRulePath(rule Rule, g glob.Glob, file string) bool {
+	if rule.Root == "" {
+		return g.Match(file)
+	}
+	rel, ok := withinDir(rule.Root, file)
+	return ok && g.Match(filepath.ToSlash(rel))
+}
+
+// patternMatcher is a compiled rule pattern. Before running the glob, it
+// rejects paths not starting with the pattern's literal prefix or not
+// ending with its literal suffix, which is how most changes fail to match.
+type patternMatcher struct {
+	prefix string
+	suffix string
+	glob   glob.Glob
+}
+
+// mayMatch runs the cheap prefix and suffix checks.
+func (m *patternMatcher) mayMatch(path string) bool {
+	return strings.HasPrefix(path, m.prefix) && strings.HasSuffix(path, m.suffix)
+}
+
+func (m *patternMatcher) Match(path string) bool {
+	return m.mayMatch(path) && m.glob.Match(path)
+}
+
+var (
+	// patternMatchers caches compiled rule patterns. Guarded by
+	// patternMatchersMu.
+	patternMatchers   = make(map[string]*patternMatcher)
+	patternMatchersMu sync.Mutex
+)
+
+// compiledPattern returns the cached matcher for a glob pattern, compiling
+// it on first use. The pattern must be valid.
+func compiledPattern(pattern string) *patternMatcher {
+	patternMatchersMu.Lock()
+	defer patternMatchersMu.Unlock()
+	if m, ok := patternMatchers[pattern]; ok {
+		return m
+	}
+	m := &patternMatcher{glob: glob.MustCompile(pattern, '/')}
+	// Escapes make the literal parts ambiguous, so only the glob is used
+	if !strings.Contains(pattern, `\`) {
+		if i := strings.IndexAny(pattern, "*?[{"); i >= 0 {
+			m.prefix = pattern[:i]
+			m.suffix = pattern[strings.LastIndexAny(pattern, "*?]}")+1:]
+		} else {
+			m.prefix = pattern
+			m.suffix = pattern
+		}
+	}
+	patternMatchers[pattern] = m
+	return m
+}
+
+// rulePattern resolves a rule pattern against the rule root. Anchored
+// patterns lose their leading "./", and absolute paths are kept as they are.
+func rulePattern(rule Rule, pattern string) string {
+	if anchored, ok := anchoredPattern(pattern); ok {
+		pattern = anchored
+	}
+	if rule.Root == "" || filepath.IsAbs(pattern) {
+		return pattern
+	}
+	return filepath.Join(rule.Root, pattern)
+}
+
+// runRule runs the commands of a rule for its matched files and reports the
+// outcome of each command. A failed command is handled by its on_failure
+// policy, falling back to onFailure; with "exit" the command error is
+// returned.
+func runRule(ctx context.Context, rule Rule, matched []string, matchedPattern string, onFailure string) (RunReport, error) {
+	id := runID(ctx)
+	report := RunReport{
+		Rule:     rule.Name,
+		RunID:    id,
+		Patterns: rule.Patterns,
+		Files:    matched,
+	}
+	start := time.Now()
+	emit(Event{Kind: RuleStarted, Time: start, RunID: id, Rule: rule.Name, LogLevel: rule.LogLevel, Files: matched})
+	var fatal error
+
+	for _, cmd := range rule.Commands {
+		cmdFiles := filterExt(cmd.FilterExt, matched)
+		if len(cmdFiles) == 0 {
+			logAt(cycleLogger(ctx), rule.LogLevel, "No files for command after filtering: %s", cmd)
+			continue
+		}
+		quietKey := cmd.String()
+		if inQuietPeriod(quietKey) {
+			logAt(cycleLogger(ctx), rule.LogLevel, "Ignoring change during quiet period of command: %s", cmd)
+			continue
+		}
+		if cmd.RequiresNetwork && !online(ctx) {
+			cycleLogger(ctx).Printf("Skipping command while offline: %s", cmd)
+			continue
+		}
+		data := newMatchData(cmdFiles[0], matchedPattern)
+		data.Files = cmdFiles
+		data.RunID = id
+		if usesManifest(cmd) {
+			manifest, err := writeManifest(cmdFiles)
+			if err != nil {
+				cycleLogger(ctx).Printf("Failed to write manifest for command: %s, Error: %v", cmd, err)
+				break
+			}
+			data.Manifest = manifest
+			cmd.manifest = manifest
+		}
+		cmd, err := renderCommandFields(cmd, data)
+		if err == nil {
+			cmd.env, err = renderEnv(rule.Env, data)
+		}
+		if err != nil {
+			removeManifest(cmd)
+			cycleLogger(ctx).Printf("Failed to render command: %s, Error: %v", cmd, err)
+			break
+		}
+		if cmd.SkipIfRunning && isRunning(cmd.String()) {
+			removeManifest(cmd)
+			logAt(cycleLogger(ctx), rule.LogLevel, "Skipping command, it is still running: %s", cmd)
+			continue
+		}
+		if alreadyStarted(ctx, cmd) {
+			removeManifest(cmd)
+			logAt(cycleLogger(ctx), rule.LogLevel, "Skipping command, another rule ran it for these changes: %s", cmd)
+			continue
+		}
+		cmdStart := time.Now()
+		startQuietPeriod(quietKey, cmd, cmdStart)
+		err = runCommand(ctx, rule, cmd, cmdFiles, func(ctx context.Context) error {
+			return executeWithRetries(ctx, cmd, data.Match)
+		})
+		report.Commands = append(report.Commands, newCommandResult(cmd, err, time.Since(cmdStart)))
+		if err == nil || cmd.Parallel {
+			continue
+		}
+		policy := failurePolicy(cmd, onFailure)
+		if policy == failureContinue {
+			continue
+		}
+		if policy == failureExit {
+			fatal = err
+		}
+		cycleLogger(ctx).Printf("Stopping execution due to failure of command: %s", cmd)
+		break
+	}
+	report.DurationMs = time.Since(start).Milliseconds()
+	emit(Event{Kind: RuleFinished, RunID: id, Rule: rule.Name, LogLevel: rule.LogLevel, Files: matched, Duration: time.Since(start), Failed: report.Failed()})
+	return report, fatal
+}
+
+// runCommand runs a command of rule for files, enclosed in CommandStarted
+// and CommandFinished events. The CommandFinished of a parallel command is
+// emitted once its process exited.
+func runCommand(ctx context.Context, rule Rule, cmd Command, files []string, run func(context.Context) error) error {
+	id := runID(ctx)
+	start := time.Now()
+	emit(Event{Kind: CommandStarted, Time: start, RunID: id, Rule: rule.Name, LogLevel: rule.LogLevel, Files: files, Command: cmd.String(), CommandName: cmd.Name})
+	finished := func(err error) {
+		result := newCommandResult(cmd, err, time.Since(start))
+		emit(Event{
+			Kind:        CommandFinished,
+			RunID:       id,
+			Rule:        rule.Name,
+			LogLevel:    rule.LogLevel,
+			Files:       files,
+			Command:     result.Cmd,
+			CommandName: cmd.Name,
+			ExitCode:    result.ExitCode,
+			Duration:    time.Since(start),
+			Failed:      err != nil,
+		})
+	}
+	if cmd.Parallel {
+		ctx = withCommandDone(ctx, finished)
+	}
+	err := run(ctx)
+	// A parallel command failing to start never runs in the background
+	if !cmd.Parallel || err != nil {
+		finished(err)
+	}
+	return err
+}
+
+func validFailurePolicy(policy string) bool {
+	switch policy {
+	case "", failureContinue, failureStopRule, failureExit:
+		return true
+	}
+	return false
+}
+
+// failurePolicy returns the on_failure policy for a command.
+func failurePolicy(cmd Command, defaultPolicy string) string {
+	if cmd.OnFailure != "" {
+		return cmd.OnFailure
+	}
+	if defaultPolicy != "" {
+		return defaultPolicy
+	}
+	return failureStopRule
+}
+
+// startQuietPeriod records the launch of a command with a quiet period, so
+// changes caused by the (re)started process itself do not trigger it again.
+func startQuietPeriod(key string, cmd Command, launched time.Time) {
+	if cmd.QuietPeriod == "" {
+		return
+	}
+	period, err := time.ParseDuration(cmd.QuietPeriod)
+	if err != nil {
+		logger.Printf("Invalid quiet period for command: %s, Error: %v", cmd, err)
+		return
+	}
+	quietUntilMu.Lock()
+	quietUntil[key] = launched.Add(period)
+	quietUntilMu.Unlock()
+}
+
+// inQuietPeriod reports whether the command was launched too recently to
+// be triggered again.
+func inQuietPeriod(key string) bool {
+	quietUntilMu.Lock()
+	defer quietUntilMu.Unlock()
+	return time.Now().Before(quietUntil[key])
+}
+
+// FileList is a list of paths that renders space-separated in templates.
+type FileList []string
+
+func (f FileList) String() string {
+	return strings.Join(f, " ")
+}
+
+// filterExt keeps the files whose name ends with one of exts, with or
+// without the leading dot, so ".d.ts" keeps "types.d.ts" but not
+// "index.ts". An empty exts keeps every file.
+func filterExt(exts []string, files []string) FileList {
+	if len(exts) == 0 {
+		return files
+	}
+	var filtered FileList
+	for _, file := range files {
+		base := filepath.Base(file)
+		for _, want := range exts {
+			if want = "." + strings.TrimPrefix(want, "."); want != "." && strings.HasSuffix(base, want) {
+				filtered = append(filtered, file)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// MatchData holds the path components of a matched file that are exposed
+// to command templates, e.g. "protoc {{.Rel}}".
+type MatchData struct {
+	Match   string // The matched path as reported by the watcher
+	File    string // Path relative to the working directory when inside it
+	AbsFile string // Absolute path of the matched file
+	Dir     string // Directory of the matched path
+	Base    string // File name of the matched path
+	Ext     string // Extension of the matched path, including the dot
+	Rel     string // Path relative to the literal prefix of the pattern
+	// PathSegments are the elements of File, e.g. ["services", "api",
+	// "main.go"]; {{index .PathSegments 1}} is "api".
+	PathSegments []string
+	Files        FileList          // All files of the batch matched by the rule
+	Mode         string            // Permission bits of the matched file in octal (e.g. 0644), empty if it is gone
+	Captures     []string          // The matched path, then the segments captured by the pattern's (...) groups ({{.1}}, ...)
+	Named        map[string]string // The captured segments by group name ({{.Named.name}})
+	Manifest     string            // Temporary file listing Files, one per line; only written for commands using it
+	RunID        string            // Identifier shared by every command run for the same batch of changes
+}
+
+var templateFuncs = template.FuncMap{
+	// ext filters a file list by extension: {{.Files | ext ".go"}}
+	"ext": func(ext string, files FileList) FileList {
+		return filterExt([]string{ext}, files)
+	},
+	// shellquote quotes a value for the shell; file lists are quoted per
+	// file. It is applied to every placeholder unless substitution is raw.
+	"shellquote": shellQuoteValue,
+}
+
+func newMatchData(filePath, pattern string) MatchData {
+	data := MatchData{
+		Match:   filePath,
+		File:    filePath,
+		AbsFile: filePath,
+		Dir:     filepath.Dir(filePath),
+		Base:    filepath.Base(filePath),
+		Ext:     filepath.Ext(filePath),
+		Rel:     filePath,
+	}
+	// Relative paths from the watcher are relative to the working directory,
+	// which --cwd has already switched to.
+	if abs, err := filepath.Abs(filePath); err == nil {
+		data.AbsFile = abs
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, abs); err == nil && !strings.HasPrefix(rel, "..") {
+				data.File = rel
+			}
+		}
+	}
+	if root := patternRoot(pattern); root != "" {
+		if rel, err := filepath.Rel(root, filePath); err == nil && !strings.HasPrefix(rel, "..") {
+			data.Rel = rel
+		}
+	}
+	data.PathSegments = strings.Split(filepath.ToSlash(data.File), "/")
+	if info, err := os.Stat(filePath); err == nil {
+		data.Mode = fmt.Sprintf("%04o", info.Mode().Perm())
+	}
+	if hasCaptures(pattern) {
+		data.Captures, data.Named = matchCaptures(pattern, data.Match, data.File, data.AbsFile)
+	}
+	return data
+}
+
+// patternRoot returns the leading directories of a pattern that contain no
+// glob metacharacters, e.g. "src" for "src/**/*.proto".
+func patternRoot(pattern string) string {
+	var root []string
+	parts := strings.Split(filepath.ToSlash(pattern), "/")
+	for _, part := range parts[:len(parts)-1] {
+		if strings.ContainsAny(part, "*?[{") {
+			break
+		}
+		root = append(root, part)
+	}
+	return filepath.FromSlash(strings.Join(root, "/"))
+}
+
+// renderCommandFields returns the command with placeholders expanded in its
+// command string or arguments.
+func renderCommandFields(cmd Command, data MatchData) (Command, error) {
+	render := renderCommand
+	if cmd.Substitution == substitutionRaw {
+		render = renderRaw
+	}
+	rendered, err := render(cmd.Cmd, data)
+	if err != nil {
+		return cmd, err
+	}
+	args := make([]string, len(cmd.Args))
+	for i, arg := range cmd.Args {
+		if args[i], err = renderRaw(arg, data); err != nil {
+			return cmd, err
+		}
+	}
+	cmd.Cmd = rendered
+	if len(args) > 0 {
+		cmd.Args = args
+	}
+	return cmd, nil
+}
+
+// renderEnv renders the values of a rule's env as KEY=value, sorted by key.
+// Values are not shell-quoted.
+func renderEnv(env map[string]string, data MatchData) ([]string, error) {
+	var rendered []string
+	for _, key := range slices.Sorted(maps.Keys(env)) {
+		value, err := renderRaw(env[key], data)
+		if err != nil {
+			return nil, fmt.Errorf("env %s: %w", key, err)
+		}
+		rendered = append(rendered, key+"="+value)
+	}
+	return rendered, nil
+}
+
+// renderCommand expands template placeholders in a shell command string,
+// shell-quoting the value of each placeholder. Commands without
+// placeholders are returned unchanged.
+func renderCommand(cmdStr string, data MatchData) (string, error) {
+	return renderTemplate(cmdStr, data, true)
+}
+
+// renderRaw expands template placeholders without quoting their values.
+func renderRaw(cmdStr string, data MatchData) (string, error) {
+	return renderTemplate(cmdStr, data, false)
+}
+
+func renderTemplate(cmdStr string, data MatchData, quote bool) (string, error) {
+	if !strings.Contains(cmdStr, "{{") {
+		return cmdStr, nil
+	}
+	cmdStr = capturePlaceholder.ReplaceAllString(cmdStr, "{{index .Captures $1}}")
+	tmpl, err := template.New("cmd").Funcs(templateFuncs).Option("missingkey=error").Parse(cmdStr)
+	if err != nil {
+		return "", err
+	}
+	if quote {
+		quoteActions(tmpl.Tree.Root)
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// executeCommand runs a command, returning a *CommandError if it fails.
+// Parallel commands run in the background and always return nil. The
+// command is terminated when ctx is cancelled. A non-empty file is exposed
+// to the command as GO_WATCH_FILE.
+func executeCommand(ctx context.Context, cmd Command, file string) error {
+	name := cmd.String()
+
+	// Terminate any existing process for the command
+	stopProcess(name)
+
+	if cmd.ConcurrencyKey != "" {
+		unkeyed := cmd
+		unkeyed.ConcurrencyKey = ""
+		if cmd.Parallel {
+			unkeyed.Parallel = false
+			runInBackground(ctx, name, func() error {
+				defer lockConcurrencyKey(cmd.ConcurrencyKey)()
+				return executeCommand(ctx, unkeyed, file)
+			})
+			return nil
+		}
+		defer lockConcurrencyKey(cmd.ConcurrencyKey)()
+		return executeCommand(ctx, unkeyed, file)
+	}
+
+	// The timeout is released once the command has been waited for, which
+	// for parallel commands happens in the background.
+	cancelTimeout := func() {}
+	var timeout time.Duration
+	if cmd.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(cmd.Timeout); err != nil || timeout <= 0 {
+			return newCommandError(name, fmt.Errorf("invalid timeout %q: must be a positive duration", cmd.Timeout))
+		}
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+	}
+
+	var extraEnv []string
+	if file != "" {
+		extraEnv = append(extraEnv, "GO_WATCH_FILE="+file)
+	}
+	if id := runID(ctx); id != "" {
+		extraEnv = append(extraEnv, "GOWATCH_RUN_ID="+id)
+	}
+	extraEnv = append(extraEnv, cmd.env...)
+
+	var command *exec.Cmd
+	if cmd.Container != "" {
+		// The container gets the go-watch variables from the runtime's
+		// environment
+		dir, err := os.Getwd()
+		if err != nil {
+			cancelTimeout()
+			return newCommandError(name, err)
+		}
+		args := newContainerRunner().Invocation(cmd.Container, dir, containerScript(cmd), envNames(extraEnv))
+		command = exec.CommandContext(ctx, args[0], args[1:]...)
+	} else if len(cmd.Args) > 0 {
+		// Run the arguments directly, without a shell
+		command = exec.CommandContext(ctx, cmd.Args[0], cmd.Args[1:]...)
+	} else {
+		shellArgs := strings.Split(*shell, " ")
+		command = exec.CommandContext(ctx, shellArgs[0], append(shellArgs[1:], name)...)
+	}
+	// The command and the processes it spawns are stopped together, then
+	// killed together once they had stopTimeout to exit. Once the command
+	// exited, its process group ID may be reused, so nothing is killed.
+	stopSignal, stopTimeout := stopSettings(cmd)
+	exited := make(chan struct{})
+	command.Cancel = func() error {
+		go func() {
+			timer := time.NewTimer(stopTimeout)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				_ = killGroup(command)
+			case <-exited:
+			}
+		}()
+		return signalGroup(command, stopSignal)
+	}
+	command.WaitDelay = stopTimeout
+	command.Stdout, command.Stderr = commandOutput()
+	var outputFiles []*os.File
+	// closeOutputs runs once the command is done with its files, including
+	// the manifest.
+	closeOutputs := func() {
+		for _, f := range outputFiles {
+			f.Close()
+		}
+		removeManifest(cmd)
+	}
+	for _, out := range []struct {
+		path   string
+		stream *io.Writer
+	}{
+		{cmd.StdoutFile, &command.Stdout},
+		{cmd.StderrFile, &command.Stderr},
+	} {
+		if out.path == "" {
+			continue
+		}
+		f, err := openOutputFile(out.path, cmd.OutputMode)
+		if err != nil {
+			closeOutputs()
+			cancelTimeout()
+			cycleLogger(ctx).Printf("Failed to open output file for command: %s, Error: %v", name, err)
+			return newCommandError(name, err)
+		}
+		outputFiles = append(outputFiles, f)
+		*out.stream = f
+	}
+	if *prefixTimes {
+		command.Stdout = newTimestampWriter(command.Stdout, *timeFormat)
+		command.Stderr = newTimestampWriter(command.Stderr, *timeFormat)
+	}
+	var captured bytes.Buffer
+	if cmd.WatchOutput {
+		command.Stdout = io.MultiWriter(command.Stdout, &captured)
+	}
+	var combined outputBuffer
+	if cmd.SuccessPattern != "" || cmd.FailurePattern != "" || cmd.OutputParser != "" {
+		command.Stdout = io.MultiWriter(command.Stdout, &combined)
+		command.Stderr = io.MultiWriter(command.Stderr, &combined)
+	}
+	var activity chan struct{}
+	if cmd.IdleWarning != "" {
+		activity = make(chan struct{}, 1)
+		command.Stdout = activityWriter{command.Stdout, activity}
+		command.Stderr = activityWriter{command.Stderr, activity}
+	}
+	command.Env = append(os.Environ(), extraEnv...)
+
+	releasePTY := func() {}
+	var err error
+	if cmd.PTY {
+		releasePTY, err = startPTY(command, command.Stdout)
+	} else {
+		newProcessGroup(command)
+		err = command.Start()
+	}
+	if err != nil {
+		closeOutputs()
+		cancelTimeout()
+		cycleLogger(ctx).Printf("Command failed: %s, Error: %v", name, err)
+		return newCommandError(name, err)
+	}
+	proc := &runningProcess{cmd: command, done: make(chan struct{}), stopSignal: stopSignal, stopTimeout: stopTimeout}
+	cmdProcessesMu.Lock()
+	cmdProcesses[name] = proc
+	cmdProcessesMu.Unlock()
+	if activity != nil {
+		idle, _ := time.ParseDuration(cmd.IdleWarning)
+		go warnIdleOutput(cycleLogger(ctx), name, idle, activity, proc.done)
+	}
+
+	wait := func() error {
+		defer closeOutputs()
+		err := command.Wait()
+		close(exited)
+		releasePTY()
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s: %w", timeout, err)
+		}
+		cancelTimeout()
+		if cmd.SuccessPattern != "" || cmd.FailurePattern != "" {
+			err = checkOutput(cmd, combined.String(), err)
+		}
+		if cmd.OutputParser != "" {
+			if summary, ok := parseTestOutput(cmd.OutputParser, combined.String()); ok {
+				emit(Event{Kind: TestsSummarized, RunID: runID(ctx), Command: name, CommandName: cmd.Name, Tests: &summary})
+			}
+		}
+		if err == nil && cmd.WatchOutput {
+			watchCommandOutput(captured.String())
+		}
+		close(proc.done)
+		cmdProcessesMu.Lock()
+		if cmdProcesses[name] == proc {
+			delete(cmdProcesses, name)
+		}
+		cmdProcessesMu.Unlock()
+		return err
+	}
+
+	if cmd.Parallel {
+		runInBackground(ctx, name, func() error {
+			if err := wait(); err != nil {
+				cycleLogger(ctx).Printf("Command failed: %s, Error: %v", name, err)
+				cmdErr := newCommandError(name, err)
+				cmdErr.ExitCode = command.ProcessState.ExitCode()
+				return cmdErr
+			}
+			return nil
+		})
+		return nil
+	}
+	if err := wait(); err != nil {
+		cycleLogger(ctx).Printf("Command failed: %s, Error: %v", name, err)
+		cmdErr := newCommandError(name, err)
+		cmdErr.ExitCode = command.ProcessState.ExitCode()
+		return cmdErr
+	}
+	return nil
+}
+
+// commandOutput returns the writers of command output.
+func commandOutput() (stdout, stderr io.Writer) {
+	commandOutputMu.Lock()
+	defer commandOutputMu.Unlock()
+	return commandStdout, commandStderr
+}
+
+// setCommandOutput sets the writers of command output.
+func setCommandOutput(stdout, stderr io.Writer) {
+	commandOutputMu.Lock()
+	defer commandOutputMu.Unlock()
+	commandStdout, commandStderr = stdout, stderr
+}
+
+// runInBackground runs the rest of a parallel command in the background,
+// tracked by runningCommands and enclosed in BackgroundStarted and
+// BackgroundFinished events. Once run returns, the error is handed to the
+// function set by withCommandDone, if any.
+func runInBackground(ctx context.Context, name string, run func() error) {
+	runningCommands.Add(1)
+	emit(Event{Kind: BackgroundStarted, Time: time.Now(), RunID: runID(ctx), Command: name})
+	go func() {
+		defer runningCommands.Done()
+		start := time.Now()
+		err := run()
+		if done, ok := ctx.Value(commandDoneKey{}).(func(error)); ok {
+			done(err)
+		}
+		emit(Event{Kind: BackgroundFinished, RunID: runID(ctx), Command: name, Duration: time.Since(start), Failed: err != nil})
+	}()
+}
+
+type commandDoneKey struct{}
+
+// withCommandDone returns a context telling runInBackground to call done
+// with the outcome of a parallel command once it exited.
+func withCommandDone(ctx context.Context, done func(error)) context.Context {
+	return context.WithValue(ctx, commandDoneKey{}, done)
+}
+
+// lockConcurrencyKey blocks until no other command holds the key and
+// returns a function releasing it.
+func lockConcurrencyKey(key string) func() {
+	concurrencyKeysMu.Lock()
+	mu, ok := concurrencyKeys[key]
+	if !ok {
+		mu = &sync.Mutex{}
+		concurrencyKeys[key] = mu
+	}
+	concurrencyKeysMu.Unlock()
+	mu.Lock()
+	return mu.Unlock
+}
+
+// activityWriter signals on activity whenever output passes through it.
+type activityWriter struct {
+	w        io.Writer
+	activity chan<- struct{}
+}
+
+func (a activityWriter) Write(p []byte) (int, error) {
+	select {
+	case a.activity <- struct{}{}:
+	default:
+	}
+	return a.w.Write(p)
+}
+
+// timestampWriter prefixes each line written through it with the time the
+// line started, in layout.
+type timestampWriter struct {
+	w      io.Writer
+	layout string
+
+	mu      sync.Mutex
+	midLine bool
+}
+
+func newTimestampWriter(w io.Writer, layout string) *timestampWriter {
+	return &timestampWriter{w: w, layout: layout}
+}
+
+func (t *timestampWriter) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []byte
+	for rest := p; len(rest) > 0; {
+		if !t.midLine {
+			out = append(append(out, now().Format(t.layout)...), ' ')
+		}
+		line, tail, found := bytes.Cut(rest, []byte("\n"))
+		out = append(out, line...)
+		if found {
+			out = append(out, '\n')
+		}
+		t.midLine = !found
+		rest = tail
+	}
+	if _, err := t.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// warnIdleOutput logs a warning each time a command has been silent for
+// the idle duration, until done is closed.
+func warnIdleOutput(l *log.Logger, name string, idle time.Duration, activity <-chan struct{}, done <-chan struct{}) {
+	timer := time.NewTimer(idle)
+	defer timer.Stop()
+	for {
+		select {
+		case <-activity:
+			timer.Reset(idle)
+		case <-timer.C:
+			l.Printf("No output from %s for %s, it is still running", name, idle)
+			timer.Reset(idle)
+		case <-done:
+			return
+		}
+	}
+}
+
+// outputBuffer collects a command's stdout and stderr, which exec copies
+// from separate goroutines.
+type outputBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *outputBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// checkOutput applies the command's success and failure patterns to its
+// output. waitErr is the result of waiting for the command; it is kept
+// when no pattern decides the outcome.
+func checkOutput(cmd Command, output string, waitErr error) error {
+	if cmd.FailurePattern != "" {
+		re, err := regexp.Compile(cmd.FailurePattern)
+		if err != nil {
+			return err
+		}
+		if re.MatchString(output) {
+			return fmt.Errorf("output matches failure_pattern %q", cmd.FailurePattern)
+		}
+	}
+	if cmd.SuccessPattern != "" {
+		re, err := regexp.Compile(cmd.SuccessPattern)
+		if err != nil {
+			return err
+		}
+		if !re.MatchString(output) {
+			return fmt.Errorf("output does not match success_pattern %q", cmd.SuccessPattern)
+		}
+		return nil
+	}
+	return waitErr
+}
+
+// watchCommandOutput adds the existing paths printed by a command, one per
+// line, to the watcher. At most maxOutputWatches such paths are watched in
+// total, so a chatty command cannot exhaust watch descriptors.
+func watchCommandOutput(output string) int {
+	added := 0
+	for _, line := range strings.Split(output, "\n") {
+		path := strings.TrimSpace(line)
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if isWatched(path) {
+			continue
+		}
+		if watchedPaths.Count(outputWatchPattern) >= maxOutputWatches {
+			logger.Printf("Not watching more command output paths, limit of %d reached", maxOutputWatches)
+			break
+		}
+		if !watchedPaths.Add(path, outputWatchPattern) {
+			continue
+		}
+		if err := addWatch(path); err != nil {
+			watchedPaths.Remove(path)
+			logger.Printf("Failed to watch file %s: %v", path, err)
+			continue
+		}
+		logger.Printf("Watching command output: %s", path)
+		added++
+	}
+	return added
+}
+
+// isRunning reports whether a process of the command is still running.
+func isRunning(cmdStr string) bool {
+	cmdProcessesMu.Lock()
+	proc, exists := cmdProcesses[cmdStr]
+	cmdProcessesMu.Unlock()
+	if !exists {
+		return false
+	}
+	select {
+	case <-proc.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// stopProcess terminates the running process of a command, if any, and
+// waits for it to exit.
+func stopProcess(cmdStr string) {
+	cmdProcessesMu.Lock()
+	proc, exists := cmdProcesses[cmdStr]
+	cmdProcessesMu.Unlock()
+	if !exists {
+		return
+	}
+	select {
+	case <-proc.done:
+		return
+	default:
+	}
+	logger.Printf("Terminating existing command: %s", cmdStr)
+	if err := signalGroup(proc.cmd, proc.stopSignal); err != nil {
+		logger.Printf("Failed to terminate command: %s, Error: %v", cmdStr, err)
+	}
+	timer := time.NewTimer(proc.stopTimeout)
+	defer timer.Stop()
+	select {
+	case <-proc.done:
+	case <-timer.C:
+		logger.Printf("Command did not exit within %s, killing it: %s", proc.stopTimeout, cmdStr)
+		if err := signalGroup(proc.cmd, syscall.SIGKILL); err != nil {
+			logger.Printf("Failed to kill command: %s, Error: %v", cmdStr, err)
+		}
+		<-proc.done
+	}
+}
+
+// openOutputFile opens a command output file, appending to it unless mode
+// is "truncate".
+func openOutputFile(path, mode string) (*os.File, error) {
+	flags := os.O_CREATE | os.O_WRONLY
+	switch mode {
+	case "", "append":
+		flags |= os.O_APPEND
+	case "truncate":
+		flags |= os.O_TRUNC
+	default:
+		return nil, fmt.Errorf("unsupported output mode %q for %s", mode, path)
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output file: %w", err)
 	}
-	return true
+	return f, nil
 }
@@ -1,14 +1,23 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/gobwas/glob"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"gopkg.in/yaml.v3"
 )
 
 // MockCommand represents a mock implementation of the Command structure
@@ -178,3 +187,2030 @@ func TestAddingNewFiles(t *testing.T) {
 		}
 	}
 }
+
+// Test command placeholders for a nested match
+func TestRenderCommandPlaceholders(t *testing.T) {
+	data := newMatchData("src/api/v1/user.proto", "src/**/*.proto")
+
+	cases := map[string]string{
+		"{{.Match}}": "src/api/v1/user.proto",
+		"{{.Base}}":  "user.proto",
+		"{{.Ext}}":   ".proto",
+		"{{.Rel}}":   "api/v1/user.proto",
+		"{{.Dir}}":   "src/api/v1",
+	}
+	for tmpl, want := range cases {
+		got, err := renderCommand("protoc "+tmpl, data)
+		assert.NoError(t, err)
+		assert.Equal(t, "protoc "+want, got)
+	}
+
+	plain, err := renderCommand("go test ./...", data)
+	assert.NoError(t, err)
+	assert.Equal(t, "go test ./...", plain)
+
+	_, err = renderCommand("echo {{.Unknown}}", data)
+	assert.Error(t, err)
+}
+
+// Test that disabled rules do not fire
+func TestDisabledRules(t *testing.T) {
+	dir := t.TempDir()
+	lintOut := filepath.Join(dir, "lint.txt")
+	testOut := filepath.Join(dir, "test.txt")
+
+	config := Config{
+		Rules: []Rule{
+			{
+				Name:     "lint",
+				Patterns: []string{"*.go"},
+				Commands: []Command{{Cmd: "echo lint > " + lintOut}},
+			},
+			{
+				Name:     "test",
+				Patterns: []string{"*.go"},
+				Commands: []Command{{Cmd: "echo test > " + testOut}},
+			},
+		},
+	}
+
+	config.Rules = enabledRules(config.Rules, []string{"lint"})
+	assert.Len(t, config.Rules, 1)
+
+	executeRules(context.Background(), []string{"main.go"}, config)
+
+	assert.NoFileExists(t, lintOut)
+	assert.FileExists(t, testOut)
+}
+
+// Test that each command receives its filtered subset of a mixed batch
+func TestBatchFileFiltering(t *testing.T) {
+	dir := t.TempDir()
+	fmtOut := filepath.Join(dir, "fmt.txt")
+	cssOut := filepath.Join(dir, "css.txt")
+	allOut := filepath.Join(dir, "all.txt")
+
+	config := Config{
+		Rules: []Rule{
+			{
+				Patterns: []string{"**/*.go", "**/*.css"},
+				Commands: []Command{
+					{Cmd: "echo {{.Files}} > " + fmtOut, FilterExt: []string{".go"}},
+					{Cmd: `echo {{.Files | ext ".css"}} > ` + cssOut},
+					{Cmd: "echo {{.Files}} > " + allOut},
+				},
+			},
+		},
+	}
+
+	executeRules(context.Background(), []string{"pkg/a.go", "web/site.css", "pkg/b.go", "README.md"}, config)
+
+	read := func(path string) string {
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		return strings.TrimSpace(string(data))
+	}
+	assert.Equal(t, "pkg/a.go pkg/b.go", read(fmtOut))
+	assert.Equal(t, "web/site.css", read(cssOut))
+	assert.Equal(t, "pkg/a.go web/site.css pkg/b.go", read(allOut))
+}
+
+// Test merging the user-global configuration under the project config
+func TestGlobalConfigMerge(t *testing.T) {
+	xdg := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	assert.NoError(t, os.MkdirAll(filepath.Join(xdg, "go-watch"), 0755))
+	globalData := []byte(`
+ignore_dirs:
+  - "node_modules"
+  - ".git"
+debounce_time: "2s"
+`)
+	assert.NoError(t, os.WriteFile(filepath.Join(xdg, "go-watch", "config.yaml"), globalData, 0644))
+
+	projectPath := filepath.Join(t.TempDir(), "go-watch.config.yaml")
+	projectData := []byte(`
+ignore_dirs:
+  - "bin"
+  - ".git"
+rules:
+  - patterns:
+      - "*.go"
+    commands:
+      - cmd: "go build"
+`)
+	assert.NoError(t, os.WriteFile(projectPath, projectData, 0644))
+
+	config, err := loadConfig(projectPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"node_modules", ".git", "bin"}, config.IgnoreDirs)
+	assert.Equal(t, "2s", config.DebounceTime)
+	assert.Len(t, config.Rules, 1)
+}
+
+// Test that project settings replace global ones, including switches the
+// global configuration turned on
+func TestMergeConfigOverrides(t *testing.T) {
+	global := Config{
+		NoDefaultIgnores: boolPtr(true),
+		GitTrackedOnly:   boolPtr(true),
+		RulesParallel:    boolPtr(true),
+		ProjectSettle:    boolPtr(true),
+		LogLevel:         "debug",
+	}
+	merged := mergeConfig(global, Config{})
+	assert.Equal(t, global, merged, "unset project settings replaced global ones")
+
+	merged = mergeConfig(global, Config{
+		NoDefaultIgnores: boolPtr(false),
+		GitTrackedOnly:   boolPtr(false),
+		RulesParallel:    boolPtr(false),
+		ProjectSettle:    boolPtr(false),
+		LogLevel:         "info",
+	})
+	assert.False(t, isTrue(merged.NoDefaultIgnores))
+	assert.False(t, isTrue(merged.GitTrackedOnly))
+	assert.False(t, isTrue(merged.RulesParallel))
+	assert.False(t, isTrue(merged.ProjectSettle))
+	assert.Equal(t, "info", merged.LogLevel)
+}
+
+// Test that log_level turns on debug logging
+func TestConfigLogLevel(t *testing.T) {
+	defer setConfig(Config{})
+	config := applyConfigFlags(Config{LogLevel: "debug"})
+	assert.Equal(t, "debug", config.LogLevel)
+	setConfig(config)
+	assert.True(t, debugEnabled())
+
+	setConfig(applyConfigFlags(Config{}))
+	assert.False(t, debugEnabled())
+
+	assert.ErrorContains(t, Config{LogLevel: "verbose"}.Validate(), "log level")
+}
+
+// boolPtr returns a pointer to b, for optional settings.
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// Test that closing stdin triggers shutdown
+func TestWatchStdinClose(t *testing.T) {
+	r, w := io.Pipe()
+	closed := watchStdinClose(r)
+
+	select {
+	case <-closed:
+		t.Fatal("shutdown triggered before stdin was closed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.NoError(t, w.Close())
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("shutdown not triggered after stdin was closed")
+	}
+}
+
+// Test that startup commands run once and not on file changes
+func TestStartupCommands(t *testing.T) {
+	dir := t.TempDir()
+	startupOut := filepath.Join(dir, "startup.txt")
+	ruleOut := filepath.Join(dir, "rule.txt")
+
+	config := Config{
+		StartupCommands: []Command{{Cmd: "echo startup >> " + startupOut}},
+		Rules: []Rule{
+			{
+				Patterns: []string{"*.go"},
+				Commands: []Command{{Cmd: "echo rule >> " + ruleOut}},
+			},
+		},
+	}
+
+	executeInitialCommands(context.Background(), config)
+	assert.FileExists(t, startupOut)
+	assert.NoFileExists(t, ruleOut)
+
+	executeRules(context.Background(), []string{"main.go"}, config)
+	executeRules(context.Background(), []string{"main.go"}, config)
+
+	startup, err := os.ReadFile(startupOut)
+	assert.NoError(t, err)
+	assert.Equal(t, "startup\n", string(startup))
+	rule, err := os.ReadFile(ruleOut)
+	assert.NoError(t, err)
+	assert.Equal(t, "rule\nrule\n", string(rule))
+}
+
+// Test that editor temp files are ignored by default
+func TestIgnoredFiles(t *testing.T) {
+	// Hidden paths are covered by TestIgnoreHidden
+	ignoreHidden := false
+	config := Config{IgnoreHidden: &ignoreHidden}
+	assert.True(t, isIgnoredFile("pkg/.main.go.swp", config))
+	assert.True(t, isIgnoredFile("pkg/4913", config))
+	assert.True(t, isIgnoredFile("pkg/main.go~", config))
+	assert.False(t, isIgnoredFile("pkg/main.go", config))
+
+	config.IgnorePatterns = []string{"*_gen.go"}
+	assert.True(t, isIgnoredFile("pkg/model_gen.go", config))
+	assert.False(t, isIgnoredFile("pkg/model.go", config))
+
+	config.NoDefaultIgnores = boolPtr(true)
+	assert.False(t, isIgnoredFile("pkg/.main.go.swp", config))
+	assert.True(t, isIgnoredFile("pkg/model_gen.go", config))
+}
+
+// Test registering a pattern for a directory that does not exist yet
+func TestLazyRegistration(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	genDir := filepath.Join(t.TempDir(), "gen")
+	config := Config{
+		Rules: []Rule{
+			{
+				Patterns: []string{genDir},
+				Commands: []Command{{Cmd: "true"}},
+			},
+		},
+	}
+
+	unresolved := addPatternsToWatcher(config)
+	assert.Equal(t, []string{genDir}, unresolved)
+
+	assert.NoError(t, os.MkdirAll(genDir, 0755))
+	unresolved = registerPendingPatterns(unresolved, config)
+	assert.Empty(t, unresolved)
+
+	changed := filepath.Join(genDir, "out.go")
+	assert.NoError(t, os.WriteFile(changed, []byte("package gen"), 0644))
+
+	select {
+	case event := <-watcher.Events:
+		assert.Equal(t, changed, event.Name)
+	case <-time.After(2 * time.Second):
+		t.Fatal("change in lazily registered directory not detected")
+	}
+}
+
+// Test that cancelling the context kills a running command
+func TestExecuteCommandCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	start := time.Now()
+
+	go func() {
+		done <- executeCommand(ctx, Command{Cmd: "exec sleep 10"}, "")
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, ErrCommandFailed)
+		assert.Less(t, time.Since(start), 5*time.Second)
+	case <-time.After(5 * time.Second):
+		t.Fatal("command was not killed after cancellation")
+	}
+}
+
+// Test redirecting command output to a file
+func TestCommandOutputFile(t *testing.T) {
+	dir := t.TempDir()
+	stdoutFile := filepath.Join(dir, "server.log")
+
+	cmd := Command{Cmd: "echo hello", StdoutFile: stdoutFile}
+	assert.NoError(t, executeCommand(context.Background(), cmd, ""))
+	assert.NoError(t, executeCommand(context.Background(), cmd, ""))
+	data, err := os.ReadFile(stdoutFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\nhello\n", string(data))
+
+	cmd.OutputMode = "truncate"
+	assert.NoError(t, executeCommand(context.Background(), cmd, ""))
+	data, err = os.ReadFile(stdoutFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", string(data))
+
+	cmd.StdoutFile = filepath.Join(dir, "missing", "server.log")
+	assert.ErrorIs(t, executeCommand(context.Background(), cmd, ""), ErrCommandFailed)
+}
+
+// Test that --max-events stops after the given number of run cycles
+func TestMaxEvents(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	dir := t.TempDir()
+	changed := filepath.Join(dir, "main.go")
+	assert.NoError(t, os.WriteFile(changed, []byte("package main"), 0644))
+	cyclesOut := filepath.Join(t.TempDir(), "cycles.txt")
+
+	config := Config{
+		Rules: []Rule{
+			{
+				Patterns: []string{filepath.Join(dir, "*.go")},
+				Commands: []Command{{Cmd: "echo cycle >> " + cyclesOut}},
+			},
+		},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- watchLoop(context.Background(), config, 50*time.Millisecond, 2)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, os.WriteFile(changed, []byte(fmt.Sprintf("package main // %d", i)), 0644))
+		time.Sleep(300 * time.Millisecond)
+	}
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch loop did not exit after max events")
+	}
+
+	data, err := os.ReadFile(cyclesOut)
+	assert.NoError(t, err)
+	assert.Equal(t, "cycle\ncycle\n", string(data))
+}
+
+// Test swapping the config while events are processed; run with -race
+func TestConcurrentConfigSwap(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "runs.txt")
+	configA := Config{
+		Rules: []Rule{{Patterns: []string{"*.go"}, Commands: []Command{{Cmd: "echo a >> " + out}}}},
+	}
+	configB := Config{
+		IgnorePatterns: []string{"*_gen.go"},
+		Rules:          []Rule{{Patterns: []string{"*.go"}, Commands: []Command{{Cmd: "echo b >> " + out, Parallel: true}}}},
+	}
+	setConfig(configA)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			if i%2 == 0 {
+				setConfig(configB)
+			} else {
+				setConfig(configA)
+			}
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		config := currentConfig()
+		if !isIgnoredFile("main.go", config) {
+			executeRules(context.Background(), []string{"main.go"}, config)
+		}
+	}
+	<-done
+	runningCommands.Wait()
+
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, data)
+}
+
+// Test that a zero debounce runs the rules for every event
+func TestZeroDebounce(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a.go")
+	second := filepath.Join(dir, "b.go")
+	assert.NoError(t, os.WriteFile(first, []byte("package a"), 0644))
+	assert.NoError(t, os.WriteFile(second, []byte("package b"), 0644))
+	out := filepath.Join(t.TempDir(), "runs.txt")
+
+	config := Config{
+		Rules: []Rule{
+			{
+				Patterns: []string{filepath.Join(dir, "*.go")},
+				Commands: []Command{{Cmd: "echo {{.Base}} >> " + out}},
+			},
+		},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- watchLoop(context.Background(), config, 0, 2)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// Two rapid events, each producing a single chmod notification
+	assert.NoError(t, os.Chmod(first, 0600))
+	assert.NoError(t, os.Chmod(second, 0600))
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("rapid events were not both run")
+	}
+
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "a.go\nb.go\n", string(data))
+}
+
+// Test running a command from an argument array without a shell
+func TestCommandArgs(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "file with spaces.txt")
+
+	cmd := Command{Args: []string{"touch", target}}
+	assert.NoError(t, executeCommand(context.Background(), cmd, ""))
+	assert.FileExists(t, target)
+
+	rendered, err := renderCommandFields(Command{Args: []string{"cat", "{{.Match}}"}}, newMatchData(target, "*"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cat", target}, rendered.Args)
+
+	both := Config{Rules: []Rule{{Commands: []Command{{Cmd: "go test", Args: []string{"go", "test"}}}}}}
+	assert.Error(t, both.Validate())
+	assert.NoError(t, Config{Rules: []Rule{{Commands: []Command{cmd}}}}.Validate())
+}
+
+// Test that rules rooted at different subdirectories stay isolated
+func TestRuleRoot(t *testing.T) {
+	dir := t.TempDir()
+	apiOut := filepath.Join(dir, "api.txt")
+	webOut := filepath.Join(dir, "web.txt")
+
+	config := Config{
+		Rules: []Rule{
+			{
+				Name:     "api",
+				Root:     "services/api",
+				Patterns: []string{"*.go"},
+				Commands: []Command{{Cmd: "echo {{.Rel}} >> " + apiOut}},
+			},
+			{
+				Name:     "web",
+				Root:     "services/web",
+				Patterns: []string{"*.go"},
+				Commands: []Command{{Cmd: "echo {{.Rel}} >> " + webOut}},
+			},
+		},
+	}
+
+	executeRules(context.Background(), []string{"services/api/handlers/user.go"}, config)
+	executeRules(context.Background(), []string{"main.go"}, config)
+
+	data, err := os.ReadFile(apiOut)
+	assert.NoError(t, err)
+	assert.Equal(t, "handlers/user.go\n", string(data))
+	assert.NoFileExists(t, webOut)
+
+	matched, pattern := matchFiles(config.Rules[1], []string{"services/web/app.go", "services/api/app.go"})
+	assert.Equal(t, []string{"services/web/app.go"}, matched)
+	assert.Equal(t, filepath.Join("services", "web", "*.go"), pattern)
+}
+
+// Test that changes during a command's quiet period are ignored
+func TestQuietPeriodAfterCommand(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "starts.txt")
+	config := Config{
+		Rules: []Rule{
+			{
+				Patterns: []string{"*"},
+				Commands: []Command{{Cmd: "echo start >> " + out, Parallel: true, QuietPeriod: "300ms"}},
+			},
+		},
+	}
+
+	executeRules(context.Background(), []string{"main.go"}, config)
+	// The server writing its own log right after the restart
+	executeRules(context.Background(), []string{"server.log"}, config)
+	runningCommands.Wait()
+
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "start\n", string(data))
+
+	time.Sleep(400 * time.Millisecond)
+	executeRules(context.Background(), []string{"main.go"}, config)
+	runningCommands.Wait()
+
+	data, err = os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "start\nstart\n", string(data))
+}
+
+// Test ordering rules by their needs and skipping dependents on failure
+func TestRuleNeeds(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "order.txt")
+	chain := func(buildCmd string) Config {
+		return Config{
+			Rules: []Rule{
+				{Name: "test", Needs: []string{"build"}, Patterns: []string{"*.go"}, Commands: []Command{{Cmd: "echo test >> " + out}}},
+				{Name: "build", Needs: []string{"codegen"}, Patterns: []string{"*.go"}, Commands: []Command{{Cmd: buildCmd}}},
+				{Name: "codegen", Patterns: []string{"*.go"}, Commands: []Command{{Cmd: "echo codegen >> " + out}}},
+			},
+		}
+	}
+
+	config := chain("echo build >> " + out)
+	assert.NoError(t, config.Validate())
+	executeRules(context.Background(), []string{"main.go"}, config)
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "codegen\nbuild\ntest\n", string(data))
+
+	assert.NoError(t, os.Remove(out))
+	executeRules(context.Background(), []string{"main.go"}, chain("echo build >> "+out+" && exit 1"))
+	data, err = os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "codegen\nbuild\n", string(data))
+
+	cyclic := chain("true")
+	cyclic.Rules[2].Needs = []string{"test"}
+	assert.ErrorContains(t, cyclic.Validate(), "cycle")
+
+	unknown := chain("true")
+	unknown.Rules[0].Needs = []string{"lint"}
+	assert.ErrorContains(t, unknown.Validate(), "unknown rule")
+}
+
+// Test expanding environment variables in config values
+func TestConfigEnvExpansion(t *testing.T) {
+	srcDir := t.TempDir()
+	t.Setenv("GO_WATCH_SRC", srcDir)
+	assert.NoError(t, os.WriteFile(filepath.Join(srcDir, "main.go"), []byte("package main"), 0644))
+
+	configPath := filepath.Join(t.TempDir(), "go-watch.config.yaml")
+	configData := []byte(`
+ignore_dirs:
+  - "${GO_WATCH_SRC}/vendor"
+ignore_patterns:
+  - "$$literal"
+rules:
+  - patterns:
+      - "${GO_WATCH_SRC}/*.go"
+    commands:
+      - cmd: "echo $HOME"
+`)
+	assert.NoError(t, os.WriteFile(configPath, configData, 0644))
+
+	config, err := loadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(srcDir, "vendor")}, config.IgnoreDirs)
+	assert.Equal(t, []string{"$literal"}, config.IgnorePatterns)
+	assert.Equal(t, filepath.Join(srcDir, "*.go"), config.Rules[0].Patterns[0])
+	assert.Equal(t, "echo $HOME", config.Rules[0].Commands[0].Cmd)
+
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+	assert.Empty(t, addPatternsToWatcher(config))
+}
+
+// Test restricting rules with --only-patterns and --exclude-patterns
+func TestFilterRulesByPatterns(t *testing.T) {
+	rules := []Rule{
+		{Name: "go", Patterns: []string{"**/*.go"}},
+		{Name: "web", Patterns: []string{"**/*.ts", "**/*.css"}},
+		{Name: "docs", Patterns: []string{"docs/*.md"}},
+	}
+	names := func(rules []Rule) []string {
+		var names []string
+		for _, rule := range rules {
+			names = append(names, rule.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"go", "web", "docs"}, names(filterRulesByPatterns(rules, nil, nil)))
+	assert.Equal(t, []string{"go"}, names(filterRulesByPatterns(rules, splitList("*.go"), nil)))
+	assert.Equal(t, []string{"web", "docs"}, names(filterRulesByPatterns(rules, splitList("*.css, docs/*"), nil)))
+	assert.Equal(t, []string{"go", "docs"}, names(filterRulesByPatterns(rules, nil, splitList("*.ts"))))
+	assert.Equal(t, []string{"web", "docs"}, names(filterRulesByPatterns(rules, splitList("**/*"), splitList("*.go"))))
+}
+
+// Test that removing a watched directory releases its watch
+func TestReleaseRemovedWatch(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	dir := filepath.Join(t.TempDir(), "dist")
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	before := watchedPaths.Len()
+
+	assert.Equal(t, 1, watchPattern(dir, Config{}))
+	assert.Equal(t, before+1, watchedPaths.Len())
+	assert.Contains(t, watcher.WatchList(), dir)
+
+	assert.NoError(t, os.RemoveAll(dir))
+	pattern, orphaned := releaseWatch(dir)
+	assert.True(t, orphaned)
+	assert.Equal(t, dir, pattern)
+	assert.Equal(t, before, watchedPaths.Len())
+	assert.NotContains(t, watcher.WatchList(), dir)
+
+	_, orphaned = releaseWatch(dir)
+	assert.False(t, orphaned)
+}
+
+// Test --config-check against a valid and an invalid configuration
+func TestCheckConfig(t *testing.T) {
+	valid := Config{
+		DebounceTime: "500ms",
+		Rules: []Rule{
+			{
+				Name:     "build",
+				Patterns: []string{"**/*.go"},
+				Commands: []Command{{Cmd: "go build ./..."}},
+			},
+		},
+	}
+	var out strings.Builder
+	assert.NoError(t, checkConfig(&out, valid))
+	assert.Contains(t, out.String(), "Rule build")
+	assert.Contains(t, out.String(), "pattern: **/*.go")
+	assert.Contains(t, out.String(), "command: go build ./...")
+	assert.Contains(t, out.String(), "Configuration OK")
+
+	invalid := valid
+	invalid.DebounceTime = "soon"
+	out.Reset()
+	err := checkConfig(&out, invalid)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	assert.Equal(t, exitCodeInvalidConfig, exitCode(err))
+	assert.Contains(t, out.String(), "Configuration invalid")
+}
+
+// Test the relative and absolute file placeholders
+func TestAbsFilePlaceholder(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "pkg", "main.go")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(target), 0755))
+	assert.NoError(t, os.WriteFile(target, []byte("package pkg"), 0644))
+
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	data := newMatchData(filepath.Join("pkg", "main.go"), "**/*.go")
+	abs, err := renderCommand("{{.AbsFile}}", data)
+	assert.NoError(t, err)
+	assert.True(t, filepath.IsAbs(abs))
+	assert.FileExists(t, abs)
+
+	data = newMatchData(target, "**/*.go")
+	rel, err := renderCommand("{{.File}}", data)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join("pkg", "main.go"), rel)
+	assert.Equal(t, target, data.AbsFile)
+}
+
+// Test discovering the project config from a nested directory
+func TestNestedConfigDiscovery(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	assert.NoError(t, err)
+	nested := filepath.Join(root, "cmd", "server")
+	assert.NoError(t, os.MkdirAll(nested, 0755))
+	configData := []byte(`
+debounce_time: "1s"
+rules:
+  - patterns:
+      - "**/*.go"
+    commands:
+      - cmd: "go build ./..."
+`)
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "go-watch.config.yaml"), configData, 0644))
+
+	assert.Equal(t, filepath.Join(root, "go-watch.config.yaml"), findDefaultConfig(nested))
+	assert.Equal(t, "go-watch.config.yaml", findDefaultConfig(root))
+	assert.Equal(t, "", findDefaultConfig(t.TempDir()))
+
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(nested))
+	defer os.Chdir(wd)
+
+	config, err := loadConfig("")
+	assert.NoError(t, err)
+	assert.Equal(t, "1s", config.DebounceTime)
+	assert.Len(t, config.Rules, 1)
+
+	current, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.Equal(t, root, current)
+}
+
+// Test watching the paths a command prints
+func TestWatchCommandOutput(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	dir := t.TempDir()
+	first := filepath.Join(dir, "api.pb.go")
+	second := filepath.Join(dir, "model.pb.go")
+	assert.NoError(t, os.WriteFile(first, []byte("package gen"), 0644))
+	assert.NoError(t, os.WriteFile(second, []byte("package gen"), 0644))
+
+	cmd := Command{
+		Cmd:         fmt.Sprintf("echo %s; echo %s; echo %s", first, second, filepath.Join(dir, "missing.go")),
+		WatchOutput: true,
+	}
+	assert.NoError(t, executeCommand(context.Background(), cmd, ""))
+
+	watched := watcher.WatchList()
+	assert.Contains(t, watched, first)
+	assert.Contains(t, watched, second)
+	assert.NotContains(t, watched, filepath.Join(dir, "missing.go"))
+
+	// Already watched paths are not added again
+	assert.Equal(t, 0, watchCommandOutput(first+"\n"+second+"\n"))
+}
+
+// Test the on_failure policies with a failing command
+func TestOnFailurePolicies(t *testing.T) {
+	run := func(policy, cmdPolicy string) (string, error) {
+		out := filepath.Join(t.TempDir(), "out.txt")
+		config := Config{
+			OnFailure: policy,
+			Rules: []Rule{
+				{
+					Patterns: []string{"*.go"},
+					Commands: []Command{
+						{Cmd: "exit 7", OnFailure: cmdPolicy},
+						{Cmd: "echo next >> " + out},
+					},
+				},
+			},
+		}
+		assert.NoError(t, config.Validate())
+		_, err := executeRules(context.Background(), []string{"main.go"}, config)
+		data, _ := os.ReadFile(out)
+		return string(data), err
+	}
+
+	out, err := run("continue", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "next\n", out)
+
+	out, err = run("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "", out)
+
+	out, err = run("stop-rule", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "", out)
+
+	out, err = run("", "exit")
+	assert.ErrorIs(t, err, ErrCommandFailed)
+	assert.Equal(t, 7, exitCode(err))
+	assert.Equal(t, "", out)
+
+	out, err = run("exit", "continue")
+	assert.NoError(t, err)
+	assert.Equal(t, "next\n", out)
+
+	assert.Error(t, Config{OnFailure: "retry"}.Validate())
+}
+
+// Test replaying rules for recently modified files at startup
+func TestReplaySince(t *testing.T) {
+	dir := t.TempDir()
+	recent := filepath.Join(dir, "recent.go")
+	old := filepath.Join(dir, "old.go")
+	assert.NoError(t, os.WriteFile(recent, []byte("package main"), 0644))
+	assert.NoError(t, os.WriteFile(old, []byte("package main"), 0644))
+	hourAgo := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(old, hourAgo, hourAgo))
+
+	out := filepath.Join(t.TempDir(), "replayed.txt")
+	config := Config{
+		Rules: []Rule{
+			{
+				Patterns: []string{filepath.Join(dir, "*.go")},
+				Commands: []Command{{Cmd: "echo {{.Files}} > " + out}},
+			},
+		},
+	}
+
+	assert.NoError(t, replaySince(context.Background(), config, 5*time.Minute))
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, recent+"\n", string(data))
+}
+
+// Test the debug warning for a pattern fully covered by another
+func TestRedundantPatternWarning(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0644))
+
+	var out syncBuffer
+	logger.SetOutput(&out)
+	level := *logLevel
+	*logLevel = "debug"
+	defer func() {
+		logger.SetOutput(os.Stdout)
+		*logLevel = level
+	}()
+
+	config := Config{
+		Rules: []Rule{
+			{Patterns: []string{filepath.Join(dir, "*.go")}},
+			{Patterns: []string{filepath.Join(dir, "main.go")}},
+		},
+	}
+	assert.Empty(t, addPatternsToWatcher(config))
+
+	logged := out.String()
+	assert.Equal(t, 1, strings.Count(logged, "Watching file: "))
+	assert.Contains(t, logged, "Pattern "+filepath.Join(dir, "main.go")+" adds no new watches")
+	assert.NotContains(t, logged, "Pattern "+filepath.Join(dir, "*.go")+" adds no new watches")
+}
+
+// Test deciding success from a command's output instead of its exit code
+func TestOutputPatterns(t *testing.T) {
+	failing := Command{Cmd: "echo 'ERROR: build broken'", FailurePattern: "^ERROR:"}
+	err := executeCommand(context.Background(), failing, "")
+	assert.ErrorIs(t, err, ErrCommandFailed)
+	var cmdErr *CommandError
+	if assert.ErrorAs(t, err, &cmdErr) {
+		assert.Equal(t, 0, cmdErr.ExitCode)
+	}
+
+	// The pattern also sees stderr
+	assert.Error(t, executeCommand(context.Background(), Command{Cmd: "echo ERROR: x >&2", FailurePattern: "ERROR"}, ""))
+
+	succeeding := Command{Cmd: "echo 'no changes'; exit 1", SuccessPattern: "no changes"}
+	assert.NoError(t, executeCommand(context.Background(), succeeding, ""))
+	assert.Error(t, executeCommand(context.Background(), Command{Cmd: "echo done", SuccessPattern: "^ok$"}, ""))
+
+	invalid := Config{Rules: []Rule{{Commands: []Command{{Cmd: "true", FailurePattern: "("}}}}}
+	assert.ErrorContains(t, invalid.Validate(), "failure_pattern")
+
+	// A rule failed by its output, with exit code 0, skips its dependents
+	config := Config{Rules: []Rule{
+		{Name: "build", Patterns: []string{"*.go"}, Commands: []Command{failing}},
+		{Name: "test", Needs: []string{"build"}, Patterns: []string{"*.go"}, Commands: []Command{{Cmd: "true"}}},
+	}}
+	reports, err := executeBatch(context.Background(), ruleBatch{files: []string{"main.go"}}, config)
+	assert.NoError(t, err)
+	if assert.Len(t, reports, 2) {
+		assert.True(t, reports[0].Failed())
+		assert.True(t, reports[0].Commands[0].Failed)
+		assert.Equal(t, 0, reports[0].Commands[0].ExitCode)
+		assert.Equal(t, "test", reports[1].Rule)
+		assert.True(t, reports[1].Skipped)
+	}
+}
+
+// Test watching the paths listed by --from-file
+func TestWatchFileList(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	dir := t.TempDir()
+	handler := filepath.Join(dir, "handler.go")
+	schema := filepath.Join(dir, "schema.sql")
+	for _, path := range []string{handler, schema, filepath.Join(dir, "handler.go.swp")} {
+		assert.NoError(t, os.WriteFile(path, []byte("x"), 0644))
+	}
+	list := filepath.Join(dir, "paths.txt")
+	entries := []string{handler, "", schema, filepath.Join(dir, "missing.go"), filepath.Join(dir, "handler.go.swp")}
+	assert.NoError(t, os.WriteFile(list, []byte(strings.Join(entries, "\n")), 0644))
+
+	var out syncBuffer
+	logger.SetOutput(&out)
+	defer logger.SetOutput(os.Stdout)
+
+	marker := filepath.Join(dir, "ran")
+	config := Config{
+		Rules: []Rule{{
+			Patterns: []string{filepath.Join(dir, "*.go")},
+			Commands: []Command{{Cmd: "touch " + marker}},
+		}},
+	}
+	added, err := watchFileList(list, config)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, added)
+	assert.True(t, isWatched(handler))
+	assert.True(t, isWatched(schema))
+	assert.Contains(t, out.String(), "missing.go")
+
+	_, err = watchFileList(filepath.Join(dir, "nope.txt"), config)
+	assert.Error(t, err)
+
+	assert.NoError(t, os.WriteFile(handler, []byte("package main"), 0644))
+	select {
+	case event := <-watcher.Events:
+		assert.Equal(t, handler, event.Name)
+		ran, err := executeRules(context.Background(), []string{event.Name}, config)
+		assert.NoError(t, err)
+		assert.True(t, ran)
+		assert.FileExists(t, marker)
+	case <-time.After(2 * time.Second):
+		t.Fatal("change in listed file not detected")
+	}
+}
+
+// Test that a reload stops watching the paths only the previous
+// configuration and file list covered
+func TestRewatch(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+	watchedPaths.Clear()
+	defer watchedPaths.Clear()
+
+	dir := t.TempDir()
+	paths := make(map[string]string)
+	for _, name := range []string{"main.go", "notes.txt", "old.log", "new.log", "go-watch.yaml", "out.bin"} {
+		paths[name] = filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(paths[name], nil, 0644))
+	}
+	rules := func(patterns ...string) Config {
+		rule := Rule{Commands: []Command{{Cmd: "true"}}}
+		for _, pattern := range patterns {
+			rule.Patterns = append(rule.Patterns, filepath.Join(dir, pattern))
+		}
+		return Config{Rules: []Rule{rule}}
+	}
+
+	addPatternsToWatcher(rules("*.go", "*.txt"))
+	watchListedPaths("paths.txt", []string{paths["old.log"]}, Config{})
+	watchPath(paths["go-watch.yaml"], paths["go-watch.yaml"])
+	watchedPaths.Add(paths["out.bin"], outputWatchPattern)
+
+	unresolved := rewatch(rules("*.go", "*.md"), []string{paths["new.log"]}, paths["go-watch.yaml"])
+	assert.Equal(t, []string{filepath.Join(dir, "*.md")}, unresolved)
+	for name, watched := range map[string]bool{
+		"main.go":       true,
+		"notes.txt":     false,
+		"old.log":       false,
+		"new.log":       true,
+		"go-watch.yaml": true,
+		"out.bin":       true,
+	} {
+		assert.Equal(t, watched, isWatched(paths[name]), name)
+	}
+	assert.NotContains(t, watcher.WatchList(), paths["notes.txt"])
+	assert.NotContains(t, watcher.WatchList(), paths["old.log"])
+	assert.Contains(t, watcher.WatchList(), paths["new.log"])
+}
+
+// Test that a no_debounce rule runs for every event while a normal rule
+// waits for the changes to settle
+func TestNoDebounceRule(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	dir := t.TempDir()
+	trigger := filepath.Join(dir, "trigger")
+	assert.NoError(t, os.WriteFile(trigger, nil, 0644))
+	out := filepath.Join(t.TempDir(), "runs.txt")
+
+	config := Config{
+		Rules: []Rule{
+			{
+				Name:       "instant",
+				NoDebounce: true,
+				Patterns:   []string{trigger},
+				Commands:   []Command{{Cmd: "echo instant >> " + out}},
+			},
+			{
+				Name:     "settled",
+				Patterns: []string{trigger},
+				Commands: []Command{{Cmd: "echo settled >> " + out}},
+			},
+		},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- watchLoop(context.Background(), config, 300*time.Millisecond, 4)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	for _, mode := range []os.FileMode{0600, 0640, 0644} {
+		assert.NoError(t, os.Chmod(trigger, mode))
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("rules did not run")
+	}
+
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "instant\ninstant\ninstant\nsettled\n", string(data))
+}
+
+// Test that commands sharing a concurrency key never overlap
+func TestConcurrencyKey(t *testing.T) {
+	run := func(keys ...string) string {
+		out := filepath.Join(t.TempDir(), "runs.txt")
+		for i, key := range keys {
+			cmd := Command{
+				// The trailing comment keeps the commands distinct
+				Cmd:            fmt.Sprintf("echo start >> %s; sleep 0.2; echo end >> %s # %d", out, out, i),
+				Parallel:       true,
+				ConcurrencyKey: key,
+			}
+			assert.NoError(t, executeCommand(context.Background(), cmd, ""))
+		}
+		runningCommands.Wait()
+		data, err := os.ReadFile(out)
+		assert.NoError(t, err)
+		return string(data)
+	}
+
+	assert.Equal(t, "start\nend\nstart\nend\n", run("build", "build"))
+	assert.Equal(t, "start\nstart\nend\nend\n", run("build", "lint"))
+}
+
+// Test the default ignore dirs and turning them off
+func TestDefaultIgnoreDirs(t *testing.T) {
+	config := Config{IgnoreDirs: []string{"tmp", "vendor"}}
+	dirs := withDefaultIgnoreDirs(config)
+	assert.Equal(t, []string{"tmp", "vendor", ".git", "node_modules", "dist", "bin"}, dirs)
+	assert.True(t, isIgnoredDir("web/node_modules/react/index.js", dirs))
+	assert.True(t, isIgnoredDir(".git/HEAD", dirs))
+	assert.False(t, isIgnoredDir(".github/workflows/ci.yml", dirs))
+	assert.False(t, isIgnoredDir("internal/distribution/cabinet.go", dirs))
+
+	config.UseDefaultIgnores = boolPtr(false)
+	assert.Equal(t, []string{"tmp", "vendor"}, withDefaultIgnoreDirs(config))
+
+	// Entries with a separator still match anywhere in the path
+	assert.True(t, isIgnoredDir("/src/app/build/out/main.js", []string{"build/out"}))
+
+	path := filepath.Join(t.TempDir(), "watch.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("use_default_ignores: false\n"), 0644))
+	loaded, err := loadConfig(path)
+	assert.NoError(t, err)
+	assert.Empty(t, withDefaultIgnoreDirs(loaded))
+}
+
+// Test running a command under a pseudo-terminal
+func TestCommandPTY(t *testing.T) {
+	assert.Error(t, executeCommand(context.Background(), Command{Cmd: "test -t 1"}, ""))
+	assert.NoError(t, executeCommand(context.Background(), Command{Cmd: "test -t 1", PTY: true}, ""))
+
+	out := filepath.Join(t.TempDir(), "out.log")
+	cmd := Command{Cmd: "echo colored; echo warning >&2", PTY: true, StdoutFile: out}
+	assert.NoError(t, executeCommand(context.Background(), cmd, ""))
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "colored\r\nwarning\r\n", string(data))
+
+	cmd.StderrFile = filepath.Join(t.TempDir(), "err.log")
+	assert.ErrorContains(t, Config{Rules: []Rule{{Commands: []Command{cmd}}}}.Validate(), "pty")
+}
+
+// Test the warning for a command that stays silent
+func TestIdleOutputWarning(t *testing.T) {
+	var out syncBuffer
+	logger.SetOutput(&out)
+	defer logger.SetOutput(os.Stdout)
+
+	chatty := Command{Cmd: "for i in 1 2 3 4 5 6; do echo $i; sleep 0.05; done", IdleWarning: "200ms"}
+	assert.NoError(t, executeCommand(context.Background(), chatty, ""))
+	assert.NotContains(t, out.String(), "No output from")
+
+	quiet := Command{Cmd: "echo building; sleep 0.5", IdleWarning: "200ms"}
+	assert.NoError(t, executeCommand(context.Background(), quiet, ""))
+	assert.Contains(t, out.String(), "No output from echo building; sleep 0.5 for 200ms, it is still running")
+
+	invalid := Config{Rules: []Rule{{Commands: []Command{{Cmd: "true", IdleWarning: "soon"}}}}}
+	assert.ErrorContains(t, invalid.Validate(), "idle_warning")
+}
+
+// Test that the literal prefix and suffix checks agree with the glob
+func TestPatternMatcherPrefilter(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"src/**/*.go", "src/api/main.go", true},
+		{"src/**/*.go", "web/main.go", false},
+		{"src/**/*.go", "src/api/main.ts", false},
+		{"*.{js,ts}", "index.ts", true},
+		// A single star stays within a directory, rules match such a
+		// pattern against the file name as well
+		{"*.{js,ts}", "app/index.ts", false},
+		{"docs/[a-c]*.md", "docs/api.md", true},
+		{"docs/[a-c]*.md", "docs/zoo.md", false},
+		{"Makefile", "Makefile", true},
+		{"Makefile", "src/Makefile", false},
+		{`file\*.go`, `file*.go`, true},
+	}
+	for _, c := range cases {
+		m := compiledPattern(c.pattern)
+		assert.Equal(t, c.match, m.Match(c.path), "%s on %s", c.pattern, c.path)
+		assert.Equal(t, glob.MustCompile(c.pattern, '/').Match(c.path), m.Match(c.path), "%s on %s", c.pattern, c.path)
+	}
+	assert.Same(t, compiledPattern("src/**/*.go"), compiledPattern("src/**/*.go"))
+}
+
+// BenchmarkMatchFilesNoMatch matches a path against many rules it does not
+// match, with and without the prefix and suffix prefilter. globs/op counts
+// the globs run per iteration.
+func BenchmarkMatchFilesNoMatch(b *testing.B) {
+	var rules []Rule
+	for i := 0; i < 100; i++ {
+		rules = append(rules, Rule{Patterns: []string{
+			fmt.Sprintf("services/svc%d/**/*.go", i),
+			fmt.Sprintf("services/svc%d/**/*.proto", i),
+		}})
+	}
+	files := []string{"web/src/components/Button.tsx"}
+
+	for _, prefilter := range []bool{true, false} {
+		b.Run(fmt.Sprintf("prefilter=%t", prefilter), func(b *testing.B) {
+			globs := 0
+			for _, rule := range rules {
+				for _, pattern := range rule.Patterns {
+					m := compiledPattern(pattern)
+					counted := &patternMatcher{glob: countingGlob{m.glob, &globs}}
+					if prefilter {
+						counted.prefix, counted.suffix = m.prefix, m.suffix
+					}
+					patternMatchersMu.Lock()
+					patternMatchers[pattern] = counted
+					patternMatchersMu.Unlock()
+				}
+			}
+			defer func() {
+				patternMatchersMu.Lock()
+				defer patternMatchersMu.Unlock()
+				for _, rule := range rules {
+					for _, pattern := range rule.Patterns {
+						delete(patternMatchers, pattern)
+					}
+				}
+			}()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, rule := range rules {
+					matchFiles(rule, files)
+				}
+			}
+			b.ReportMetric(float64(globs)/float64(b.N), "globs/op")
+		})
+	}
+}
+
+// countingGlob counts the paths matched against a glob.
+type countingGlob struct {
+	glob.Glob
+	count *int
+}
+
+func (g countingGlob) Match(path string) bool {
+	*g.count++
+	return g.Glob.Match(path)
+}
+
+// Test that startup waits for --wait-for paths to appear
+func TestWaitForPaths(t *testing.T) {
+	interval := waitForInterval
+	waitForInterval = 20 * time.Millisecond
+	defer func() { waitForInterval = interval }()
+
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing")
+	assert.NoError(t, os.WriteFile(existing, nil, 0644))
+	sock := filepath.Join(dir, "db.sock")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- waitForPaths(context.Background(), []string{existing, sock}, 5*time.Second)
+	}()
+	select {
+	case <-done:
+		t.Fatal("startup proceeded before the path existed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	assert.NoError(t, os.WriteFile(sock, nil, 0644))
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("startup did not proceed once the path existed")
+	}
+
+	err := waitForPaths(context.Background(), []string{filepath.Join(dir, "never")}, 100*time.Millisecond)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// Test that a rule with log_level debug is silent at the info level
+func TestRuleLogLevel(t *testing.T) {
+	var out syncBuffer
+	logger.SetOutput(&out)
+	defer logger.SetOutput(os.Stdout)
+
+	config := Config{
+		Rules: []Rule{
+			{Name: "noisy", LogLevel: "debug", Patterns: []string{"*.go"}, Commands: []Command{{Cmd: "true # noisy"}}},
+			{Name: "important", Patterns: []string{"*.go"}, Commands: []Command{{Cmd: "true # important"}}},
+		},
+	}
+	assert.NoError(t, config.Validate())
+	executeRules(context.Background(), []string{"main.go"}, config)
+	assert.NotContains(t, out.String(), "noisy")
+	assert.Contains(t, out.String(), "Executing command: true # important")
+
+	level := *logLevel
+	*logLevel = "debug"
+	defer func() { *logLevel = level }()
+	executeRules(context.Background(), []string{"main.go"}, config)
+	assert.Contains(t, out.String(), "[debug] Executing command: true # noisy")
+
+	config.Rules[0].LogLevel = "trace"
+	assert.ErrorContains(t, config.Validate(), "log level")
+}
+
+// Test a rule subscribed to permission changes only
+func TestChmodEvents(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret.conf")
+	assert.NoError(t, os.WriteFile(secret, []byte("a"), 0600))
+	out := filepath.Join(t.TempDir(), "modes.txt")
+
+	config := Config{
+		Rules: []Rule{{
+			Events:   []string{"chmod"},
+			Patterns: []string{secret},
+			Commands: []Command{{Cmd: "echo {{.Base}} {{.Mode}} >> " + out}},
+		}},
+	}
+	assert.NoError(t, config.Validate())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- watchLoop(context.Background(), config, 50*time.Millisecond, 1)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// A write alone does not trigger the rule
+	assert.NoError(t, os.WriteFile(secret, []byte("b"), 0600))
+	time.Sleep(200 * time.Millisecond)
+	assert.NoFileExists(t, out)
+
+	assert.NoError(t, os.Chmod(secret, 0666))
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("chmod rule did not run")
+	}
+
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret.conf 0666\n", string(data))
+
+	config.Rules[0].Events = []string{"touch"}
+	assert.ErrorContains(t, config.Validate(), "unsupported event")
+}
+
+// Test that closing the watcher stops the loop and its executor
+func TestWatcherClosed(t *testing.T) {
+	before := runtime.NumGoroutine()
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.go")
+	assert.NoError(t, os.WriteFile(file, []byte("a"), 0600))
+	config := Config{
+		Rules: []Rule{{Patterns: []string{file}, Commands: []Command{{Cmd: "echo changed"}}}},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- watchLoop(context.Background(), config, 50*time.Millisecond, 0)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, watcher.Close())
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch loop did not return after the watcher closed")
+	}
+	// Exiting goroutines may take a moment to be accounted for
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before, "goroutines leaked")
+}
+
+// Test that absolute patterns outside the working directory and the rule
+// root are watched and matched
+func TestAbsolutePatternOutsideRoot(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	project := t.TempDir()
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(project))
+	defer os.Chdir(wd)
+
+	etc := t.TempDir()
+	conf := filepath.Join(etc, "app.conf")
+	assert.NoError(t, os.WriteFile(conf, []byte("a"), 0644))
+	out := filepath.Join(t.TempDir(), "runs.txt")
+
+	rule := Rule{
+		Root:     project,
+		Patterns: []string{filepath.Join(etc, "*.conf")},
+		Commands: []Command{{Cmd: "echo {{.AbsFile}} >> " + out}},
+	}
+	assert.Equal(t, filepath.Join(etc, "*.conf"), rulePattern(rule, rule.Patterns[0]))
+	rel, err := filepath.Rel(project, conf)
+	assert.NoError(t, err)
+	assert.True(t, matchPattern(rule, rule.Patterns[0], rel), "relative form of the path")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- watchLoop(context.Background(), Config{Rules: []Rule{rule}}, 50*time.Millisecond, 1)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, os.WriteFile(conf, []byte("b"), 0644))
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("change outside the root did not run the rule")
+	}
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, conf+"\n", string(data))
+}
+
+// Test that --fail-on-no-match stops at startup when a pattern matches no
+// files
+func TestFailOnNoMatch(t *testing.T) {
+	*failNoMatch = true
+	defer func() { *failNoMatch = false }()
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), nil, 0644))
+	out := filepath.Join(t.TempDir(), "runs.txt")
+	rule := func(pattern string) Rule {
+		return Rule{Patterns: []string{filepath.Join(dir, pattern)}, Commands: []Command{{Cmd: "echo run >> " + out}}}
+	}
+
+	typo := Config{Rules: []Rule{rule("*.go"), rule("*.og")}}
+	err = watchLoop(context.Background(), typo, 50*time.Millisecond, 0)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	assert.ErrorContains(t, err, filepath.Join(dir, "*.og"))
+	assert.Equal(t, exitCodeInvalidConfig, exitCode(err))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, watchLoop(ctx, Config{Rules: []Rule{rule("*.go")}}, 50*time.Millisecond, 0))
+	assert.NoFileExists(t, out)
+}
+
+// Test that registration and matching agree on which paths a pattern
+// covers
+func TestPatternRegistrationMatchesEvents(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+	for _, file := range []string{"main.go", "src/api.go", "src/deep/nested/handler.go", "src/deep/notes.txt"} {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		assert.NoError(t, os.WriteFile(file, nil, 0644))
+	}
+
+	cases := []struct {
+		pattern string
+		file    string
+		match   bool
+	}{
+		// filepath.Glob treats "**" as "*" and never reached this file
+		{"src/**/*.go", filepath.Join("src", "deep", "nested", "handler.go"), true},
+		{"src/*.go", filepath.Join("src", "api.go"), true},
+		// A single star does not cross directories, for either
+		{"src/*.go", filepath.Join("src", "deep", "nested", "handler.go"), false},
+		{"src/**/*.go", filepath.Join("src", "deep", "notes.txt"), false},
+	}
+	for _, c := range cases {
+		t.Run(c.pattern+" "+c.file, func(t *testing.T) {
+			watchedPaths.Clear()
+			originalAdd := addWatch
+			addWatch = func(string) error { return nil }
+			defer func() { addWatch = originalAdd }()
+
+			watchPattern(c.pattern, Config{})
+			matched, _ := matchFiles(Rule{Patterns: []string{c.pattern}}, []string{c.file})
+			assert.Equal(t, c.match, isWatched(c.file), "watched")
+			assert.Equal(t, c.match, len(matched) == 1, "matched")
+		})
+	}
+}
+
+// Test the global events applying to every rule without its own
+func TestGlobalEvents(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "main.go")
+	docs := filepath.Join(dir, "README.md")
+	assert.NoError(t, os.WriteFile(source, []byte("a"), 0600))
+	assert.NoError(t, os.WriteFile(docs, []byte("a"), 0600))
+	out := filepath.Join(t.TempDir(), "runs.txt")
+
+	config := Config{
+		Events: []string{"write", "create"},
+		Rules: []Rule{
+			{Name: "build", Patterns: []string{source}, Commands: []Command{{Cmd: "echo build {{.Base}} >> " + out}}},
+			{Name: "docs", Patterns: []string{docs}, Commands: []Command{{Cmd: "echo docs {{.Base}} >> " + out}}},
+		},
+	}
+	assert.NoError(t, config.Validate())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- watchLoop(context.Background(), config, 50*time.Millisecond, 1)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// Chmod is suppressed for both rules
+	assert.NoError(t, os.Chmod(source, 0666))
+	assert.NoError(t, os.Chmod(docs, 0666))
+	time.Sleep(200 * time.Millisecond)
+	assert.NoFileExists(t, out)
+
+	assert.NoError(t, os.WriteFile(docs, []byte("b"), 0600))
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("write did not run the rule")
+	}
+
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "docs README.md\n", string(data))
+
+	// A rule's own events override the global ones
+	rules := withDefaultEvents([]Rule{{Events: []string{"chmod"}}, {}}, config.Events)
+	assert.Equal(t, []string{"chmod"}, rules[0].Events)
+	assert.Equal(t, []string{"write", "create"}, rules[1].Events)
+	assert.True(t, subscribed(rules, fsnotify.Chmod))
+
+	config.Events = []string{"touch"}
+	assert.ErrorContains(t, config.Validate(), "unsupported event")
+}
+
+// Test the global command timeout and a command overriding it
+func TestCommandTimeout(t *testing.T) {
+	var out syncBuffer
+	logger.SetOutput(&out)
+	defer logger.SetOutput(os.Stdout)
+
+	w, err := NewWatcher(Config{
+		CommandTimeout: "200ms",
+		OnFailure:      failureContinue,
+		Rules: []Rule{{
+			Patterns: []string{"*.go"},
+			Commands: []Command{
+				{Name: "global", Cmd: "exec sleep 5"},
+				{Name: "override", Cmd: "sleep 0.5", Timeout: "5s"},
+			},
+		}},
+	})
+	assert.NoError(t, err)
+
+	start := time.Now()
+	results, err := w.RunOnce([]string{"main.go"})
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 3*time.Second)
+	if assert.Len(t, results, 1) && assert.Len(t, results[0].Commands, 2) {
+		assert.NotEqual(t, 0, results[0].Commands[0].ExitCode)
+		assert.Equal(t, 0, results[0].Commands[1].ExitCode)
+	}
+	assert.Contains(t, out.String(), "timed out after 200ms")
+
+	_, err = NewWatcher(Config{CommandTimeout: "soon"})
+	assert.Error(t, err)
+	for _, timeout := range []string{"0s", "-1s"} {
+		_, err = NewWatcher(Config{CommandTimeout: timeout})
+		assert.ErrorContains(t, err, "positive", timeout)
+		invalid := Config{Rules: []Rule{{Patterns: []string{"*.go"}, Commands: []Command{{Cmd: "true", Timeout: timeout}}}}}
+		assert.ErrorContains(t, invalid.Validate(), "positive", timeout)
+	}
+
+	// Commands that bypassed validation fail instead of running unbounded
+	err = executeCommand(context.Background(), Command{Cmd: "true", Timeout: "soon"}, "")
+	assert.ErrorContains(t, err, "invalid timeout")
+}
+
+// Test that --no-exec reports matches without resolving commands
+func TestNoExec(t *testing.T) {
+	*noExec = true
+	defer func() { *noExec = false }()
+	var out bytes.Buffer
+	matchOutput = &out
+	defer func() { matchOutput = os.Stdout }()
+	logger.SetOutput(io.Discard)
+	defer logger.SetOutput(os.Stdout)
+
+	config := Config{
+		Rules: []Rule{
+			{
+				Name:     "go",
+				Patterns: []string{"*.go"},
+				// An invalid template fails if the command is ever resolved.
+				Commands: []Command{{Cmd: "echo {{.Nope"}},
+			},
+			{Patterns: []string{"*.md"}, Commands: []Command{{Cmd: "echo {{.Nope"}}},
+		},
+	}
+	reports, err := executeBatch(context.Background(), ruleBatch{files: []string{"main.go", "README.md", "x.txt"}}, config)
+	assert.NoError(t, err)
+	assert.Len(t, reports, 2)
+	for _, report := range reports {
+		assert.Empty(t, report.Commands)
+	}
+	assert.Equal(t, "go\tmain.go\n*.md\tREADME.md\n", out.String())
+
+	*logFormat = "json"
+	defer func() { *logFormat = "text" }()
+	out.Reset()
+	_, err = executeBatch(context.Background(), ruleBatch{files: []string{"main.go"}}, config)
+	assert.NoError(t, err)
+	var match MatchReport
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &match))
+	assert.Equal(t, MatchReport{Rule: "go", Pattern: "*.go", Files: []string{"main.go"}}, match)
+
+	// Log lines stay out of the reports on stdout
+	assert.Equal(t, io.Writer(os.Stderr), logDestination())
+	*noExec = false
+	assert.Equal(t, io.Writer(os.Stdout), logDestination())
+}
+
+// Test JSON log lines
+func TestJSONLogWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := jsonLogWriter{w: &out}
+	_, err := w.Write([]byte("[debug] Watching: a.go\n"))
+	assert.NoError(t, err)
+
+	var line struct{ Time, Level, Msg string }
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &line))
+	assert.Equal(t, "debug", line.Level)
+	assert.Equal(t, "Watching: a.go", line.Msg)
+	assert.NotEmpty(t, line.Time)
+}
+
+// Test that skip_if_running does not start a second instance
+func TestSkipIfRunning(t *testing.T) {
+	var out syncBuffer
+	logger.SetOutput(&out)
+	defer logger.SetOutput(os.Stdout)
+
+	runs := filepath.Join(t.TempDir(), "runs.txt")
+	config := Config{
+		Rules: []Rule{{
+			Patterns: []string{"*.go"},
+			Commands: []Command{{
+				Cmd:           "echo start >> " + runs + "; sleep 0.5; echo end >> " + runs,
+				Parallel:      true,
+				SkipIfRunning: true,
+			}},
+		}},
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := executeRules(context.Background(), []string{"main.go"}, config)
+		assert.NoError(t, err)
+	}
+	runningCommands.Wait()
+
+	data, err := os.ReadFile(runs)
+	assert.NoError(t, err)
+	assert.Equal(t, "start\nend\n", string(data), "the running instance was restarted or duplicated")
+	assert.Contains(t, out.String(), "Skipping command, it is still running")
+
+	// Once it finished, the command runs again
+	_, err = executeRules(context.Background(), []string{"main.go"}, config)
+	assert.NoError(t, err)
+	runningCommands.Wait()
+	data, err = os.ReadFile(runs)
+	assert.NoError(t, err)
+	assert.Equal(t, "start\nend\nstart\nend\n", string(data))
+}
+
+// Test anchoring patterns at the root with a leading "./"
+func TestAnchoredPatterns(t *testing.T) {
+	files := []string{"main.go", filepath.Join("cmd", "main.go")}
+	match := func(rule Rule) []string {
+		matched, _ := matchFiles(rule, files)
+		return matched
+	}
+
+	assert.Equal(t, []string{"main.go"}, match(Rule{Patterns: []string{"./main.go"}}))
+	assert.Equal(t, files, match(Rule{Patterns: []string{"main.go"}}))
+	assert.Equal(t, []string{filepath.Join("cmd", "main.go")}, match(Rule{Patterns: []string{"./cmd/*.go"}}))
+
+	// With a root, the pattern is anchored there
+	rooted := Rule{Root: "cmd", Patterns: []string{"./main.go"}}
+	assert.Equal(t, []string{filepath.Join("cmd", "main.go")}, match(rooted))
+	assert.Equal(t, filepath.Join("cmd", "main.go"), rulePattern(rooted, "./main.go"))
+	assert.Equal(t, "main.go", rulePattern(Rule{}, "./main.go"))
+
+	// A leading "/" is an absolute path, whatever the working directory
+	dir := t.TempDir()
+	abs := filepath.Join(dir, "main.go")
+	matched, _ := matchFiles(Rule{Patterns: []string{filepath.Join(dir, "*.go")}}, []string{abs})
+	assert.Equal(t, []string{abs}, matched)
+	assert.Equal(t, filepath.Join(dir, "*.go"), rulePattern(Rule{}, filepath.Join(dir, "*.go")))
+	assert.Equal(t, "/tmp/other/*.log", rulePattern(Rule{}, "/tmp/other/*.log"))
+	assert.True(t, matchPattern(Rule{}, "/tmp/other/*.log", "/tmp/other/app.log"))
+	assert.False(t, matchPattern(Rule{}, "/tmp/other/*.log", filepath.Join("tmp", "other", "app.log")))
+}
+
+// Test timestamping each line of command output
+func TestPrefixTimestamps(t *testing.T) {
+	defer func(clock func() time.Time) { now = clock }(now)
+	now = func() time.Time { return time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC) }
+	*prefixTimes = true
+	defer func() { *prefixTimes = false }()
+
+	out := filepath.Join(t.TempDir(), "out.log")
+	config := Config{
+		Rules: []Rule{{
+			Patterns: []string{"*.go"},
+			Commands: []Command{{Cmd: "printf 'one\\ntwo\\n'; printf 'thr'; printf 'ee\\n'", StdoutFile: out}},
+		}},
+	}
+	_, err := executeRules(context.Background(), []string{"main.go"}, config)
+	assert.NoError(t, err)
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	stamp := "2024-03-01T09:30:00Z "
+	assert.Equal(t, stamp+"one\n"+stamp+"two\n"+stamp+"three\n", string(data))
+
+	var buf bytes.Buffer
+	w := newTimestampWriter(&buf, "15:04")
+	_, err = w.Write([]byte("a\nb"))
+	assert.NoError(t, err)
+	_, err = w.Write([]byte("c\n\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "09:30 a\n09:30 bc\n09:30 \n", buf.String())
+}
+
+// Test ignoring hidden files and directories
+func TestIgnoreHidden(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	out := filepath.Join(t.TempDir(), "runs.txt")
+	config := Config{
+		Rules: []Rule{{
+			Patterns: []string{"**/*.go"},
+			Commands: []Command{{Cmd: "echo {{.Match}} >> " + out}},
+		}},
+	}
+	assert.True(t, isIgnoredFile(".hidden/foo.go", config))
+	assert.True(t, isIgnoredFile("src/.cache/foo.go", config))
+	assert.False(t, isIgnoredFile("src/foo.go", config))
+	assert.False(t, isIgnoredFile("./src/foo.go", config))
+
+	// A rule naming the hidden directory still sees its files
+	explicit := config
+	explicit.Rules = append(explicit.Rules, Rule{Patterns: []string{".hidden/*.go"}})
+	assert.False(t, isIgnoredFile(".hidden/foo.go", explicit))
+
+	// Registration skips hidden paths too
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, ".idea"), 0755))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "src"), 0755))
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+	assert.Equal(t, 2, watchPattern("*", config))
+	assert.True(t, isWatched("src"))
+	assert.False(t, isWatched(".idea"))
+
+	ignoreHidden := false
+	config.IgnoreHidden = &ignoreHidden
+	assert.False(t, isIgnoredFile(".hidden/foo.go", config))
+	ran, err := executeRules(context.Background(), []string{".hidden/foo.go"}, config)
+	assert.NoError(t, err)
+	assert.True(t, ran)
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, ".hidden/foo.go\n", string(data))
+}
+
+// Test the registration summary replacing per-path log lines
+func TestWatchSummary(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	var out syncBuffer
+	logger.SetOutput(&out)
+	defer logger.SetOutput(os.Stdout)
+
+	dir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, os.Mkdir(filepath.Join(dir, fmt.Sprintf("pkg%d", i)), 0755))
+	}
+	before := watchedPaths.Len()
+
+	config := Config{Rules: []Rule{{Patterns: []string{filepath.Join(dir, "*")}}}}
+	assert.Empty(t, addPatternsToWatcher(config))
+	for i := 0; i < 20; i++ {
+		assert.True(t, isWatched(filepath.Join(dir, fmt.Sprintf("pkg%d", i))))
+	}
+
+	logged := out.String()
+	assert.NotContains(t, logged, "Watching file:")
+	assert.Regexp(t, fmt.Sprintf(`Watching %d paths in \d+ms`, before+20), logged)
+}
+
+// BenchmarkWatchPattern registers a large tree, logging every watched path
+// and logging only the registration summary.
+func BenchmarkWatchPattern(b *testing.B) {
+	dir := b.TempDir()
+	for i := 0; i < 2000; i++ {
+		if err := os.Mkdir(filepath.Join(dir, fmt.Sprintf("dir%d", i)), 0755); err != nil {
+			b.Fatal(err)
+		}
+	}
+	// Log lines go to a file, as they would to a terminal or a log
+	// collector, so writing one per path costs what it costs in practice.
+	logFile, err := os.Create(filepath.Join(b.TempDir(), "go-watch.log"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer logFile.Close()
+	logger.SetOutput(logFile)
+	defer logger.SetOutput(os.Stdout)
+	defer func(level string) { *logLevel = level }(*logLevel)
+
+	// debug logs every watched path, as every level did before the
+	// registration summary
+	for _, level := range []string{"debug", "info"} {
+		b.Run("log-level="+level, func(b *testing.B) {
+			*logLevel = level
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				var err error
+				if watcher, err = fsnotify.NewWatcher(); err != nil {
+					b.Fatal(err)
+				}
+				watchedPaths.Clear()
+				b.StartTimer()
+
+				addPatternsToWatcher(Config{Rules: []Rule{{Patterns: []string{filepath.Join(dir, "*")}}}})
+
+				b.StopTimer()
+				watcher.Close()
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+// Test what --restart-on-config-error does when an edited configuration
+// file fails to load
+func TestConfigReloadPolicy(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	configYAML := func(cmd string) []byte {
+		return []byte("rules:\n  - patterns: [\"*.go\"]\n    commands:\n      - cmd: \"" + cmd + "\"\n")
+	}
+
+	for _, policy := range []string{configErrorKeep, configErrorFail} {
+		t.Run(policy, func(t *testing.T) {
+			var err error
+			watcher, err = fsnotify.NewWatcher()
+			assert.NoError(t, err)
+			defer watcher.Close()
+
+			path := filepath.Join(t.TempDir(), "go-watch.yaml")
+			assert.NoError(t, os.WriteFile(path, configYAML("echo one"), 0644))
+			config, err := loadConfig(path)
+			assert.NoError(t, err)
+			*configErrorPolicy = policy
+			defer func() {
+				*configErrorPolicy = configErrorKeep
+				configPath = ""
+			}()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan error, 1)
+			go func() {
+				done <- watchLoop(ctx, config, 20*time.Millisecond, 0)
+			}()
+			time.Sleep(100 * time.Millisecond)
+			assert.NoError(t, os.WriteFile(path, []byte("rules: [\n"), 0644))
+
+			if policy == configErrorFail {
+				select {
+				case err := <-done:
+					assert.ErrorIs(t, err, ErrInvalidConfig)
+				case <-time.After(5 * time.Second):
+					t.Fatal("watch loop kept running with a broken configuration")
+				}
+				return
+			}
+
+			select {
+			case err := <-done:
+				t.Fatalf("watch loop returned with the keep policy: %v", err)
+			case <-time.After(300 * time.Millisecond):
+			}
+			assert.Equal(t, "echo one", currentConfig().Rules[0].Commands[0].Cmd)
+
+			// A later valid edit is still applied
+			assert.NoError(t, os.WriteFile(path, configYAML("echo two"), 0644))
+			assert.Eventually(t, func() bool {
+				return currentConfig().Rules[0].Commands[0].Cmd == "echo two"
+			}, 5*time.Second, 10*time.Millisecond)
+			cancel()
+			assert.NoError(t, <-done)
+		})
+	}
+}
+
+// Test that multi-part extensions match as a whole, in patterns, the
+// extensions shorthand and filter_ext
+func TestMultiPartExtensions(t *testing.T) {
+	assert.True(t, matchPattern(Rule{}, "*.tar.gz", "archive.tar.gz"))
+	assert.True(t, matchPattern(Rule{}, "*.tar.gz", filepath.Join("dist", "archive.tar.gz")))
+	assert.False(t, matchPattern(Rule{}, "*.tar.gz", "archive.gz"))
+
+	rules := withExtensionPatterns([]Rule{{Extensions: []string{".d.ts", "tar.gz"}}})
+	assert.Equal(t, []string{"{*.d.ts,**/*.d.ts}", "{*.tar.gz,**/*.tar.gz}"}, rules[0].Patterns)
+	matched, _ := matchFiles(rules[0], []string{
+		"types.d.ts",
+		filepath.Join("src", "api.d.ts"),
+		filepath.Join("src", "index.ts"),
+		"archive.tar.gz",
+		"archive.gz",
+	})
+	assert.Equal(t, []string{"types.d.ts", filepath.Join("src", "api.d.ts"), "archive.tar.gz"}, matched)
+
+	// The shorthand registers files at any depth
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+	assert.NoError(t, os.Mkdir("src", 0755))
+	for _, name := range []string{"types.d.ts", filepath.Join("src", "api.d.ts"), filepath.Join("src", "index.ts")} {
+		assert.NoError(t, os.WriteFile(name, nil, 0644))
+	}
+	resolved, err := resolvePattern(rules[0].Patterns[0], Config{})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"types.d.ts", filepath.Join("src", "api.d.ts")}, resolved)
+
+	files := []string{"types.d.ts", "index.ts", "archive.tar.gz", "archive.gz"}
+	assert.Equal(t, FileList{"types.d.ts"}, filterExt([]string{".d.ts"}, files))
+	assert.Equal(t, FileList{"types.d.ts", "index.ts"}, filterExt([]string{"ts"}, files))
+	assert.Equal(t, FileList{"archive.tar.gz"}, filterExt([]string{"tar.gz"}, files))
+
+	assert.Error(t, Config{Rules: []Rule{{Extensions: []string{"."}}}}.Validate())
+}
+
+// Test that --print-config prints the configuration after flag overrides
+func TestPrintConfig(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+	defer func() { configPath = "" }()
+	configData := []byte(`
+ignore_dirs: ["tmp"]
+rules:
+  - name: build
+    extensions: ["go"]
+    commands:
+      - cmd: "go build ./..."
+`)
+	assert.NoError(t, os.WriteFile("go-watch.config.yaml", configData, 0644))
+	*ignoreDirs = "build"
+	defer func() { *ignoreDirs = "" }()
+
+	config, err := loadConfig("")
+	assert.NoError(t, err)
+	config = applyConfigFlags(config)
+
+	var out bytes.Buffer
+	assert.NoError(t, printConfig(&out, config, "text"))
+	var printed Config
+	assert.NoError(t, yaml.Unmarshal(out.Bytes(), &printed))
+	assert.Contains(t, printed.IgnoreDirs, "build")
+	assert.NotContains(t, printed.IgnoreDirs, "tmp")
+	assert.Equal(t, []string{"{*.go,**/*.go}"}, printed.Rules[0].Patterns)
+
+	out.Reset()
+	assert.NoError(t, printConfig(&out, config, "json"))
+	printed = Config{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &printed))
+	assert.Contains(t, printed.IgnoreDirs, "build")
+	assert.Equal(t, "build", printed.Rules[0].Name)
+}
+
+// Test that a rule's env is rendered from the changed path
+func TestRuleEnvFromPath(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+	for _, service := range []string{"api", "web"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join("services", service), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join("services", service, "main.go"), nil, 0644))
+	}
+	out := filepath.Join(t.TempDir(), "services.txt")
+
+	config := Config{
+		Rules: []Rule{{
+			Patterns: []string{"services/**/*.go"},
+			Env:      map[string]string{"SERVICE": "{{index .PathSegments 1}}"},
+			Commands: []Command{{Cmd: "echo $SERVICE >> " + out}},
+		}},
+	}
+	assert.NoError(t, config.Validate())
+	for _, service := range []string{"web", "api"} {
+		batch := ruleBatch{files: []string{filepath.Join("services", service, "main.go")}}
+		_, err := executeBatch(context.Background(), batch, config)
+		assert.NoError(t, err)
+	}
+
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "web\napi\n", string(data))
+
+	config.Rules[0].Env = map[string]string{"BAD NAME": "x"}
+	assert.Error(t, config.Validate())
+}
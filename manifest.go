@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// usesManifest reports whether a command refers to {{.Manifest}}, so the
+// manifest is only written when needed.
+func usesManifest(cmd Command) bool {
+	return strings.Contains(cmd.String(), ".Manifest")
+}
+
+// writeManifest writes files, one per line, to a new temporary file and
+// returns its path.
+func writeManifest(files []string) (string, error) {
+	f, err := os.CreateTemp("", "go-watch-manifest-*.txt")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.WriteString(strings.Join(files, "\n") + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// removeManifest deletes the manifest of a command run, if it has one.
+func removeManifest(cmd Command) {
+	if cmd.manifest == "" {
+		return
+	}
+	if err := os.Remove(cmd.manifest); err != nil && !os.IsNotExist(err) {
+		logger.Printf("Failed to remove manifest %s: %v", cmd.manifest, err)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test passing the batched files to a command through a manifest file
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	copied := filepath.Join(dir, "copied.txt")
+	path := filepath.Join(dir, "path.txt")
+	config := Config{
+		Rules: []Rule{{
+			Patterns: []string{"*.go"},
+			Commands: []Command{{Cmd: "cp {{.Manifest}} " + copied + " && echo {{.Manifest}} > " + path}},
+		}},
+	}
+
+	ran, err := executeRules(context.Background(), []string{"a.go", "pkg/b.go", "notes.txt"}, config)
+	assert.NoError(t, err)
+	assert.True(t, ran)
+
+	data, err := os.ReadFile(copied)
+	assert.NoError(t, err)
+	assert.Equal(t, "a.go\npkg/b.go\n", string(data))
+
+	manifest, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, strings.TrimSpace(string(manifest)))
+	assert.NoFileExists(t, strings.TrimSpace(string(manifest)), "manifest not cleaned up")
+}
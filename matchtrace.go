@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// matchTracing reports whether --verbose-matching or GO_WATCH_TRACE=match
+// asked for the decision taken on each change, to find out why a change
+// did not run a rule.
+func matchTracing() bool {
+	return *verboseMatching || os.Getenv("GO_WATCH_TRACE") == "match"
+}
+
+// traceMatch logs a step of the decision on event at debug level, when
+// match tracing is on.
+func traceMatch(event fsnotify.Event, format string, args ...interface{}) {
+	if matchTracing() {
+		logger.Output(2, fmt.Sprintf("[debug] match %s %s: ", event.Op, event.Name)+fmt.Sprintf(format, args...))
+	}
+}
+
+// dropReason returns why event is dropped before reaching the rules, or ""
+// when it is not: the path is under an ignored directory or ignored, or
+// no rule subscribes to its kind of change.
+func dropReason(event fsnotify.Event, config Config) string {
+	if inIgnoredDir(event.Name, config) {
+		return "under an ignored directory (ignore_dirs)"
+	}
+	if reason := ignoreReason(event.Name, config); reason != "" {
+		return reason
+	}
+	// Kinds of change no rule subscribes to must not delay the batch.
+	if !subscribed(withDefaultEvents(config.Rules, config.Events), event.Op) {
+		return fmt.Sprintf("no rule subscribes to %s events", event.Op)
+	}
+	return ""
+}
+
+// admitEvent reports whether event goes on to the rules. With match
+// tracing, it logs why the event is dropped, or how each rule matches it.
+func admitEvent(event fsnotify.Event, config Config) bool {
+	reason := dropReason(event, config)
+	if reason != "" {
+		traceMatch(event, "dropped, %s", reason)
+		return false
+	}
+	if !matchTracing() {
+		return true
+	}
+	batch := ruleBatch{files: []string{event.Name}, ops: map[string]fsnotify.Op{event.Name: event.Op}}
+	matches := 0
+	for i, rule := range withDefaultEvents(config.Rules, config.Events) {
+		// Unnamed rules are numbered as by --config-check
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		matched, pattern := matchFiles(rule, []string{event.Name})
+		switch {
+		case len(matched) == 0:
+			traceMatch(event, "rule %s: no pattern matches", name)
+		case isIgnoredDir(event.Name, ruleIgnoreDirs(rule, config)):
+			traceMatch(event, "rule %s: matched by %s, but it ignores the directory", name, pattern)
+		case len(filesForEvents(rule, batch)) == 0:
+			traceMatch(event, "rule %s: matched by %s, but it does not subscribe to %s events", name, pattern, event.Op)
+		default:
+			traceMatch(event, "rule %s: matched by %s", name, pattern)
+			matches++
+		}
+	}
+	if matches == 0 {
+		traceMatch(event, "no rule matches")
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that --verbose-matching logs why a change is dropped or runs no rule
+func TestVerboseMatching(t *testing.T) {
+	var out syncBuffer
+	logger.SetOutput(&out)
+	defer logger.SetOutput(os.Stdout)
+	config := Config{
+		IgnoreDirs: []string{"node_modules"},
+		Rules: []Rule{
+			{Name: "build", Patterns: []string{"*.go"}, Commands: []Command{{Cmd: "go build"}}},
+			{Events: []string{"create"}, Patterns: []string{"*.md"}, Commands: []Command{{Cmd: "true"}}},
+		},
+	}
+	ignored := fsnotify.Event{Name: filepath.Join("node_modules", "lib", "index.js"), Op: fsnotify.Write}
+	unmatched := fsnotify.Event{Name: "notes.txt", Op: fsnotify.Write}
+
+	// Nothing is traced by default
+	assert.False(t, admitEvent(ignored, config))
+	assert.True(t, admitEvent(unmatched, config))
+	assert.Empty(t, out.String())
+
+	*verboseMatching = true
+	defer func() { *verboseMatching = false }()
+	assert.False(t, admitEvent(ignored, config))
+	assert.Contains(t, out.String(), "[debug] match WRITE "+ignored.Name+": dropped, under an ignored directory (ignore_dirs)")
+	assert.NotContains(t, out.String(), "rule build")
+
+	assert.True(t, admitEvent(unmatched, config))
+	assert.Contains(t, out.String(), "match WRITE notes.txt: rule build: no pattern matches")
+	assert.Contains(t, out.String(), "match WRITE notes.txt: rule #2: no pattern matches")
+	assert.Contains(t, out.String(), "match WRITE notes.txt: no rule matches")
+
+	assert.True(t, admitEvent(fsnotify.Event{Name: "README.md", Op: fsnotify.Write}, config))
+	assert.Contains(t, out.String(), "rule #2: matched by *.md, but it does not subscribe to WRITE events")
+	assert.True(t, admitEvent(fsnotify.Event{Name: "main.go", Op: fsnotify.Write}, config))
+	assert.Contains(t, out.String(), "match WRITE main.go: rule build: matched by *.go")
+
+	// GO_WATCH_TRACE=match turns the trace on too
+	*verboseMatching = false
+	t.Setenv("GO_WATCH_TRACE", "match")
+	assert.True(t, matchTracing())
+}
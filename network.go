@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// defaultNetworkAddress is dialed to tell whether the network is reachable
+// for commands with requires_network, unless network_check_address or
+// --network-check-address names another one.
+const defaultNetworkAddress = "1.1.1.1:53"
+
+// networkTimeout bounds the connectivity check.
+var networkTimeout = time.Second
+
+// networkAddress returns the address dialed by the connectivity check.
+func networkAddress() string {
+	if address := currentConfig().NetworkCheckAddress; address != "" {
+		return address
+	}
+	return defaultNetworkAddress
+}
+
+// checkNetwork reports whether the network is reachable. It is a variable
+// so tests can simulate being offline.
+var checkNetwork = func(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, networkTimeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", networkAddress())
+	if err != nil {
+		debugf("Network check failed: %v", err)
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+type networkKey struct{}
+
+// networkStatus caches the connectivity check for one run cycle.
+type networkStatus struct {
+	once   sync.Once
+	online bool
+}
+
+// withNetworkCheck returns a context caching the connectivity check, so it
+// runs at most once for the commands of a cycle.
+func withNetworkCheck(ctx context.Context) context.Context {
+	return context.WithValue(ctx, networkKey{}, &networkStatus{})
+}
+
+// online reports whether the network is reachable, using the check cached
+// in ctx when there is one.
+func online(ctx context.Context) bool {
+	status, ok := ctx.Value(networkKey{}).(*networkStatus)
+	if !ok {
+		return checkNetwork(ctx)
+	}
+	status.once.Do(func() {
+		status.online = checkNetwork(ctx)
+	})
+	return status.online
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that commands requiring the network are skipped while offline
+func TestRequiresNetworkOffline(t *testing.T) {
+	var checks atomic.Int32
+	defer func(check func(context.Context) bool) { checkNetwork = check }(checkNetwork)
+	checkNetwork = func(context.Context) bool {
+		checks.Add(1)
+		return false
+	}
+
+	var out syncBuffer
+	logger.SetOutput(&out)
+	defer logger.SetOutput(os.Stdout)
+
+	runs := filepath.Join(t.TempDir(), "runs.txt")
+	config := Config{
+		Rules: []Rule{
+			{
+				Patterns: []string{"*.go"},
+				Commands: []Command{
+					{Cmd: "echo deploy >> " + runs, RequiresNetwork: true},
+					{Cmd: "echo build >> " + runs},
+				},
+			},
+			{
+				Patterns: []string{"*.go"},
+				Commands: []Command{{Cmd: "echo upload >> " + runs, RequiresNetwork: true}},
+			},
+		},
+	}
+
+	ran, err := executeRules(context.Background(), []string{"main.go"}, config)
+	assert.NoError(t, err)
+	assert.True(t, ran)
+	data, err := os.ReadFile(runs)
+	assert.NoError(t, err)
+	assert.Equal(t, "build\n", string(data))
+	assert.Contains(t, out.String(), "Skipping command while offline: echo deploy")
+	assert.Equal(t, int32(1), checks.Load(), "connectivity is checked once per cycle")
+
+	_, err = executeRules(context.Background(), []string{"main.go"}, config)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), checks.Load())
+}
+
+// Test that the connectivity check dials network_check_address
+func TestNetworkCheckAddress(t *testing.T) {
+	defer setConfig(Config{})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := listener.Addr().String()
+
+	setConfig(Config{NetworkCheckAddress: address})
+	assert.True(t, checkNetwork(context.Background()))
+
+	listener.Close()
+	assert.False(t, checkNetwork(context.Background()))
+
+	setConfig(Config{})
+	assert.Equal(t, defaultNetworkAddress, networkAddress())
+	assert.Equal(t, address, applyConfigFlags(Config{NetworkCheckAddress: address}).NetworkCheckAddress)
+	assert.Equal(t, defaultNetworkAddress, applyConfigFlags(Config{}).NetworkCheckAddress)
+	assert.ErrorContains(t, Config{NetworkCheckAddress: "1.1.1.1"}.Validate(), "invalid network check address")
+}
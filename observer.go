@@ -0,0 +1,128 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// EventKind identifies a step in the lifecycle of a rule run.
+type EventKind string
+
+const (
+	RuleStarted     EventKind = "rule_started"
+	CommandStarted  EventKind = "command_started"
+	CommandFinished EventKind = "command_finished"
+	RuleFinished    EventKind = "rule_finished"
+	// ChangeDetected is emitted for every change that is not ignored, with
+	// the changed path in Files.
+	ChangeDetected EventKind = "change_detected"
+	// CycleStarted and CycleFinished enclose the rules run for one batch of
+	// changes, with the batch's files in Files. CycleFinished is Failed
+	// when any rule failed.
+	CycleStarted  EventKind = "cycle_started"
+	CycleFinished EventKind = "cycle_finished"
+	// TestsSummarized is emitted once a command with an output_parser has
+	// finished, with the test counts found in its output in Tests. Rule is
+	// not set; RunID ties it to the rule's events.
+	TestsSummarized EventKind = "tests_summarized"
+	// BackgroundStarted and BackgroundFinished enclose the part of a
+	// parallel command that runs in the background, once it started and
+	// once its process exited; its CommandFinished comes right before
+	// BackgroundFinished. Rule is not set; RunID ties them to the rule's
+	// events.
+	BackgroundStarted  EventKind = "background_started"
+	BackgroundFinished EventKind = "background_finished"
+)
+
+// Event describes a rule or command lifecycle step, or a detected change.
+// Command fields are only set for command events; ExitCode, Duration and
+// Failed only for finished events.
+type Event struct {
+	Kind        EventKind
+	Time        time.Time
+	RunID       string // Shared by the events of one batch of changes
+	Rule        string
+	LogLevel    string // The rule's log_level, empty for the global level
+	Files       []string
+	Command     string
+	CommandName string
+	ExitCode    int
+	Duration    time.Duration
+	Failed      bool
+	Tests       *TestSummary // Only set for TestsSummarized
+}
+
+// Observer receives lifecycle events, e.g. to render a dashboard. Events are
+// delivered synchronously from the goroutine running the rule.
+type Observer interface {
+	OnEvent(Event)
+}
+
+// ObserverFunc adapts a function to the Observer interface.
+type ObserverFunc func(Event)
+
+func (f ObserverFunc) OnEvent(e Event) {
+	f(e)
+}
+
+// observerEntry wraps a registered observer so it can be removed by
+// identity, even when the observer itself is not comparable.
+type observerEntry struct {
+	observer Observer
+}
+
+var (
+	observersMu sync.Mutex
+	observers   = []*observerEntry{{logObserver{}}}
+)
+
+// AddObserver registers an observer and returns a function removing it.
+func AddObserver(o Observer) func() {
+	entry := &observerEntry{o}
+	observersMu.Lock()
+	defer observersMu.Unlock()
+	observers = append(observers, entry)
+	return func() {
+		observersMu.Lock()
+		defer observersMu.Unlock()
+		for i, registered := range observers {
+			if registered == entry {
+				observers = append(observers[:i:i], observers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// emit sends an event to every registered observer.
+func emit(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	observersMu.Lock()
+	registered := append([]*observerEntry(nil), observers...)
+	observersMu.Unlock()
+	for _, entry := range registered {
+		entry.observer.OnEvent(e)
+	}
+}
+
+// logObserver is the default observer writing events to the logger.
+type logObserver struct{}
+
+func (logObserver) OnEvent(e Event) {
+	l := logger
+	if e.RunID != "" {
+		l = logWith("run_id", e.RunID)
+	}
+	switch e.Kind {
+	case CommandStarted:
+		logAt(l, e.LogLevel, "Executing command: %s", e.Command)
+	case TestsSummarized:
+		l.Printf("Tests of %s: %s", e.Command, e.Tests)
+	case RuleFinished:
+		if e.Failed {
+			l.Printf("Rule %s failed after %s", e.Rule, e.Duration.Round(time.Millisecond))
+		}
+	}
+}
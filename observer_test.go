@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the lifecycle events emitted for one rule run
+func TestObserverEvents(t *testing.T) {
+	var events []Event
+	remove := AddObserver(ObserverFunc(func(e Event) {
+		events = append(events, e)
+	}))
+	defer remove()
+
+	config := Config{
+		Rules: []Rule{
+			{
+				Name:     "build",
+				Patterns: []string{"*.go"},
+				Commands: []Command{
+					{Name: "vet", Cmd: "true"},
+					{Name: "compile", Cmd: "exit 2"},
+				},
+			},
+		},
+	}
+	executeRules(context.Background(), []string{"main.go"}, config)
+
+	var kinds []EventKind
+	for _, e := range events {
+		kinds = append(kinds, e.Kind)
+		if e.Kind != CycleStarted && e.Kind != CycleFinished {
+			assert.Equal(t, "build", e.Rule)
+		}
+		assert.Equal(t, []string{"main.go"}, e.Files)
+		assert.Equal(t, events[0].RunID, e.RunID)
+	}
+	assert.Equal(t, []EventKind{
+		CycleStarted,
+		RuleStarted,
+		CommandStarted, CommandFinished,
+		CommandStarted, CommandFinished,
+		RuleFinished,
+		CycleFinished,
+	}, kinds)
+	events = events[1 : len(events)-1]
+
+	assert.Equal(t, "vet", events[1].CommandName)
+	assert.False(t, events[2].Failed)
+	assert.Equal(t, "compile", events[3].CommandName)
+	assert.Equal(t, "exit 2", events[4].Command)
+	assert.Equal(t, 2, events[4].ExitCode)
+	assert.True(t, events[4].Failed)
+	assert.True(t, events[5].Failed)
+
+	remove()
+	executeRules(context.Background(), []string{"main.go"}, config)
+	assert.Len(t, events, 6)
+}
+
+// Test that a parallel command finishes once its process exited, with its
+// outcome
+func TestObserverParallelCommand(t *testing.T) {
+	var mu sync.Mutex
+	var events []Event
+	defer AddObserver(ObserverFunc(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if e.Kind == CommandFinished || e.Kind == BackgroundFinished || e.Kind == RuleFinished {
+			events = append(events, e)
+		}
+	}))()
+
+	config := Config{
+		Rules: []Rule{{
+			Name:     "serve",
+			Patterns: []string{"*.go"},
+			Commands: []Command{{Cmd: "sleep 0.1; exit 3", Parallel: true}},
+		}},
+	}
+	_, err := executeRules(context.Background(), []string{"main.go"}, config)
+	assert.NoError(t, err)
+	runningCommands.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.Len(t, events, 3) {
+		assert.Equal(t, RuleFinished, events[0].Kind)
+		assert.Equal(t, CommandFinished, events[1].Kind)
+		assert.Equal(t, "serve", events[1].Rule)
+		assert.True(t, events[1].Failed)
+		assert.Equal(t, 3, events[1].ExitCode)
+		assert.GreaterOrEqual(t, events[1].Duration, 100*time.Millisecond)
+		assert.Equal(t, BackgroundFinished, events[2].Kind)
+		assert.True(t, events[2].Failed)
+	}
+}
+
+// Test that startup and initial commands emit command events too
+func TestObserverInitialCommands(t *testing.T) {
+	var events []Event
+	defer AddObserver(ObserverFunc(func(e Event) {
+		events = append(events, e)
+	}))()
+
+	config := Config{
+		Rules: []Rule{{Name: "build", Patterns: []string{"*.go"}, Commands: []Command{{Name: "compile", Cmd: "exit 2"}}}},
+	}
+	assert.NoError(t, executeInitialCommands(context.Background(), config))
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, CommandStarted, events[0].Kind)
+		assert.Equal(t, "build", events[0].Rule)
+		assert.Equal(t, "compile", events[0].CommandName)
+		assert.Equal(t, CommandFinished, events[1].Kind)
+		assert.True(t, events[1].Failed)
+		assert.Equal(t, 2, events[1].ExitCode)
+		assert.Equal(t, events[0].RunID, events[1].RunID)
+	}
+
+	events = nil
+	config.StartupCommands = []Command{{Cmd: "true"}}
+	assert.NoError(t, executeInitialCommands(context.Background(), config))
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, CommandStarted, events[0].Kind)
+		assert.Equal(t, "true", events[0].Command)
+		assert.Empty(t, events[0].Rule)
+		assert.Equal(t, CommandFinished, events[1].Kind)
+		assert.False(t, events[1].Failed)
+	}
+}
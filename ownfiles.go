@@ -0,0 +1,42 @@
+package main
+
+import "path/filepath"
+
+// ownFiles returns the absolute paths of the files go-watch itself writes:
+// the ready file, profiles and command output files. Changes to them are
+// ignored, so writing them inside a watched tree does not trigger rules.
+func ownFiles(config Config) []string {
+	paths := []string{config.ReadyFile, *cpuProfile, *memProfile}
+	commands := append([]Command(nil), config.StartupCommands...)
+	for _, rule := range config.Rules {
+		commands = append(commands, rule.Commands...)
+	}
+	for _, cmd := range commands {
+		paths = append(paths, cmd.StdoutFile, cmd.StderrFile)
+	}
+	var own []string
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			own = append(own, abs)
+		}
+	}
+	return own
+}
+
+// isOwnFile reports whether path is one of the files go-watch writes,
+// whether it is given relative to the working directory or absolute.
+func isOwnFile(path string, config Config) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for _, own := range ownFiles(config) {
+		if abs == own {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readPatternsFiles appends the patterns listed in the patterns_file of
+// each rule of config, which was read from path, to the rule's patterns.
+// Patterns files are resolved relative to path. Blank lines and lines
+// starting with "#" are skipped.
+func readPatternsFiles(path string, config Config) (Config, error) {
+	for i, rule := range config.Rules {
+		if rule.PatternsFile == "" {
+			continue
+		}
+		file := rule.PatternsFile
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(path), file)
+		}
+		patterns, err := readPatternsFile(file)
+		if err != nil {
+			return config, fmt.Errorf("%s: rule %q: patterns_file: %w", path, rule.Name, err)
+		}
+		rule.Patterns = append(rule.Patterns, patterns...)
+		// The patterns are part of the rule now, e.g. for --print-config
+		rule.PatternsFile = ""
+		config.Rules[i] = rule
+	}
+	return config, nil
+}
+
+func readPatternsFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var patterns []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, expandEnv(line))
+	}
+	return patterns, scanner.Err()
+}
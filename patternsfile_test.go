@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the entries of a patterns_file are matched and registered like
+// the rule's own patterns
+func TestPatternsFile(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+	watchedPaths.Clear()
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+	assert.NoError(t, os.MkdirAll(filepath.Join("config", "lists"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join("config", "lists", "go.txt"), []byte("# Go sources\n*.go\n\n  go.mod  \n"), 0644))
+	path := filepath.Join("config", "go-watch.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(`
+rules:
+  - name: build
+    patterns_file: lists/go.txt
+    patterns: ["*.sql"]
+    commands: [{cmd: "go build ./..."}]
+`), 0644))
+	for _, name := range []string{"main.go", "go.mod", "README.md"} {
+		assert.NoError(t, os.WriteFile(name, nil, 0644))
+	}
+
+	config, err := readConfigFile(path)
+	assert.NoError(t, err)
+	assert.NoError(t, config.Validate())
+	rule := config.Rules[0]
+	assert.Equal(t, []string{"*.sql", "*.go", "go.mod"}, rule.Patterns)
+	assert.Empty(t, rule.PatternsFile)
+
+	matched, _ := matchFiles(rule, []string{"main.go", "go.mod", "README.md"})
+	assert.Equal(t, []string{"main.go", "go.mod"}, matched)
+	assert.Equal(t, []string{"*.sql"}, addPatternsToWatcher(config))
+	assert.True(t, isWatched("main.go"))
+	assert.True(t, isWatched("go.mod"))
+	assert.False(t, isWatched("README.md"))
+
+	// A missing patterns file is an error
+	assert.NoError(t, os.WriteFile(path, []byte("rules: [{patterns_file: nope.txt, commands: [{cmd: \"true\"}]}]\n"), 0644))
+	_, err = readConfigFile(path)
+	assert.ErrorContains(t, err, "nope.txt")
+}
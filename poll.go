@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// fileState is the part of a file's metadata the poller compares between
+// scans.
+type fileState struct {
+	modTime time.Time
+	size    int64
+	mode    os.FileMode
+}
+
+// poller watches paths by periodically comparing their metadata. It is
+// used for paths the native watcher cannot handle and reports changes as
+// fsnotify events so they flow through the same event loop.
+type poller struct {
+	interval time.Duration
+	events   chan fsnotify.Event
+
+	mu    sync.Mutex
+	paths map[string]map[string]fileState // watched path -> entries
+}
+
+func newPoller(interval time.Duration) *poller {
+	return &poller{
+		interval: interval,
+		events:   make(chan fsnotify.Event),
+		paths:    make(map[string]map[string]fileState),
+	}
+}
+
+// Add starts polling a file, or the entries of a directory. A path already
+// polled keeps its snapshot, so no change is lost.
+func (p *poller) Add(path string) error {
+	if p.Watching(path) {
+		return nil
+	}
+	entries, err := scanPath(path)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.paths[path]; !ok {
+		p.paths[path] = entries
+	}
+	return nil
+}
+
+// Remove stops polling a path.
+func (p *poller) Remove(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.paths, path)
+}
+
+// Watching reports whether the path is being polled.
+func (p *poller) Watching(path string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.paths[path]
+	return ok
+}
+
+// Run polls every interval until ctx is cancelled.
+func (p *poller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, event := range p.scan() {
+				select {
+				case p.events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}
+}
+
+// scan compares every polled path with its last snapshot and returns the
+// resulting events.
+func (p *poller) scan() []fsnotify.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var events []fsnotify.Event
+	for path, before := range p.paths {
+		after, err := scanPath(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		for name, state := range after {
+			old, existed := before[name]
+			switch {
+			case !existed:
+				events = append(events, fsnotify.Event{Name: name, Op: fsnotify.Create})
+			case !state.modTime.Equal(old.modTime) || state.size != old.size:
+				events = append(events, fsnotify.Event{Name: name, Op: fsnotify.Write})
+			case state.mode != old.mode:
+				events = append(events, fsnotify.Event{Name: name, Op: fsnotify.Chmod})
+			}
+		}
+		for name := range before {
+			if _, exists := after[name]; !exists {
+				events = append(events, fsnotify.Event{Name: name, Op: fsnotify.Remove})
+			}
+		}
+		p.paths[path] = after
+	}
+	return events
+}
+
+// scanPath returns the state of a file, or of the direct entries of a
+// directory, keyed by path.
+func scanPath(path string) (map[string]fileState, error) {
+	entries := make(map[string]fileState)
+	info, err := os.Stat(path)
+	if err != nil {
+		return entries, err
+	}
+	if !info.IsDir() {
+		entries[path] = fileState{info.ModTime(), info.Size(), info.Mode()}
+		return entries, nil
+	}
+	dirEntries, err := os.ReadDir(path)
+	if err != nil {
+		return entries, err
+	}
+	for _, entry := range dirEntries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		entries[filepath.Join(path, entry.Name())] = fileState{info.ModTime(), info.Size(), info.Mode()}
+	}
+	return entries, nil
+}
+
+// isPollable reports whether a watcher error means the native watcher
+// cannot handle the path, as opposed to the path itself being unusable.
+func isPollable(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || // inotify watch limit reached
+		errors.Is(err, syscall.EMFILE) ||
+		errors.Is(err, syscall.ENFILE) ||
+		errors.Is(err, syscall.ENOSYS) ||
+		errors.Is(err, syscall.ENOTSUP) ||
+		errors.Is(err, syscall.EOPNOTSUPP)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that a path the native watcher rejects is polled instead
+func TestPollFallback(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "main.go")
+	assert.NoError(t, os.WriteFile(target, []byte("package main"), 0644))
+
+	originalAdd := addWatch
+	addWatch = func(path string) error {
+		return fmt.Errorf("add %s: %w", path, syscall.ENOSPC)
+	}
+	fallbackPoller = newPoller(20 * time.Millisecond)
+	defer func() {
+		addWatch = originalAdd
+		fallbackPoller = nil
+	}()
+	watchedPaths.Clear()
+	defer watchedPaths.Clear()
+	var out syncBuffer
+	logger.SetOutput(&out)
+	defer logger.SetOutput(os.Stdout)
+
+	assert.Equal(t, 1, watchPattern(filepath.Join(dir, "*.go"), Config{}))
+	assert.True(t, fallbackPoller.Watching(target))
+	assert.True(t, isWatched(target))
+	assert.True(t, watchedPaths.Polled(target))
+
+	// Retrying the pattern leaves the polled path alone
+	assert.Equal(t, 1, watchPattern(filepath.Join(dir, "*.go"), Config{}))
+	assert.Equal(t, 1, strings.Count(out.String(), "Falling back to polling"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go fallbackPoller.Run(ctx)
+
+	// Make sure the modification time differs from the snapshot
+	later := time.Now().Add(time.Second)
+	assert.NoError(t, os.WriteFile(target, []byte("package main // changed"), 0644))
+	assert.NoError(t, os.Chtimes(target, later, later))
+
+	select {
+	case event := <-fallbackPoller.events:
+		assert.Equal(t, target, event.Name)
+	case <-time.After(2 * time.Second):
+		t.Fatal("change to polled path not detected")
+	}
+
+	// Releasing the path stops polling it
+	pattern, ok := releaseWatch(target)
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(dir, "*.go"), pattern)
+	assert.False(t, fallbackPoller.Watching(target))
+}
+
+// Test that adding a polled path again keeps its snapshot
+func TestPollerAddTwice(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "main.go")
+	assert.NoError(t, os.WriteFile(target, []byte("package main"), 0644))
+	p := newPoller(time.Hour)
+	assert.NoError(t, p.Add(target))
+
+	later := time.Now().Add(time.Second)
+	assert.NoError(t, os.WriteFile(target, []byte("package main // changed"), 0644))
+	assert.NoError(t, os.Chtimes(target, later, later))
+	assert.NoError(t, p.Add(target))
+	assert.Len(t, p.scan(), 1, "the change before the second add was lost")
+}
+
+// Test which watcher errors allow falling back to polling
+func TestIsPollable(t *testing.T) {
+	assert.True(t, isPollable(fmt.Errorf("wrapped: %w", syscall.ENOSPC)))
+	assert.True(t, isPollable(syscall.EMFILE))
+	assert.False(t, isPollable(syscall.ENOENT))
+	assert.False(t, isPollable(syscall.EACCES))
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// newProcessGroup makes the command the leader of a new process group, so
+// the processes it spawns can be signalled along with it. Commands under a
+// pty get a session, and so a group, of their own already.
+func newProcessGroup(command *exec.Cmd) {
+	if command.SysProcAttr == nil {
+		command.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	command.SysProcAttr.Setpgid = true
+}
+
+// signalGroup sends sig to the process group led by the command.
+func signalGroup(command *exec.Cmd, sig syscall.Signal) error {
+	return syscall.Kill(-command.Process.Pid, sig)
+}
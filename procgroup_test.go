@@ -0,0 +1,73 @@
+//go:build !windows
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// processAlive reports whether a process exists and is not a zombie left
+// for a parent that does not reap it.
+func processAlive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		// Without /proc, as on macOS, signal 0 is all there is to go by
+		_, procErr := os.Stat("/proc/self")
+		return procErr != nil
+	}
+	// The state follows the parenthesized command name
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
+
+// Test that stopping a command also stops the processes it spawned
+func TestProcessGroupStopped(t *testing.T) {
+	logger.SetOutput(&syncBuffer{})
+	defer logger.SetOutput(os.Stdout)
+
+	for _, stop := range []string{"restart", "shutdown"} {
+		t.Run(stop, func(t *testing.T) {
+			pidFile := filepath.Join(t.TempDir(), "child.pid")
+			cmd := Command{
+				Cmd:      "sleep 30 & echo $! > " + pidFile + "; wait # " + stop,
+				Parallel: true,
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			assert.NoError(t, executeCommand(ctx, cmd, ""))
+
+			var pid int
+			assert.Eventually(t, func() bool {
+				data, err := os.ReadFile(pidFile)
+				if err != nil || !bytes.HasSuffix(data, []byte("\n")) {
+					return false
+				}
+				pid, err = strconv.Atoi(strings.TrimSpace(string(data)))
+				return err == nil
+			}, 2*time.Second, 10*time.Millisecond)
+			assert.True(t, processAlive(pid))
+
+			if stop == "restart" {
+				stopProcess(cmd.String())
+			} else {
+				cancel()
+			}
+			runningCommands.Wait()
+			assert.Eventually(t, func() bool { return !processAlive(pid) }, 2*time.Second, 10*time.Millisecond,
+				"background child %d survived", pid)
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// newProcessGroup does nothing on Windows, where only the command itself
+// is signalled.
+func newProcessGroup(command *exec.Cmd) {}
+
+// signalGroup sends sig to the command. Windows can only kill processes.
+func signalGroup(command *exec.Cmd, sig syscall.Signal) error {
+	if sig == syscall.SIGKILL {
+		return command.Process.Kill()
+	}
+	return command.Process.Signal(sig)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the profile flags write their files on shutdown
+func TestStartProfiling(t *testing.T) {
+	dir := t.TempDir()
+	cpuPath := filepath.Join(dir, "cpu.pprof")
+	memPath := filepath.Join(dir, "mem.pprof")
+
+	stop, err := startProfiling(cpuPath, memPath)
+	assert.NoError(t, err)
+	sum := 0
+	for i := 0; i < 1000000; i++ {
+		sum += i
+	}
+	stop()
+
+	for _, path := range []string{cpuPath, memPath} {
+		info, err := os.Stat(path)
+		if assert.NoError(t, err) {
+			assert.NotZero(t, info.Size())
+		}
+	}
+
+	_, err = startProfiling(filepath.Join(dir, "missing", "cpu.pprof"), "")
+	assert.Error(t, err)
+}
+
+// Test that the profile flags are left out of the usage message
+func TestUsageHidesProfileFlags(t *testing.T) {
+	var out bytes.Buffer
+	flag.CommandLine.SetOutput(&out)
+	defer flag.CommandLine.SetOutput(nil)
+
+	usage()
+	assert.Contains(t, out.String(), "-debounce-time")
+	assert.NotContains(t, out.String(), "  -cpuprofile")
+	assert.NotContains(t, out.String(), "  -memprofile")
+}
@@ -0,0 +1,64 @@
+//go:build !windows
+
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+// startPTY starts the command attached to a new pseudo-terminal and copies
+// the terminal output to out. The terminal follows the size of go-watch's
+// own terminal, if any. The returned function waits for the output to be
+// copied and releases the terminal; call it once the command has exited.
+func startPTY(command *exec.Cmd, out io.Writer) (func(), error) {
+	// pty.Start only attaches the streams that are not set yet
+	command.Stdin, command.Stdout, command.Stderr = nil, nil, nil
+	ptmx, err := pty.Start(command)
+	if err != nil {
+		return nil, err
+	}
+
+	resize := make(chan os.Signal, 1)
+	stopResize := make(chan struct{})
+	if isTerminal(os.Stdout) {
+		_ = pty.InheritSize(os.Stdout, ptmx)
+		signal.Notify(resize, syscall.SIGWINCH)
+		go func() {
+			for {
+				select {
+				case <-resize:
+					_ = pty.InheritSize(os.Stdout, ptmx)
+				case <-stopResize:
+					return
+				}
+			}
+		}()
+	}
+
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		// Reading fails with EIO once the command closed the terminal
+		_, _ = io.Copy(out, ptmx)
+	}()
+
+	return func() {
+		signal.Stop(resize)
+		close(stopResize)
+		// A background child may keep the terminal open; stop waiting for
+		// its output after the same grace period as a cancelled command.
+		select {
+		case <-copied:
+		case <-time.After(commandWaitDelay):
+		}
+		ptmx.Close()
+		<-copied
+	}, nil
+}
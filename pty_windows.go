@@ -0,0 +1,12 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+)
+
+// startPTY is not available on Windows.
+func startPTY(command *exec.Cmd, out io.Writer) (func(), error) {
+	return nil, errors.New("pty is not supported on Windows")
+}
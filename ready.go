@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// readyFile maintains the ready_file health signal: the file exists while
+// go-watch is watching and neither a rule nor a parallel command is
+// running, and is removed while they run. Each time go-watch becomes idle
+// the file is rewritten, so its modification time tells when that
+// happened.
+type readyFile struct {
+	path string
+
+	mu      sync.Mutex
+	running int
+}
+
+// OnEvent tracks the running rules and parallel commands.
+func (r *readyFile) OnEvent(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch e.Kind {
+	case RuleStarted, BackgroundStarted:
+		r.running++
+		if r.running == 1 {
+			r.remove()
+		}
+	case RuleFinished, BackgroundFinished:
+		r.running--
+		if r.running == 0 {
+			r.write()
+		}
+	}
+}
+
+// write marks go-watch as idle.
+func (r *readyFile) write() {
+	content := fmt.Sprintf("idle since %s\n", time.Now().Format(time.RFC3339))
+	if err := os.WriteFile(r.path, []byte(content), 0644); err != nil {
+		logger.Printf("Failed to write ready file %s: %v", r.path, err)
+	}
+}
+
+// remove marks go-watch as busy or gone.
+func (r *readyFile) remove() {
+	if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+		logger.Printf("Failed to remove ready file %s: %v", r.path, err)
+	}
+}
+
+// startReadyFile writes the ready file and keeps it up to date until the
+// returned function is called, which removes it.
+func startReadyFile(path string) func() {
+	r := &readyFile{path: path}
+	r.write()
+	removeObserver := AddObserver(r)
+	return func() {
+		removeObserver()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.remove()
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the ready file exists while idle and is removed during a run
+func TestReadyFile(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	dir := t.TempDir()
+	trigger := filepath.Join(dir, "main.go")
+	assert.NoError(t, os.WriteFile(trigger, nil, 0644))
+	ready := filepath.Join(t.TempDir(), "ready")
+	started := filepath.Join(t.TempDir(), "started")
+	config := Config{
+		ReadyFile: ready,
+		Rules: []Rule{{
+			Patterns: []string{trigger},
+			Commands: []Command{{Cmd: "touch " + started + "; sleep 0.5"}},
+		}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- watchLoop(ctx, config, 50*time.Millisecond, 0)
+	}()
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(ready)
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond, "ready file not written once idle")
+	idle, err := os.Stat(ready)
+	assert.NoError(t, err)
+
+	// Modification times may be too coarse to tell two writes apart
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, os.WriteFile(trigger, []byte("package main"), 0644))
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(started)
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond, "rule did not run")
+	assert.NoFileExists(t, ready, "ready file kept while a rule runs")
+
+	assert.Eventually(t, func() bool {
+		info, err := os.Stat(ready)
+		return err == nil && info.ModTime().After(idle.ModTime())
+	}, 2*time.Second, 10*time.Millisecond, "ready file not rewritten after the run")
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch loop did not exit")
+	}
+	assert.NoFileExists(t, ready, "ready file kept after shutdown")
+}
+
+// Test that writing the ready file inside a watched directory does not
+// trigger the rules watching it
+func TestReadyFileNotSelfTriggering(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	trigger := filepath.Join(dir, "main.go")
+	assert.NoError(t, os.WriteFile(trigger, nil, 0644))
+	runs := filepath.Join(t.TempDir(), "runs.txt")
+	config := Config{
+		// Relative, while the pattern and the watcher use absolute paths
+		ReadyFile: "ready",
+		Rules: []Rule{{
+			WatchDirs: []string{dir},
+			Commands:  []Command{{Cmd: "echo {{.Base}} >> " + runs}},
+		}},
+	}
+	assert.True(t, isOwnFile(filepath.Join(dir, "ready"), config))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- watchLoop(ctx, config, 50*time.Millisecond, 0)
+	}()
+	time.Sleep(200 * time.Millisecond)
+	assert.FileExists(t, filepath.Join(dir, "ready"))
+	assert.NoFileExists(t, runs, "writing the ready file triggered the rule")
+
+	assert.NoError(t, os.WriteFile(trigger, []byte("package main"), 0644))
+	time.Sleep(500 * time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch loop did not exit")
+	}
+	data, err := os.ReadFile(runs)
+	assert.NoError(t, err)
+	assert.Equal(t, "main.go\n", string(data))
+}
+
+// Test that parallel commands still running after their rule finished keep
+// go-watch busy
+func TestReadyFileParallelCommands(t *testing.T) {
+	ready := filepath.Join(t.TempDir(), "ready")
+	stop := startReadyFile(ready)
+	defer stop()
+	assert.FileExists(t, ready)
+
+	config := Config{
+		Rules: []Rule{{
+			Patterns: []string{"*.go"},
+			Commands: []Command{{Cmd: "sleep 0.3", Parallel: true}},
+		}},
+	}
+	_, err := executeBatch(context.Background(), ruleBatch{files: []string{"main.go"}}, config)
+	assert.NoError(t, err)
+	assert.NoFileExists(t, ready, "ready file written while a parallel command runs")
+
+	runningCommands.Wait()
+	assert.FileExists(t, ready, "ready file not written once the parallel command exited")
+}
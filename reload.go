@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reloadSignals are the signals that reload the configuration file.
+var reloadSignals = []os.Signal{syscall.SIGHUP}
@@ -0,0 +1,62 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that SIGHUP reloads the configuration file without waiting for the
+// edit to settle
+func TestReloadSignal(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "main.go")
+	assert.NoError(t, os.WriteFile(source, nil, 0644))
+	out := filepath.Join(t.TempDir(), "runs.txt")
+	configYAML := func(name string) []byte {
+		return []byte("rules:\n  - name: " + name + "\n    patterns: [\"" + source + "\"]\n    commands:\n      - cmd: \"echo " + name + " >> " + out + "\"\n")
+	}
+	path := filepath.Join(t.TempDir(), "go-watch.yaml")
+	assert.NoError(t, os.WriteFile(path, configYAML("old"), 0644))
+	config, err := loadConfig(path)
+	assert.NoError(t, err)
+	defer func() { configPath = "" }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	// The debounce also delays reloading the edited file, which SIGHUP
+	// must not wait for
+	go func() {
+		done <- watchLoop(ctx, config, time.Second, 0)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	assert.NoError(t, os.WriteFile(path, configYAML("new"), 0644))
+	assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	assert.Eventually(t, func() bool {
+		return currentConfig().Rules[0].Name == "new"
+	}, 500*time.Millisecond, 10*time.Millisecond, "SIGHUP did not reload the configuration")
+
+	assert.NoError(t, os.WriteFile(source, []byte("package main"), 0644))
+	assert.Eventually(t, func() bool {
+		data, _ := os.ReadFile(out)
+		return string(data) == "new\n"
+	}, 5*time.Second, 10*time.Millisecond, "the reloaded rule did not run")
+	cancel()
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,6 @@
+package main
+
+import "os"
+
+// reloadSignals is empty on Windows, which has no SIGHUP.
+var reloadSignals []os.Signal
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// replaySignals are the signals that replay the last run cycle.
+var replaySignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,68 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that SIGUSR1 replays the last run cycle
+func TestReplayLastCycle(t *testing.T) {
+	history = nil
+	defer func() { history = nil }()
+
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "main.go")
+	other := filepath.Join(dir, "util.go")
+	assert.NoError(t, os.WriteFile(source, nil, 0644))
+	assert.NoError(t, os.WriteFile(other, nil, 0644))
+	out := filepath.Join(t.TempDir(), "runs.txt")
+	config := Config{
+		Rules: []Rule{
+			{Name: "build", Patterns: []string{source}, Commands: []Command{{Cmd: "echo build {{.Base}} >> " + out}}},
+			{Name: "lint", Patterns: []string{other}, Commands: []Command{{Cmd: "echo lint {{.Base}} >> " + out}}},
+		},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- watchLoop(context.Background(), config, 50*time.Millisecond, 2)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, os.WriteFile(source, []byte("package main"), 0644))
+	assert.Eventually(t, func() bool {
+		_, ok := lastCycle()
+		return ok
+	}, 2*time.Second, 10*time.Millisecond, "cycle not recorded")
+
+	assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGUSR1 did not replay the cycle")
+	}
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "build main.go\nbuild main.go\n", string(data))
+
+	last, _ := lastCycle()
+	assert.Equal(t, []string{source}, last.Batch.files)
+	for range historySize + 2 {
+		recordCycle(ruleBatch{}, nil)
+	}
+	assert.Len(t, history, historySize)
+}
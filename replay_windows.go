@@ -0,0 +1,6 @@
+package main
+
+import "os"
+
+// replaySignals is empty on Windows, which has no SIGUSR1.
+var replaySignals []os.Signal
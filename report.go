@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// matchOutput receives the match reports of --no-exec.
+var matchOutput io.Writer = os.Stdout
+
+// MatchReport is the JSON form of a --no-exec match: a rule and the files
+// of the batch it matched.
+type MatchReport struct {
+	Rule    string   `json:"rule,omitempty"`
+	Pattern string   `json:"pattern"`
+	Files   []string `json:"files"`
+}
+
+// reportMatch writes a rule match for --no-exec. Text output has one line
+// per file: the rule name, or its pattern when unnamed, a tab and the file.
+func reportMatch(w io.Writer, rule Rule, pattern string, files []string) {
+	if *logFormat == "json" {
+		_ = json.NewEncoder(w).Encode(MatchReport{Rule: rule.Name, Pattern: pattern, Files: files})
+		return
+	}
+	label := rule.Name
+	if label == "" {
+		label = pattern
+	}
+	for _, file := range files {
+		fmt.Fprintf(w, "%s\t%s\n", label, file)
+	}
+}
+
+// jsonLogWriter turns each log line into a JSON object with the time,
+// level and message, followed by its fields.
+type jsonLogWriter struct {
+	w      io.Writer
+	fields []logField
+}
+
+func (j jsonLogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	level := "info"
+	if rest, ok := strings.CutPrefix(msg, "[debug] "); ok {
+		level, msg = "debug", rest
+	}
+	line, err := json.Marshal(struct {
+		Time  string `json:"time"`
+		Level string `json:"level"`
+		Msg   string `json:"msg"`
+	}{time.Now().Format(time.RFC3339), level, msg})
+	if err != nil {
+		return 0, err
+	}
+	// The fields go after the message, in the order they were attached
+	line = line[:len(line)-1]
+	for _, field := range j.fields {
+		key, _ := json.Marshal(field.key)
+		value, _ := json.Marshal(field.value)
+		line = append(append(append(append(line, ','), key...), ':'), value...)
+	}
+	if _, err := j.w.Write(append(line, '}', '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// logField is a key and value attached to every line of a logger.
+type logField struct {
+	key, value string
+}
+
+// fieldWriter appends its fields to each text log line as key=value.
+type fieldWriter struct {
+	w      io.Writer
+	fields []logField
+}
+
+func (f fieldWriter) Write(p []byte) (int, error) {
+	var sb strings.Builder
+	sb.WriteString(strings.TrimSuffix(string(p), "\n"))
+	for _, field := range f.fields {
+		fmt.Fprintf(&sb, " %s=%s", field.key, field.value)
+	}
+	sb.WriteByte('\n')
+	if _, err := io.WriteString(f.w, sb.String()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// logWith returns a logger writing where logger does, with a field
+// attached to every line, like slog's Logger.With: a JSON field with
+// --log-format json, and key=value at the end of text lines.
+func logWith(key, value string) *log.Logger {
+	field := logField{key, value}
+	var w io.Writer
+	switch out := logger.Writer().(type) {
+	case jsonLogWriter:
+		out.fields = append(slices.Clone(out.fields), field)
+		w = out
+	case fieldWriter:
+		out.fields = append(slices.Clone(out.fields), field)
+		w = out
+	default:
+		w = fieldWriter{out, []logField{field}}
+	}
+	return log.New(w, logger.Prefix(), logger.Flags())
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+// retryable reports whether a failed command is run again: its failure has
+// one of its retry_exit_codes, or any failure when none are listed.
+func retryable(cmd Command, err error) bool {
+	if len(cmd.RetryExitCodes) == 0 {
+		return true
+	}
+	var cmdErr *CommandError
+	return errors.As(err, &cmdErr) && slices.Contains(cmd.RetryExitCodes, cmdErr.ExitCode)
+}
+
+// executeWithRetries runs a command like executeCommand, running it again
+// up to its retries times while it fails with a retryable error, waiting
+// retry_delay in between. Parallel commands are not retried.
+func executeWithRetries(ctx context.Context, cmd Command, file string) error {
+	if cmd.Retries == 0 || cmd.Parallel {
+		return executeCommand(ctx, cmd, file)
+	}
+	// The manifest must outlive every attempt
+	defer removeManifest(cmd)
+	attempt := cmd
+	attempt.manifest = ""
+	delay, _ := time.ParseDuration(cmd.RetryDelay)
+
+	err := executeCommand(ctx, attempt, file)
+	for i := 1; err != nil && i <= cmd.Retries && retryable(cmd, err); i++ {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		cycleLogger(ctx).Printf("Retrying command (%d/%d): %s", i, cmd.Retries, cmd)
+		err = executeCommand(ctx, attempt, file)
+	}
+	return err
+}
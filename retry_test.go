@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that retry_exit_codes retries only failures with the listed codes
+func TestRetryExitCodes(t *testing.T) {
+	// runs returns how often a command exiting with code ran
+	runs := func(code string) int {
+		out := filepath.Join(t.TempDir(), "runs.txt")
+		rule := Rule{Commands: []Command{{
+			Cmd:            "echo run >> " + out + "; exit " + code,
+			Retries:        2,
+			RetryExitCodes: []int{2, 75},
+		}}}
+		assert.NoError(t, Config{Rules: []Rule{rule}}.Validate())
+		report, err := runRule(context.Background(), rule, []string{"main.go"}, "*.go", failureContinue)
+		assert.NoError(t, err)
+		assert.True(t, report.Failed())
+		data, err := os.ReadFile(out)
+		assert.NoError(t, err)
+		return strings.Count(string(data), "run")
+	}
+
+	assert.Equal(t, 1, runs("1"), "a non-retry exit code was retried")
+	assert.Equal(t, 3, runs("75"), "a retry exit code was not retried")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+)
+
+// executeRulesParallel is executeBatch with rules_parallel: every rule runs
+// in its own goroutine once the rules it needs are done, with at most
+// max_parallel rules running at once. rules must be free of need cycles.
+// Reports are returned in the order of rules, and the first error of that
+// order is returned once every rule is done. schedule holds the
+// debounce_jitter start time of each rule.
+func executeRulesParallel(ctx context.Context, rules []Rule, batch ruleBatch, config Config, schedule []time.Time) ([]RunReport, error) {
+	limit := config.MaxParallel
+	if limit <= 0 {
+		limit = len(rules)
+	}
+	slots := make(chan struct{}, limit)
+	// done is closed for each named rule once it finished or was skipped.
+	done := make(map[string]chan struct{})
+	for _, rule := range rules {
+		if rule.Name != "" {
+			done[rule.Name] = make(chan struct{})
+		}
+	}
+	var failedMu sync.Mutex
+	failed := make(map[string]bool)
+
+	reports := make([]*RunReport, len(rules))
+	errs := make([]error, len(rules))
+	var wg sync.WaitGroup
+	for i, rule := range rules {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rule.Name != "" {
+				defer close(done[rule.Name])
+			}
+			for _, need := range rule.Needs {
+				if ch, ok := done[need]; ok {
+					<-ch
+				}
+			}
+			slots <- struct{}{}
+			failedMu.Lock()
+			needsFailed := maps.Clone(failed)
+			failedMu.Unlock()
+			reports[i], errs[i] = executeRule(ctx, rule, batch, config, needsFailed, schedule[i])
+			<-slots
+			if report := reports[i]; report != nil && rule.Name != "" && (report.Skipped || report.Failed()) {
+				failedMu.Lock()
+				failed[rule.Name] = true
+				failedMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	var collected []RunReport
+	var firstErr error
+	for i, report := range reports {
+		if report != nil {
+			collected = append(collected, *report)
+		}
+		if firstErr == nil {
+			firstErr = errs[i]
+		}
+	}
+	return collected, firstErr
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that rules_parallel runs independent rules concurrently, within
+// max_parallel, and still runs a rule after the rules it needs
+func TestRulesParallel(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "main.go")
+	assert.NoError(t, os.WriteFile(file, nil, 0644))
+	rule := func(name string, needs ...string) Rule {
+		return Rule{Name: name, Needs: needs, Patterns: []string{file}, Commands: []Command{{Cmd: "sleep 0.2"}}}
+	}
+
+	// events runs the batch and returns the rule events in the order seen
+	events := func(config Config) []string {
+		var mu sync.Mutex
+		var seen []string
+		defer AddObserver(ObserverFunc(func(e Event) {
+			mu.Lock()
+			defer mu.Unlock()
+			switch e.Kind {
+			case RuleStarted:
+				seen = append(seen, "start "+e.Rule)
+			case RuleFinished:
+				seen = append(seen, "finish "+e.Rule)
+			}
+		}))()
+		assert.NoError(t, config.Validate())
+		reports, err := executeBatch(context.Background(), ruleBatch{files: []string{file}}, config)
+		assert.NoError(t, err)
+		assert.Len(t, reports, len(config.Rules))
+		mu.Lock()
+		defer mu.Unlock()
+		return seen
+	}
+
+	seen := events(Config{RulesParallel: boolPtr(true), Rules: []Rule{rule("build"), rule("lint")}})
+	if assert.Len(t, seen, 4) {
+		assert.ElementsMatch(t, []string{"start build", "start lint"}, seen[:2], "rules did not run concurrently")
+	}
+
+	seen = events(Config{RulesParallel: boolPtr(true), MaxParallel: 1, Rules: []Rule{rule("build"), rule("lint")}})
+	if assert.Len(t, seen, 4) {
+		assert.Contains(t, seen[1], "finish", "max_parallel was exceeded")
+	}
+
+	seen = events(Config{RulesParallel: boolPtr(true), Rules: []Rule{rule("test", "build"), rule("build")}})
+	assert.Equal(t, []string{"start build", "finish build", "start test", "finish test"}, seen)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+)
+
+type (
+	runIDKey     struct{}
+	runLoggerKey struct{}
+)
+
+// newRunID returns a random identifier for a run cycle.
+func newRunID() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// withRunID returns a context carrying a new run ID, shared by every rule
+// and command run for one batch of changes, and a logger attaching it to
+// each line as run_id.
+func withRunID(ctx context.Context) context.Context {
+	id := newRunID()
+	ctx = context.WithValue(ctx, runIDKey{}, id)
+	return context.WithValue(ctx, runLoggerKey{}, logWith("run_id", id))
+}
+
+// cycleLogger returns the logger of the run cycle of ctx, or logger outside
+// a run cycle.
+func cycleLogger(ctx context.Context) *log.Logger {
+	if l, ok := ctx.Value(runLoggerKey{}).(*log.Logger); ok {
+		return l
+	}
+	return logger
+}
+
+// runID returns the run ID of ctx, or "" outside a run cycle.
+func runID(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the commands run for one batch share its run ID
+func TestRunID(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.go")
+	assert.NoError(t, os.WriteFile(file, []byte("a"), 0644))
+	out := filepath.Join(t.TempDir(), "ids.txt")
+
+	config := Config{
+		Rules: []Rule{
+			{Name: "build", Patterns: []string{file}, Commands: []Command{{Cmd: "echo $GOWATCH_RUN_ID >> " + out}}},
+			{Name: "lint", Patterns: []string{file}, Commands: []Command{{Cmd: "echo {{.RunID}} >> " + out}}},
+		},
+	}
+	assert.NoError(t, config.Validate())
+
+	var log syncBuffer
+	logger.SetOutput(&log)
+	defer logger.SetOutput(os.Stdout)
+
+	batch := ruleBatch{files: []string{file}}
+	reports, err := executeBatch(context.Background(), batch, config)
+	assert.NoError(t, err)
+	_, err = executeBatch(context.Background(), batch, config)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	ids := strings.Fields(string(data))
+	if assert.Len(t, ids, 4) {
+		assert.NotEmpty(t, ids[0])
+		assert.Equal(t, ids[0], ids[1], "commands of one batch got different run IDs")
+		assert.Equal(t, ids[2], ids[3])
+		assert.NotEqual(t, ids[0], ids[2], "batches share a run ID")
+		for _, report := range reports {
+			assert.Equal(t, ids[0], report.RunID)
+		}
+		assert.Contains(t, log.String(), "Executing command: echo $GOWATCH_RUN_ID >> "+out+" run_id="+ids[0])
+	}
+}
+
+// Test that go-watch's own log lines of a cycle carry its run ID
+func TestRunIDLogLines(t *testing.T) {
+	var out syncBuffer
+	logger.SetOutput(&out)
+	defer logger.SetOutput(os.Stdout)
+
+	ctx := withRunID(context.Background())
+	id := runID(ctx)
+	cycleLogger(ctx).Printf("Skipping rule build")
+	assert.Contains(t, out.String(), "Skipping rule build run_id="+id+"\n")
+	cycleLogger(context.Background()).Printf("outside a cycle")
+	assert.NotContains(t, out.String(), "outside a cycle run_id")
+
+	// With --log-format json the run ID is a field of its own
+	out.Reset()
+	logger.SetOutput(jsonLogWriter{w: &out})
+	ctx = withRunID(context.Background())
+	cycleLogger(ctx).Printf("Command failed")
+	var line map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(out.String()), &line))
+	assert.True(t, strings.HasSuffix(line["msg"], "Command failed"), line["msg"])
+	assert.Equal(t, runID(ctx), line["run_id"])
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+)
+
+// RunSummary is the JSON written to --summary-file on shutdown: the files
+// that triggered the rules and the report of every rule run.
+type RunSummary struct {
+	Files  []string    `json:"files"`
+	Rules  []RunReport `json:"rules"`
+	Failed bool        `json:"failed"`
+}
+
+// add records the reports of a run cycle.
+func (s *RunSummary) add(reports []RunReport) {
+	for _, file := range reportedFiles(reports) {
+		if !slices.Contains(s.Files, file) {
+			s.Files = append(s.Files, file)
+		}
+	}
+	for _, report := range reports {
+		s.Rules = append(s.Rules, report)
+		if report.Failed() {
+			s.Failed = true
+		}
+	}
+}
+
+// writeSummary writes the summary to path as indented JSON.
+func writeSummary(path string, summary RunSummary) error {
+	if summary.Files == nil {
+		summary.Files = []string{}
+	}
+	if summary.Rules == nil {
+		summary.Rules = []RunReport{}
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
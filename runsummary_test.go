@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that --once --summary-file writes the triggering files and the
+// result of every command
+func TestSummaryFile(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	dir := t.TempDir()
+	source := filepath.Join(dir, "main.go")
+	assert.NoError(t, os.WriteFile(source, nil, 0644))
+	path := filepath.Join(t.TempDir(), "summary.json")
+	*summaryFile = path
+	defer func() { *summaryFile = "" }()
+
+	config := Config{
+		OnFailure: failureContinue,
+		Rules: []Rule{{
+			Name:     "test",
+			Patterns: []string{filepath.Join(dir, "*.go")},
+			Commands: []Command{{Name: "vet", Cmd: "exit 3"}, {Cmd: "true"}},
+		}},
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- watchLoop(context.Background(), config, 50*time.Millisecond, 1)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, os.WriteFile(source, []byte("package main"), 0644))
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch loop did not stop after one cycle")
+	}
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	var summary RunSummary
+	assert.NoError(t, json.Unmarshal(data, &summary))
+	assert.Equal(t, []string{source}, summary.Files)
+	assert.True(t, summary.Failed)
+	if assert.Len(t, summary.Rules, 1) {
+		rule := summary.Rules[0]
+		assert.Equal(t, "test", rule.Rule)
+		assert.Equal(t, []string{source}, rule.Files)
+		if assert.Len(t, rule.Commands, 2) {
+			assert.Equal(t, "vet", rule.Commands[0].Name)
+			assert.Equal(t, 3, rule.Commands[0].ExitCode)
+			assert.Equal(t, "true", rule.Commands[1].Cmd)
+			assert.Equal(t, 0, rule.Commands[1].ExitCode)
+		}
+	}
+	assert.Contains(t, string(data), `"duration_ms"`)
+}
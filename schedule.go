@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Values of Rule.OutsideHours.
+const (
+	outsideHoursIgnore = "ignore"
+	outsideHoursQueue  = "queue"
+)
+
+// now returns the current time. It is a variable so tests can simulate
+// the time of day.
+var now = time.Now
+
+var (
+	// queuedOutsideHours holds the files matched outside the active hours
+	// of rules with outside_hours: queue, by ruleKey, until the window
+	// opens. A rule has an entry while a deferred batch is scheduled for
+	// it. Guarded by queuedOutsideHoursMu.
+	queuedOutsideHours   = make(map[string][]string)
+	queuedOutsideHoursMu sync.Mutex
+)
+
+// parseActiveHours parses a window such as "09:00-18:00" into minutes
+// since midnight. A window whose end is before its start spans midnight.
+func parseActiveHours(spec string) (start, end int, err error) {
+	from, to, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid active hours %q, want HH:MM-HH:MM", spec)
+	}
+	if start, err = parseClock(from); err != nil {
+		return 0, 0, err
+	}
+	if end, err = parseClock(to); err != nil {
+		return 0, 0, err
+	}
+	if start == end {
+		return 0, 0, fmt.Errorf("active hours %q are empty", spec)
+	}
+	return start, end, nil
+}
+
+// parseClock parses a time of day such as "09:30" into minutes since
+// midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// activeAt reports whether t, in its own time zone, falls within the
+// rule's active hours. When it does not, wait is how long until the window
+// opens. Rules without active hours are always active.
+func activeAt(rule Rule, t time.Time) (active bool, wait time.Duration) {
+	if rule.ActiveHours == "" {
+		return true, 0
+	}
+	start, end, err := parseActiveHours(rule.ActiveHours)
+	if err != nil {
+		return true, 0
+	}
+	minute := t.Hour()*60 + t.Minute()
+	if start < end {
+		active = minute >= start && minute < end
+	} else {
+		active = minute >= start || minute < end
+	}
+	if active {
+		return true, 0
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	opens := midnight.Add(time.Duration(start) * time.Minute)
+	if !opens.After(t) {
+		opens = opens.AddDate(0, 0, 1)
+	}
+	return false, opens.Sub(t)
+}
+
+// ruleKey identifies a rule across configuration reloads.
+func ruleKey(rule Rule) string {
+	return rule.Name + "\x00" + strings.Join(rule.Patterns, "\x00")
+}
+
+// queueOutsideHours keeps files matched outside the rule's active hours
+// until the window opens, in wait. Only one deferred batch is scheduled
+// per rule; files queued after it are picked up by takeQueued.
+func queueOutsideHours(rule Rule, batch ruleBatch, wait time.Duration) {
+	if deferBatch == nil {
+		logAt(logger, rule.LogLevel, "Ignoring changes outside the active hours of rule %s", rule.Name)
+		return
+	}
+	key := ruleKey(rule)
+	queuedOutsideHoursMu.Lock()
+	queued, scheduled := queuedOutsideHours[key]
+	for _, file := range batch.files {
+		if !slices.Contains(queued, file) {
+			queued = append(queued, file)
+		}
+	}
+	queuedOutsideHours[key] = queued
+	queuedOutsideHoursMu.Unlock()
+	if !scheduled {
+		logAt(logger, rule.LogLevel, "Queuing changes for rule %s until its active hours start in %s", rule.Name, wait.Round(time.Minute))
+		holdBack(rule, batch, wait)
+	}
+}
+
+// takeQueued adds the files queued outside the rule's active hours to
+// files and clears the queue.
+func takeQueued(rule Rule, files []string) []string {
+	key := ruleKey(rule)
+	queuedOutsideHoursMu.Lock()
+	queued := queuedOutsideHours[key]
+	delete(queuedOutsideHours, key)
+	queuedOutsideHoursMu.Unlock()
+	for _, file := range queued {
+		if !slices.Contains(files, file) {
+			files = append(files, file)
+		}
+	}
+	return files
+}
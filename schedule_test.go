@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that rules are suppressed outside their active hours
+func TestActiveHours(t *testing.T) {
+	defer func(clock func() time.Time) { now = clock }(now)
+	evening := time.Date(2024, 3, 1, 20, 30, 0, 0, time.Local)
+	now = func() time.Time { return evening }
+
+	out := filepath.Join(t.TempDir(), "runs.txt")
+	rule := Rule{
+		Name:        "heavy",
+		ActiveHours: "09:00-18:00",
+		Patterns:    []string{"*.go"},
+		Commands:    []Command{{Cmd: "echo {{.Files}} >> " + out}},
+	}
+	config := Config{Rules: []Rule{rule}}
+	assert.NoError(t, config.Validate())
+
+	ran, err := executeRules(context.Background(), []string{"main.go"}, config)
+	assert.NoError(t, err)
+	assert.False(t, ran)
+	assert.NoFileExists(t, out)
+
+	// Queued changes run together once the window opens
+	var deferred []ruleBatch
+	var waits []time.Duration
+	defer func() { deferBatch = nil }()
+	deferBatch = func(batch ruleBatch, wait time.Duration) {
+		deferred = append(deferred, batch)
+		waits = append(waits, wait)
+	}
+	config.Rules[0].OutsideHours = outsideHoursQueue
+	for _, file := range []string{"a.go", "b.go", "a.go"} {
+		_, err := executeRules(context.Background(), []string{file}, config)
+		assert.NoError(t, err)
+	}
+	assert.NoFileExists(t, out)
+	if assert.Len(t, deferred, 1) {
+		assert.Equal(t, 12*time.Hour+30*time.Minute, waits[0])
+		now = func() time.Time { return evening.Add(waits[0]) }
+		_, err := executeBatch(context.Background(), deferred[0], config)
+		assert.NoError(t, err)
+	}
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "a.go b.go\n", string(data))
+}
+
+// Test active hours spanning midnight
+func TestActiveAtOvernight(t *testing.T) {
+	rule := Rule{ActiveHours: "22:00-06:00"}
+	at := func(hour, minute int) time.Time { return time.Date(2024, 3, 1, hour, minute, 0, 0, time.Local) }
+
+	for _, active := range []time.Time{at(22, 0), at(23, 59), at(0, 0), at(5, 59)} {
+		ok, _ := activeAt(rule, active)
+		assert.True(t, ok, active)
+	}
+	ok, wait := activeAt(rule, at(6, 0))
+	assert.False(t, ok)
+	assert.Equal(t, 16*time.Hour, wait)
+
+	for _, spec := range []string{"9-18", "09:00", "09:00-09:00", "25:00-26:00"} {
+		assert.Error(t, Config{Rules: []Rule{{ActiveHours: spec, Patterns: []string{"*"}}}}.Validate(), spec)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+type commandRunsKey struct{}
+
+// commandRuns records the commands started in one run cycle with
+// project_settle, so a command shared by several rules runs once.
+type commandRuns struct {
+	mu      sync.Mutex
+	started map[string]bool
+}
+
+// withCommandDedup returns a context recording the commands started for
+// one batch of changes.
+func withCommandDedup(ctx context.Context) context.Context {
+	return context.WithValue(ctx, commandRunsKey{}, &commandRuns{started: make(map[string]bool)})
+}
+
+// alreadyStarted records the start of the rendered command cmd and reports
+// whether the same command, with the same environment, was started earlier
+// in the cycle of ctx. It is always false outside project_settle.
+func alreadyStarted(ctx context.Context, cmd Command) bool {
+	runs, ok := ctx.Value(commandRunsKey{}).(*commandRuns)
+	if !ok {
+		return false
+	}
+	key := strings.Join(append([]string{cmd.String()}, cmd.env...), "\x00")
+	runs.mu.Lock()
+	defer runs.mu.Unlock()
+	if runs.started[key] {
+		return true
+	}
+	runs.started[key] = true
+	return false
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that with project_settle a mixed batch runs each matching rule once,
+// no_debounce rules included, and a command shared by rules once
+func TestProjectSettle(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+	watchedPaths.Clear()
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+	for _, name := range []string{"a.go", "b.go", "style.css", "README.md"} {
+		assert.NoError(t, os.WriteFile(name, nil, 0644))
+	}
+	out := filepath.Join(t.TempDir(), "runs.txt")
+	echo := func(s string) Command { return Command{Cmd: "echo " + s + " >> " + out} }
+	config := Config{
+		ProjectSettle: boolPtr(true),
+		Rules: []Rule{
+			{Name: "build", Patterns: []string{"*.go"}, Commands: []Command{echo("build"), echo("bundle")}},
+			{Name: "styles", Patterns: []string{"*.css"}, Commands: []Command{echo("styles"), echo("bundle")}},
+			{Name: "live", NoDebounce: true, Patterns: []string{"*.go"}, Commands: []Command{echo("live")}},
+			{Name: "docs", Patterns: []string{"docs/*.md"}, Commands: []Command{echo("docs")}},
+		},
+	}
+	assert.NoError(t, config.Validate())
+
+	var mu sync.Mutex
+	var started []string
+	defer AddObserver(ObserverFunc(func(e Event) {
+		if e.Kind == RuleStarted {
+			mu.Lock()
+			defer mu.Unlock()
+			started = append(started, e.Rule)
+		}
+	}))()
+
+	// The loop stops after the first run cycle, which must be the settled
+	// batch of every change
+	done := make(chan error, 1)
+	go func() {
+		done <- watchLoop(context.Background(), config, 200*time.Millisecond, 1)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	for _, name := range []string{"a.go", "style.css", "b.go", "README.md", "a.go"} {
+		assert.NoError(t, os.WriteFile(name, []byte("changed"), 0644))
+		time.Sleep(20 * time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no run cycle")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	slices.Sort(started)
+	assert.Equal(t, []string{"build", "live", "styles"}, started)
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	runs := strings.Fields(string(data))
+	slices.Sort(runs)
+	assert.Equal(t, []string{"build", "bundle", "live", "styles"}, runs)
+}
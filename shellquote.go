@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template/parse"
+)
+
+// Values of Command.Substitution.
+const (
+	substitutionQuote = "quote"
+	substitutionRaw   = "raw"
+)
+
+// shellSafe matches values that need no quoting in a POSIX shell.
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes s for a POSIX shell. Values made only of safe
+// characters, as most paths are, are returned unchanged.
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellQuoteValue quotes the printed form of a template value. Lists are
+// quoted element by element, so {{.Files}} still expands to one argument
+// per file.
+func shellQuoteValue(v any) string {
+	var files []string
+	switch v := v.(type) {
+	case FileList:
+		files = v
+	case []string:
+		files = v
+	default:
+		return shellQuote(fmt.Sprint(v))
+	}
+	quoted := make([]string, len(files))
+	for i, file := range files {
+		quoted[i] = shellQuote(file)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// quoteActions appends shellquote to the pipeline of every action that
+// prints a value, like html/template does for its escapers. Conditions of
+// if, range and with are left alone, only their bodies are rewritten.
+func quoteActions(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			quoteActions(child)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+		quote := parse.NewIdentifier("shellquote").SetTree(nil).SetPos(n.Pos)
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args:     []parse.Node{quote},
+		})
+	case *parse.IfNode:
+		quoteActions(n.List)
+		quoteActions(n.ElseList)
+	case *parse.RangeNode:
+		quoteActions(n.List)
+		quoteActions(n.ElseList)
+	case *parse.WithNode:
+		quoteActions(n.List)
+		quoteActions(n.ElseList)
+	}
+}
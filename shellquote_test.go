@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that placeholder values are shell-quoted unless substitution is raw
+func TestShellQuotedPlaceholders(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.txt")
+	injected := filepath.Join(dir, "pwned")
+	file := "a.go; touch " + injected + " #.go"
+	config := Config{
+		Rules: []Rule{{
+			Patterns: []string{"*.go"},
+			Commands: []Command{{Cmd: "printf '%s\\n' {{.File}} > " + out}},
+		}},
+	}
+	assert.NoError(t, config.Validate())
+
+	ran, err := executeRules(context.Background(), []string{file}, config)
+	assert.NoError(t, err)
+	assert.True(t, ran)
+	assert.NoFileExists(t, injected)
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, file+"\n", string(data))
+
+	match := MatchData{Base: "it's.go", Files: FileList{"a b.go", "c.go"}}
+	rendered, err := renderCommand("vet {{.Files}} {{if .Base}}{{.Base}}{{end}}", match)
+	assert.NoError(t, err)
+	assert.Equal(t, `vet 'a b.go' c.go 'it'\''s.go'`, rendered)
+
+	raw, err := renderCommandFields(Command{Cmd: "vet {{.Files}}", Substitution: substitutionRaw}, match)
+	assert.NoError(t, err)
+	assert.Equal(t, "vet a b.go c.go", raw.Cmd)
+	args, err := renderCommandFields(Command{Args: []string{"vet", "{{.Base}}"}}, match)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vet", "it's.go"}, args.Args)
+
+	assert.Error(t, Config{Rules: []Rule{{
+		Patterns: []string{"*.go"},
+		Commands: []Command{{Cmd: "true", Substitution: "escape"}},
+	}}}.Validate())
+}
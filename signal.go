@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// stopSignals are the signals accepted by stop_signal.
+var stopSignals = map[string]syscall.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGKILL": syscall.SIGKILL,
+}
+
+// parseStopSignal parses a signal name such as "SIGINT" or "int". An empty
+// name is SIGTERM.
+func parseStopSignal(name string) (syscall.Signal, error) {
+	if name == "" {
+		return syscall.SIGTERM, nil
+	}
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig, ok := stopSignals[name]
+	if !ok {
+		return 0, fmt.Errorf("unsupported stop signal %q", name)
+	}
+	return sig, nil
+}
+
+// stopSettings returns the signal stopping a command and how long it may
+// take to exit before it is killed.
+func stopSettings(cmd Command) (syscall.Signal, time.Duration) {
+	sig, err := parseStopSignal(cmd.StopSignal)
+	if err != nil {
+		sig = syscall.SIGTERM
+	}
+	timeout := commandWaitDelay
+	if cmd.StopTimeout != "" {
+		if d, err := time.ParseDuration(cmd.StopTimeout); err == nil {
+			timeout = d
+		}
+	}
+	return sig, timeout
+}
+
+// killGroup kills the process group of a cancelled command still running
+// after its stop timeout. It is a variable so tests can observe the kill.
+var killGroup = func(command *exec.Cmd) error {
+	return signalGroup(command, syscall.SIGKILL)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test restarting with the configured stop signal, escalating to SIGKILL
+func TestStopSignal(t *testing.T) {
+	logger.SetOutput(&syncBuffer{})
+	defer logger.SetOutput(os.Stdout)
+
+	got := filepath.Join(t.TempDir(), "signals.txt")
+	ready := filepath.Join(t.TempDir(), "ready")
+	// The trap ignores the signal after recording it, so only SIGKILL
+	// stops the command.
+	cmd := Command{
+		Cmd:         "trap 'echo INT >> " + got + "' INT; touch " + ready + "; while :; do sleep 0.05; done",
+		Parallel:    true,
+		StopSignal:  "int",
+		StopTimeout: "300ms",
+	}
+	assert.NoError(t, Config{Rules: []Rule{{Patterns: []string{"*"}, Commands: []Command{cmd}}}}.Validate())
+
+	assert.NoError(t, executeCommand(context.Background(), cmd, ""))
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(ready)
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	start := time.Now()
+	stopProcess(cmd.String())
+	elapsed := time.Since(start)
+	runningCommands.Wait()
+
+	assert.GreaterOrEqual(t, elapsed, 300*time.Millisecond, "killed before stop_timeout")
+	assert.Less(t, elapsed, 2*time.Second, "not killed after stop_timeout")
+	assert.False(t, isRunning(cmd.String()))
+	data, err := os.ReadFile(got)
+	assert.NoError(t, err)
+	assert.Equal(t, "INT\n", string(data))
+
+	for _, invalid := range []Command{{Cmd: "true", StopSignal: "SIGUSR9"}, {Cmd: "true", StopTimeout: "0s"}} {
+		assert.Error(t, Config{Rules: []Rule{{Patterns: []string{"*"}, Commands: []Command{invalid}}}}.Validate())
+	}
+}
+
+// Test that a cancelled command exiting on its stop signal is not killed
+// once its stop timeout passes
+func TestStopTimeoutAfterExit(t *testing.T) {
+	logger.SetOutput(&syncBuffer{})
+	defer logger.SetOutput(os.Stdout)
+	var kills atomic.Int32
+	defer func(kill func(*exec.Cmd) error) { killGroup = kill }(killGroup)
+	killGroup = func(*exec.Cmd) error {
+		kills.Add(1)
+		return nil
+	}
+
+	cmd := Command{Cmd: "sleep 5", Timeout: "100ms", StopTimeout: "200ms"}
+	assert.Error(t, executeCommand(context.Background(), cmd, ""))
+	time.Sleep(400 * time.Millisecond)
+	assert.Zero(t, kills.Load(), "the process group was killed after the command exited")
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Output parsers accepted by a command's output_parser.
+const (
+	parserGoTest = "gotest"
+	parserJest   = "jest"
+)
+
+// TestSummary counts the tests reported in a command's output.
+type TestSummary struct {
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped,omitempty"`
+}
+
+// String returns a summary such as "3 passed, 1 failed".
+func (s TestSummary) String() string {
+	summary := fmt.Sprintf("%d passed, %d failed", s.Passed, s.Failed)
+	if s.Skipped > 0 {
+		summary += fmt.Sprintf(", %d skipped", s.Skipped)
+	}
+	return summary
+}
+
+var (
+	// goTestResult matches the result line of a test in verbose go test
+	// output, including subtests.
+	goTestResult = regexp.MustCompile(`^\s*--- (PASS|FAIL|SKIP): `)
+	// goPackageResult matches the result line of a package, as printed
+	// without -v.
+	goPackageResult = regexp.MustCompile(`^(ok|FAIL)\s+\S+`)
+	// jestCount matches a count of the "Tests:" line of jest, e.g.
+	// "Tests:       1 failed, 2 skipped, 3 passed, 6 total".
+	jestCount = regexp.MustCompile(`(\d+) (passed|failed|skipped|todo)`)
+)
+
+// parseTestOutput extracts the test counts from a command's output with the
+// given parser. It reports false when the output contains no results.
+func parseTestOutput(parser, output string) (TestSummary, bool) {
+	switch parser {
+	case parserGoTest:
+		return parseGoTest(output)
+	case parserJest:
+		return parseJest(output)
+	}
+	return TestSummary{}, false
+}
+
+// parseGoTest counts the tests of verbose go test output, or the packages
+// when no test results were printed.
+func parseGoTest(output string) (TestSummary, bool) {
+	var tests, packages TestSummary
+	found := false
+	for _, line := range strings.Split(output, "\n") {
+		if m := goTestResult.FindStringSubmatch(line); m != nil {
+			found = true
+			switch m[1] {
+			case "PASS":
+				tests.Passed++
+			case "FAIL":
+				tests.Failed++
+			case "SKIP":
+				tests.Skipped++
+			}
+		} else if m := goPackageResult.FindStringSubmatch(line); m != nil {
+			if m[1] == "ok" {
+				packages.Passed++
+			} else {
+				packages.Failed++
+			}
+		}
+	}
+	if found {
+		return tests, true
+	}
+	return packages, packages != TestSummary{}
+}
+
+// parseJest reads the counts of the last "Tests:" summary line of jest.
+func parseJest(output string) (TestSummary, bool) {
+	var summary TestSummary
+	found := false
+	for _, line := range strings.Split(output, "\n") {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(line), "Tests:")
+		if !ok {
+			continue
+		}
+		found = true
+		summary = TestSummary{}
+		for _, m := range jestCount.FindAllStringSubmatch(rest, -1) {
+			n, _ := strconv.Atoi(m[1])
+			switch m[2] {
+			case "passed":
+				summary.Passed = n
+			case "failed":
+				summary.Failed = n
+			case "skipped", "todo":
+				summary.Skipped += n
+			}
+		}
+	}
+	return summary, found
+}
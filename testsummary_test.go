@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const goTestOutput = `=== RUN   TestParse
+--- PASS: TestParse (0.00s)
+=== RUN   TestWatch
+=== RUN   TestWatch/create
+    --- PASS: TestWatch/create (0.01s)
+=== RUN   TestWatch/remove
+    main_test.go:42: expected 1, got 2
+    --- FAIL: TestWatch/remove (0.01s)
+--- FAIL: TestWatch (0.02s)
+=== RUN   TestNetwork
+    main_test.go:50: offline
+--- SKIP: TestNetwork (0.00s)
+FAIL
+FAIL	example.com/app	0.031s
+`
+
+const jestOutput = `PASS src/a.test.js
+FAIL src/b.test.js
+
+Test Suites: 1 failed, 1 passed, 2 total
+Tests:       1 failed, 2 skipped, 3 passed, 6 total
+Snapshots:   0 total
+`
+
+// Test reading test counts from go test and jest output
+func TestParseTestOutput(t *testing.T) {
+	summary, ok := parseTestOutput("gotest", goTestOutput)
+	assert.True(t, ok)
+	assert.Equal(t, TestSummary{Passed: 2, Failed: 2, Skipped: 1}, summary)
+	assert.Equal(t, "2 passed, 2 failed, 1 skipped", summary.String())
+
+	// Without -v, packages are counted
+	summary, ok = parseTestOutput("gotest", "ok  \texample.com/app\t0.1s\nFAIL\texample.com/app/db\t0.2s\n?   \texample.com/app/cmd\t[no test files]\n")
+	assert.True(t, ok)
+	assert.Equal(t, TestSummary{Passed: 1, Failed: 1}, summary)
+
+	summary, ok = parseTestOutput("jest", jestOutput)
+	assert.True(t, ok)
+	assert.Equal(t, TestSummary{Passed: 3, Failed: 1, Skipped: 2}, summary)
+	assert.Equal(t, "3 passed, 1 failed, 2 skipped", summary.String())
+
+	_, ok = parseTestOutput("gotest", "build failed\n")
+	assert.False(t, ok)
+
+	// The summary reaches observers once the command finished
+	var mu sync.Mutex
+	var events []Event
+	defer AddObserver(ObserverFunc(func(e Event) {
+		if e.Kind == TestsSummarized {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, e)
+		}
+	}))()
+	cmd := Command{Name: "tests", Cmd: "printf '%s\\n' '--- PASS: TestA (0.00s)' '--- PASS: TestB (0.00s)'", OutputParser: "gotest"}
+	assert.NoError(t, executeCommand(context.Background(), cmd, ""))
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "tests", events[0].CommandName)
+		assert.Equal(t, &TestSummary{Passed: 2}, events[0].Tests)
+	}
+
+	invalid := Config{Rules: []Rule{{Commands: []Command{{Cmd: "npm test", OutputParser: "mocha"}}}}}
+	assert.ErrorContains(t, invalid.Validate(), "output_parser")
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// otlpTimeout bounds each export to the OTLP endpoint.
+const otlpTimeout = 5 * time.Second
+
+// Span is a finished span of a run cycle trace: the cycle itself, a rule
+// run within it, or a command run by a rule.
+type Span struct {
+	TraceID    string
+	SpanID     string
+	ParentID   string // Empty for the cycle span
+	Name       string
+	Start, End time.Time
+	Attributes map[string]any // string, []string or int values
+	Failed     bool
+}
+
+// SpanExporter receives the spans of each finished run cycle.
+type SpanExporter interface {
+	ExportSpans([]Span) error
+}
+
+// tracingObserver turns lifecycle events into a span per run cycle, with
+// child spans per rule and per command. It is only registered with
+// --otel-endpoint, so tracing costs nothing otherwise.
+type tracingObserver struct {
+	exporter SpanExporter
+
+	mu sync.Mutex
+	// cycles holds the spans of running cycles, by run ID. Running rule
+	// and command spans are found by their name.
+	cycles map[string]*tracedCycle
+}
+
+type tracedCycle struct {
+	root  *Span
+	rules map[string]*Span
+	// commands holds the running command spans by rule and command.
+	commands map[[2]string]*Span
+	spans    []*Span
+}
+
+func newTracingObserver(exporter SpanExporter) *tracingObserver {
+	return &tracingObserver{exporter: exporter, cycles: make(map[string]*tracedCycle)}
+}
+
+func (o *tracingObserver) OnEvent(e Event) {
+	if e.RunID == "" {
+		return
+	}
+	o.mu.Lock()
+	var finished []Span
+	switch e.Kind {
+	case CycleStarted:
+		root := &Span{TraceID: newSpanID(16), SpanID: newSpanID(8), Name: "cycle", Start: e.Time,
+			Attributes: map[string]any{"go_watch.run_id": e.RunID, "go_watch.files": e.Files}}
+		o.cycles[e.RunID] = &tracedCycle{root: root, rules: make(map[string]*Span), commands: make(map[[2]string]*Span), spans: []*Span{root}}
+	case RuleStarted:
+		if c, ok := o.cycles[e.RunID]; ok {
+			c.rules[e.Rule] = c.child(c.root, "rule "+ruleLabel(e.Rule), e.Time,
+				map[string]any{"go_watch.rule": e.Rule, "go_watch.files": e.Files})
+		}
+	case CommandStarted:
+		if c, ok := o.cycles[e.RunID]; ok && c.rules[e.Rule] != nil {
+			attributes := map[string]any{"go_watch.command": e.Command, "go_watch.files": e.Files}
+			if e.CommandName != "" {
+				attributes["go_watch.command_name"] = e.CommandName
+			}
+			c.commands[[2]string{e.Rule, e.Command}] = c.child(c.rules[e.Rule], "command", e.Time, attributes)
+		}
+	case CommandFinished:
+		if c, ok := o.cycles[e.RunID]; ok {
+			key := [2]string{e.Rule, e.Command}
+			if span := c.commands[key]; span != nil {
+				span.End, span.Failed = e.Time, e.Failed
+				span.Attributes["go_watch.exit_code"] = e.ExitCode
+				delete(c.commands, key)
+			}
+		}
+	case RuleFinished:
+		if c, ok := o.cycles[e.RunID]; ok {
+			if span := c.rules[e.Rule]; span != nil {
+				span.End, span.Failed = e.Time, e.Failed
+				delete(c.rules, e.Rule)
+			}
+		}
+	case CycleFinished:
+		if c, ok := o.cycles[e.RunID]; ok {
+			delete(o.cycles, e.RunID)
+			c.root.End, c.root.Failed = e.Time, e.Failed
+			// Cycles that ran no rule are not worth a trace
+			if len(c.spans) > 1 {
+				for _, span := range c.spans {
+					if span.End.IsZero() {
+						span.End = e.Time
+					}
+					finished = append(finished, *span)
+				}
+			}
+		}
+	}
+	o.mu.Unlock()
+
+	if len(finished) > 0 {
+		if err := o.exporter.ExportSpans(finished); err != nil {
+			logger.Printf("Failed to export trace of run %s: %v", e.RunID, err)
+		}
+	}
+}
+
+// child starts a span below parent.
+func (c *tracedCycle) child(parent *Span, name string, start time.Time, attributes map[string]any) *Span {
+	span := &Span{TraceID: parent.TraceID, SpanID: newSpanID(8), ParentID: parent.SpanID, Name: name, Start: start, Attributes: attributes}
+	c.spans = append(c.spans, span)
+	return span
+}
+
+// ruleLabel names a rule in span names, which must not be empty.
+func ruleLabel(rule string) string {
+	if rule == "" {
+		return unnamedRule
+	}
+	return rule
+}
+
+// newSpanID returns n random bytes in hex, the form of OTLP trace and
+// span IDs.
+func newSpanID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// otlpExporter posts spans to an OTLP/HTTP collector in the JSON encoding.
+type otlpExporter struct {
+	endpoint string // e.g. http://localhost:4318
+	client   *http.Client
+}
+
+func newOTLPExporter(endpoint string) *otlpExporter {
+	return &otlpExporter{endpoint: strings.TrimSuffix(endpoint, "/"), client: &http.Client{Timeout: otlpTimeout}}
+}
+
+func (x *otlpExporter) ExportSpans(spans []Span) error {
+	body, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+	resp, err := x.client.Post(x.endpoint+"/v1/traces", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+// otlpRequest builds the body of an OTLP/HTTP JSON trace export.
+func otlpRequest(spans []Span) map[string]any {
+	var encoded []map[string]any
+	for _, span := range spans {
+		s := map[string]any{
+			"traceId":           span.TraceID,
+			"spanId":            span.SpanID,
+			"name":              span.Name,
+			"kind":              1, // SPAN_KIND_INTERNAL
+			"startTimeUnixNano": strconv.FormatInt(span.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(span.End.UnixNano(), 10),
+			"attributes":        otlpAttributes(span.Attributes),
+		}
+		if span.ParentID != "" {
+			s["parentSpanId"] = span.ParentID
+		}
+		if span.Failed {
+			s["status"] = map[string]any{"code": 2} // STATUS_CODE_ERROR
+		}
+		encoded = append(encoded, s)
+	}
+	return map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": otlpAttributes(map[string]any{"service.name": "go-watch"}),
+			},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "go-watch"},
+				"spans": encoded,
+			}},
+		}},
+	}
+}
+
+// otlpAttributes encodes attributes as OTLP key-value pairs, sorted by key.
+func otlpAttributes(attributes map[string]any) []any {
+	var encoded []any
+	for _, key := range slices.Sorted(maps.Keys(attributes)) {
+		encoded = append(encoded, map[string]any{"key": key, "value": otlpValue(attributes[key])})
+	}
+	return encoded
+}
+
+func otlpValue(value any) map[string]any {
+	switch v := value.(type) {
+	case int:
+		// 64-bit integers are strings in the JSON encoding
+		return map[string]any{"intValue": strconv.Itoa(v)}
+	case []string:
+		var values []any
+		for _, s := range v {
+			values = append(values, map[string]any{"stringValue": s})
+		}
+		return map[string]any{"arrayValue": map[string]any{"values": values}}
+	default:
+		return map[string]any{"stringValue": fmt.Sprint(v)}
+	}
+}
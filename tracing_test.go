@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryExporter keeps exported spans for tests.
+type memoryExporter struct {
+	mu     sync.Mutex
+	traces [][]Span
+}
+
+func (m *memoryExporter) ExportSpans(spans []Span) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.traces = append(m.traces, spans)
+	return nil
+}
+
+// Test the span tree of one run cycle: the cycle, its rules and their
+// commands
+func TestTracingSpanTree(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "main.go")
+	assert.NoError(t, os.WriteFile(file, nil, 0644))
+	config := Config{
+		OnFailure: failureContinue,
+		Rules: []Rule{
+			{Name: "build", Patterns: []string{file}, Commands: []Command{{Cmd: "true"}, {Cmd: "exit 3"}}},
+			{Name: "lint", Patterns: []string{file}, Commands: []Command{{Cmd: "true"}}},
+			{Name: "docs", Patterns: []string{"*.md"}, Commands: []Command{{Cmd: "true"}}},
+		},
+	}
+	exporter := &memoryExporter{}
+	defer AddObserver(newTracingObserver(exporter))()
+
+	_, err := executeBatch(context.Background(), ruleBatch{files: []string{file}}, config)
+	assert.NoError(t, err)
+	// A batch matching no rule is not traced
+	_, err = executeBatch(context.Background(), ruleBatch{files: []string{"README.txt"}}, config)
+	assert.NoError(t, err)
+
+	exporter.mu.Lock()
+	defer exporter.mu.Unlock()
+	if !assert.Len(t, exporter.traces, 1) {
+		return
+	}
+	byID := make(map[string]Span)
+	var root Span
+	for _, span := range exporter.traces[0] {
+		byID[span.SpanID] = span
+		if span.ParentID == "" {
+			root = span
+		}
+		assert.False(t, span.End.Before(span.Start), span.Name)
+	}
+	assert.Equal(t, "cycle", root.Name)
+	assert.True(t, root.Failed)
+
+	// tree maps each span name to the names of its children
+	tree := make(map[string][]string)
+	for _, span := range exporter.traces[0] {
+		assert.Equal(t, root.TraceID, span.TraceID)
+		if span.ParentID != "" {
+			parent := byID[span.ParentID]
+			label := span.Name
+			if command, ok := span.Attributes["go_watch.command"]; ok {
+				label += " " + command.(string)
+			}
+			tree[parent.Name] = append(tree[parent.Name], label)
+		}
+	}
+	assert.Equal(t, map[string][]string{
+		"cycle":      {"rule build", "rule lint"},
+		"rule build": {"command true", "command exit 3"},
+		"rule lint":  {"command true"},
+	}, tree)
+
+	for _, span := range exporter.traces[0] {
+		if span.Attributes["go_watch.command"] == "exit 3" {
+			assert.Equal(t, 3, span.Attributes["go_watch.exit_code"])
+			assert.True(t, span.Failed)
+		}
+		if span.Name == "rule build" {
+			assert.Equal(t, []string{file}, span.Attributes["go_watch.files"])
+		}
+	}
+}
+
+// Test that the OTLP exporter posts spans in the OTLP/HTTP JSON encoding
+func TestOTLPExporter(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+	}))
+	defer server.Close()
+
+	spans := []Span{
+		{TraceID: "0123456789abcdef0123456789abcdef", SpanID: "0123456789abcdef", Name: "cycle"},
+		{TraceID: "0123456789abcdef0123456789abcdef", SpanID: "fedcba9876543210", ParentID: "0123456789abcdef", Name: "rule build",
+			Attributes: map[string]any{"go_watch.exit_code": 3}, Failed: true},
+	}
+	assert.NoError(t, newOTLPExporter(server.URL+"/").ExportSpans(spans))
+
+	scope := body["resourceSpans"].([]any)[0].(map[string]any)["scopeSpans"].([]any)[0].(map[string]any)
+	encoded := scope["spans"].([]any)
+	if assert.Len(t, encoded, 2) {
+		child := encoded[1].(map[string]any)
+		assert.Equal(t, "0123456789abcdef", child["parentSpanId"])
+		assert.Equal(t, map[string]any{"code": float64(2)}, child["status"])
+		assert.Equal(t, []any{map[string]any{"key": "go_watch.exit_code", "value": map[string]any{"intValue": "3"}}}, child["attributes"])
+		assert.NotContains(t, encoded[0].(map[string]any), "parentSpanId")
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// tuiLogLines is how many log lines the dashboard keeps.
+	tuiLogLines = 12
+	// tuiRefreshInterval is how often the dashboard is redrawn.
+	tuiRefreshInterval = 250 * time.Millisecond
+	// unnamedRule labels rules without a name on the dashboard.
+	unnamedRule = "(unnamed)"
+)
+
+// Rule states shown on the dashboard.
+const (
+	ruleRunning = "running"
+	ruleOK      = "ok"
+	ruleFailed  = "failed"
+)
+
+// tuiModel is the state rendered by the dashboard. It is built only from
+// observer events and log lines, so it can be tested without a terminal.
+type tuiModel struct {
+	watched      int
+	lastChange   string
+	lastChangeAt time.Time
+	rules        []string
+	status       map[string]string
+	logs         []string
+}
+
+func newTUIModel() *tuiModel {
+	return &tuiModel{status: make(map[string]string)}
+}
+
+// Update applies an observer event to the model.
+func (m *tuiModel) Update(e Event) {
+	switch e.Kind {
+	case ChangeDetected:
+		if len(e.Files) > 0 {
+			m.lastChange = e.Files[0]
+			m.lastChangeAt = e.Time
+		}
+	case RuleStarted:
+		m.setStatus(e.Rule, ruleRunning)
+	case RuleFinished:
+		if e.Failed {
+			m.setStatus(e.Rule, ruleFailed)
+		} else {
+			m.setStatus(e.Rule, ruleOK)
+		}
+	}
+}
+
+func (m *tuiModel) setStatus(rule, status string) {
+	if rule == "" {
+		rule = unnamedRule
+	}
+	if _, ok := m.status[rule]; !ok {
+		m.rules = append(m.rules, rule)
+	}
+	m.status[rule] = status
+}
+
+// Log appends a line to the log pane, dropping the oldest lines.
+func (m *tuiModel) Log(line string) {
+	m.logs = append(m.logs, line)
+	if len(m.logs) > tuiLogLines {
+		m.logs = m.logs[len(m.logs)-tuiLogLines:]
+	}
+}
+
+// View renders the dashboard.
+func (m *tuiModel) View() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "go-watch  watching %d paths\n", m.watched)
+	if m.lastChange == "" {
+		b.WriteString("Last change: none\n")
+	} else {
+		fmt.Fprintf(&b, "Last change: %s at %s\n", m.lastChange, m.lastChangeAt.Format("15:04:05"))
+	}
+	b.WriteString("\nRules:\n")
+	for _, rule := range m.rules {
+		fmt.Fprintf(&b, "  %-8s %s\n", m.status[rule], rule)
+	}
+	b.WriteString("\nLog:\n")
+	for _, line := range m.logs {
+		fmt.Fprintf(&b, "  %s\n", line)
+	}
+	return b.String()
+}
+
+// tui renders the model to a terminal. It is an Observer and the writer of
+// the logger and of command output while active.
+type tui struct {
+	out io.Writer
+
+	mu    sync.Mutex
+	model *tuiModel
+}
+
+func (t *tui) OnEvent(e Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.model.Update(e)
+}
+
+// Write adds the logged lines to the log pane.
+func (t *tui) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		t.model.Log(line)
+	}
+	return len(p), nil
+}
+
+// commandOutput returns a writer adding the output of commands to the log
+// pane, one line at a time. Each stream needs a writer of its own, so
+// partial lines of stdout and stderr are not mixed up.
+func (t *tui) commandOutput() io.Writer {
+	return &tuiOutput{t: t}
+}
+
+// tuiOutput holds back the partial last line of command output until it is
+// complete.
+type tuiOutput struct {
+	t *tui
+
+	mu      sync.Mutex
+	partial []byte
+}
+
+func (o *tuiOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.partial = append(o.partial, p...)
+	if i := bytes.LastIndexByte(o.partial, '\n'); i >= 0 {
+		_, _ = o.t.Write(o.partial[:i+1])
+		o.partial = append(o.partial[:0], o.partial[i+1:]...)
+	}
+	return len(p), nil
+}
+
+// render clears the screen and draws the current state.
+func (t *tui) render() {
+	watched := watchedPaths.Len()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.model.watched = watched
+	fmt.Fprint(t.out, "\033[H\033[2J"+t.model.View())
+}
+
+// startTUI shows the dashboard on stdout until ctx is cancelled or the
+// returned function is called. When stdout is not a terminal it logs as
+// usual instead.
+func startTUI(ctx context.Context) func() {
+	if !isTerminal(os.Stdout) {
+		logger.Println("Stdout is not a terminal, --tui falls back to logging")
+		return func() {}
+	}
+	t := &tui{out: os.Stdout, model: newTUIModel()}
+	previous := logger.Writer()
+	logger.SetOutput(t)
+	previousStdout, previousStderr := commandOutput()
+	setCommandOutput(t.commandOutput(), t.commandOutput())
+	remove := AddObserver(t)
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(tuiRefreshInterval)
+		defer ticker.Stop()
+		for {
+			t.render()
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+		remove()
+		setCommandOutput(previousStdout, previousStderr)
+		logger.SetOutput(previous)
+	}
+}
+
+// isTerminal reports whether f is a character device such as a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
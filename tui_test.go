@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the dashboard state built from synthetic events
+func TestTUIModelUpdate(t *testing.T) {
+	m := newTUIModel()
+	at := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	m.Update(Event{Kind: ChangeDetected, Time: at, Files: []string{"main.go"}})
+	m.Update(Event{Kind: RuleStarted, Rule: "build"})
+	m.Update(Event{Kind: RuleStarted, Rule: "test"})
+	assert.Equal(t, []string{"build", "test"}, m.rules)
+	assert.Equal(t, ruleRunning, m.status["build"])
+
+	m.Update(Event{Kind: RuleFinished, Rule: "build"})
+	m.Update(Event{Kind: RuleFinished, Rule: "test", Failed: true})
+	m.Update(Event{Kind: RuleStarted})
+	assert.Equal(t, ruleOK, m.status["build"])
+	assert.Equal(t, ruleFailed, m.status["test"])
+	assert.Equal(t, ruleRunning, m.status[unnamedRule])
+
+	for i := 0; i < tuiLogLines+3; i++ {
+		m.Log(fmt.Sprintf("line %d", i))
+	}
+	assert.Len(t, m.logs, tuiLogLines)
+	assert.Equal(t, "line 3", m.logs[0])
+
+	m.watched = 7
+	view := m.View()
+	assert.Contains(t, view, "watching 7 paths")
+	assert.Contains(t, view, "Last change: main.go at 15:04:05")
+	assert.Contains(t, view, "ok       build")
+	assert.Contains(t, view, "failed   test")
+	assert.Contains(t, view, "line 14")
+	assert.NotContains(t, view, "line 2\n")
+}
+
+// Test that command output ends up in the log pane line by line
+func TestTUICommandOutput(t *testing.T) {
+	ui := &tui{model: newTUIModel()}
+	stdout, stderr := ui.commandOutput(), ui.commandOutput()
+	fmt.Fprint(stdout, "building")
+	fmt.Fprint(stderr, "warning: unused\n")
+	assert.Equal(t, []string{"warning: unused"}, ui.model.logs)
+	fmt.Fprint(stdout, " done\nok\n")
+	assert.Equal(t, []string{"warning: unused", "building done", "ok"}, ui.model.logs)
+
+	defer setCommandOutput(commandOutput())
+	setCommandOutput(stdout, stderr)
+	assert.NoError(t, executeCommand(context.Background(), Command{Cmd: "echo from command"}, ""))
+	assert.Contains(t, ui.model.logs, "from command")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// withinDir reports whether path is dir or lies under it, after making
+// both absolute and clean, and returns path relative to dir.
+func withinDir(dir, path string) (string, bool) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(absDir, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// matchWatchDir returns the first of the rule's watch_dirs the file lies
+// under, joined with the rule root.
+func matchWatchDir(rule Rule, file string) (string, bool) {
+	for _, dir := range rule.WatchDirs {
+		dir = rulePattern(rule, dir)
+		if _, ok := withinDir(dir, file); ok {
+			return dir, true
+		}
+	}
+	return "", false
+}
+
+// watchDirTree adds dir and every directory below it to the watcher,
+// skipping ignored and hidden ones, and returns how many were found.
+func watchDirTree(dir string, config Config) int {
+	found := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			logger.Printf("Failed to walk %s: %v", path, err)
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && (isIgnoredDir(path, config.IgnoreDirs) || (ignoreHidden(config) && isHidden(path))) {
+			return filepath.SkipDir
+		}
+		found++
+		if !isWatched(path) {
+			watchPath(path, dir)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		logger.Printf("Failed to watch directory %s: %v", dir, err)
+	}
+	return found
+}
+
+// watchNewDir watches a directory created under one of the rules'
+// watch_dirs, along with anything already created inside it.
+func watchNewDir(path string, config Config) {
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return
+	}
+	for _, rule := range config.Rules {
+		if _, ok := matchWatchDir(rule, path); ok {
+			watchDirTree(path, ruleWatchConfig(rule, config))
+			return
+		}
+	}
+}
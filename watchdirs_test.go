@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that watch_dirs fires for changes at any depth under the directory
+func TestWatchDirs(t *testing.T) {
+	var err error
+	watcher, err = fsnotify.NewWatcher()
+	assert.NoError(t, err)
+	defer watcher.Close()
+
+	dir := t.TempDir()
+	nested := filepath.Join(dir, "migrations", "2024", "q1", "deep")
+	assert.NoError(t, os.MkdirAll(nested, 0755))
+	out := filepath.Join(t.TempDir(), "runs.txt")
+	config := Config{
+		Rules: []Rule{{
+			Name: "migrate",
+			// A trailing separator and dot segments are normalized away
+			WatchDirs: []string{filepath.Join(dir, "migrations") + "/./"},
+			Commands:  []Command{{Cmd: "echo {{.Base}} >> " + out}},
+		}},
+	}
+	assert.NoError(t, config.Validate())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- watchLoop(context.Background(), config, 50*time.Millisecond, 3)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(nested, "001_init.sql"), nil, 0644))
+	time.Sleep(300 * time.Millisecond)
+
+	// Directories created later are watched as well
+	later := filepath.Join(dir, "migrations", "2025")
+	assert.NoError(t, os.Mkdir(later, 0755))
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, os.WriteFile(filepath.Join(later, "002_users.sql"), nil, 0644))
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("rule did not fire for nested changes")
+	}
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	// Creating the directory is a change under migrations too
+	assert.Equal(t, "001_init.sql\n2025\n002_users.sql\n", string(data))
+
+	matched, _ := matchFiles(config.Rules[0], []string{filepath.Join(dir, "migrations-old", "x.sql"), filepath.Join(dir, "migrations")})
+	assert.Equal(t, []string{filepath.Join(dir, "migrations")}, matched)
+}
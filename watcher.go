@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// RuleResult is the outcome of one rule in RunOnce: the matched rule and
+// files, and each command with its exit code.
+type RuleResult = RunReport
+
+// Watcher evaluates the rules of a configuration. RunOnce runs them
+// synchronously for a set of paths, without a file watcher, which is how
+// integrations can test their rules.
+type Watcher struct {
+	config Config
+}
+
+// NewWatcher validates the configuration and returns a Watcher for it. The
+// configuration gets the same defaults as on the command line, such as the
+// default ignored directories and extension patterns. Errors wrap
+// ErrInvalidConfig.
+func NewWatcher(config Config) (*Watcher, error) {
+	config, err := normalizeConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	return &Watcher{config: config}, nil
+}
+
+// RunOnce runs every rule matching at least one of the paths, as if they
+// had changed, and returns a result per matching rule. Paths matching no
+// rule give no results. The error is the *CommandError of a failed command
+// with the "exit" policy, which stops the remaining rules.
+func (w *Watcher) RunOnce(paths []string) ([]RuleResult, error) {
+	var kept []string
+	for _, path := range paths {
+		if !isIgnoredFile(path, w.config) {
+			kept = append(kept, path)
+		}
+	}
+	return executeBatch(context.Background(), ruleBatch{files: kept}, w.config)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the structured results of RunOnce
+func TestWatcherRunOnce(t *testing.T) {
+	w, err := NewWatcher(Config{
+		Rules: []Rule{
+			{
+				Name:     "build",
+				Patterns: []string{"*.go"},
+				Commands: []Command{{Name: "vet", Cmd: "true"}, {Name: "compile", Cmd: "exit 3"}},
+			},
+			{
+				Name:     "test",
+				Needs:    []string{"build"},
+				Patterns: []string{"*.go"},
+				Commands: []Command{{Cmd: "true"}},
+			},
+			{
+				Name:     "docs",
+				Patterns: []string{"*.md"},
+				Commands: []Command{{Cmd: "true"}},
+			},
+		},
+		OnFailure: failureContinue,
+	})
+	assert.NoError(t, err)
+
+	results, err := w.RunOnce([]string{"main.go", "main.go.swp"})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, "build", results[0].Rule)
+		assert.Equal(t, []string{"main.go"}, results[0].Files)
+		assert.True(t, results[0].Failed())
+		if assert.Len(t, results[0].Commands, 2) {
+			assert.Equal(t, 0, results[0].Commands[0].ExitCode)
+			assert.Equal(t, "compile", results[0].Commands[1].Name)
+			assert.Equal(t, 3, results[0].Commands[1].ExitCode)
+		}
+		assert.Equal(t, "test", results[1].Rule)
+		assert.True(t, results[1].Skipped)
+	}
+
+	results, err = w.RunOnce([]string{"image.png"})
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+
+	_, err = NewWatcher(Config{OnFailure: "retry"})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
+
+// Test that NewWatcher applies the defaults of the command line
+func TestWatcherNormalizesConfig(t *testing.T) {
+	w, err := NewWatcher(Config{
+		Rules: []Rule{
+			{Name: "go", Extensions: []string{"go"}, Commands: []Command{{Cmd: "true"}}},
+		},
+	})
+	assert.NoError(t, err)
+
+	results, err := w.RunOnce([]string{"node_modules/dep.go"})
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+
+	results, err = w.RunOnce([]string{"main.go"})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "go", results[0].Rule)
+	}
+}
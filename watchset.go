@@ -0,0 +1,109 @@
+package main
+
+import (
+	"maps"
+	"sync"
+)
+
+// watchSet tracks the paths added to the watcher, or polled by the
+// fallback poller, and the pattern that resolved each of them. Adding a
+// path twice and removing a path that is not there are no-ops, so
+// registration code can reserve a path before adding it to the watcher,
+// and release it again if that fails. It is safe for concurrent use.
+type watchSet struct {
+	mu    sync.Mutex
+	paths map[string]watchEntry
+}
+
+// watchEntry is a path of a watchSet.
+type watchEntry struct {
+	pattern string
+	// polled is set for paths the fallback poller watches instead of the
+	// native watcher.
+	polled bool
+}
+
+func newWatchSet() *watchSet {
+	return &watchSet{paths: make(map[string]watchEntry)}
+}
+
+// Add records path as resolved by pattern. It reports false, leaving the
+// recorded pattern alone, when path is already in the set.
+func (s *watchSet) Add(path, pattern string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.paths[path]; ok {
+		return false
+	}
+	s.paths[path] = watchEntry{pattern: pattern}
+	return true
+}
+
+// SetPolled tags a path of the set as polled.
+func (s *watchSet) SetPolled(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.paths[path]; ok {
+		entry.polled = true
+		s.paths[path] = entry
+	}
+}
+
+// Polled reports whether path is in the set and polled.
+func (s *watchSet) Polled(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paths[path].polled
+}
+
+// Remove drops path from the set and returns the pattern that resolved
+// it. It reports false when path was not in the set.
+func (s *watchSet) Remove(path string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.paths[path]
+	delete(s.paths, path)
+	return entry.pattern, ok
+}
+
+// Has reports whether path is in the set.
+func (s *watchSet) Has(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.paths[path]
+	return ok
+}
+
+// Len returns the number of paths in the set.
+func (s *watchSet) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.paths)
+}
+
+// Count returns the number of paths resolved by pattern.
+func (s *watchSet) Count(pattern string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, entry := range s.paths {
+		if entry.pattern == pattern {
+			n++
+		}
+	}
+	return n
+}
+
+// Paths returns a copy of the set.
+func (s *watchSet) Paths() map[string]watchEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.paths)
+}
+
+// Clear empties the set.
+func (s *watchSet) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paths = make(map[string]watchEntry)
+}
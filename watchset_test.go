@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that adding and removing paths is idempotent and keeps the counts
+// right
+func TestWatchSet(t *testing.T) {
+	s := newWatchSet()
+	assert.True(t, s.Add("main.go", "*.go"))
+	assert.True(t, s.Add("util.go", "*.go"))
+	assert.True(t, s.Add("go.mod", "go.mod"))
+	assert.Equal(t, 3, s.Len())
+
+	// A second add keeps the first pattern
+	assert.False(t, s.Add("main.go", "**/*.go"))
+	assert.Equal(t, 3, s.Len())
+	assert.Equal(t, 2, s.Count("*.go"))
+	assert.Equal(t, 0, s.Count("**/*.go"))
+	assert.True(t, s.Has("main.go"))
+
+	pattern, ok := s.Remove("main.go")
+	assert.True(t, ok)
+	assert.Equal(t, "*.go", pattern)
+	assert.False(t, s.Has("main.go"))
+	assert.Equal(t, 1, s.Count("*.go"))
+
+	// Removing a path twice, or one never added, changes nothing
+	_, ok = s.Remove("main.go")
+	assert.False(t, ok)
+	_, ok = s.Remove("missing.go")
+	assert.False(t, ok)
+	assert.Equal(t, 2, s.Len())
+
+	// A removed path can be added again
+	assert.True(t, s.Add("main.go", "**/*.go"))
+	assert.Equal(t, 1, s.Count("**/*.go"))
+
+	// Polled paths count as watched
+	s.SetPolled("main.go")
+	assert.True(t, s.Polled("main.go"))
+	assert.True(t, s.Has("main.go"))
+	assert.False(t, s.Add("main.go", "*.go"))
+	s.SetPolled("missing.go")
+	assert.False(t, s.Has("missing.go"))
+
+	s.Clear()
+	assert.Equal(t, 0, s.Len())
+	assert.False(t, s.Has("util.go"))
+}
+
+// Test that concurrent adds of the same path let exactly one caller add it
+func TestWatchSetConcurrentAdd(t *testing.T) {
+	s := newWatchSet()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	added := make(map[string]int)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				path := fmt.Sprintf("dir%d", j)
+				if s.Add(path, "*") {
+					mu.Lock()
+					added[path]++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 100, s.Len())
+	assert.Len(t, added, 100)
+	for path, n := range added {
+		assert.Equal(t, 1, n, path)
+	}
+}
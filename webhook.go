@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultWebhookTimeout bounds a webhook delivery when none is configured.
+const defaultWebhookTimeout = 5 * time.Second
+
+// RunReport is the outcome of running one rule for a batch of changes.
+type RunReport struct {
+	Rule       string          `json:"rule,omitempty"`
+	RunID      string          `json:"run_id,omitempty"`
+	Patterns   []string        `json:"patterns"`
+	Files      []string        `json:"files"`
+	Commands   []CommandResult `json:"commands"`
+	DurationMs int64           `json:"duration_ms"`
+	// Skipped is set when the rule did not run because a rule it needs
+	// failed.
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// Failed reports whether any command of the run failed.
+func (r RunReport) Failed() bool {
+	for _, cmd := range r.Commands {
+		if cmd.Failed || cmd.ExitCode != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// CommandResult is the outcome of a single command. Parallel commands are
+// reported once started, so their exit code is always 0. Failed is also set
+// for commands failed by their output, e.g. a failure_pattern match, whose
+// exit code may be 0.
+type CommandResult struct {
+	Name       string `json:"name,omitempty"`
+	Cmd        string `json:"cmd"`
+	ExitCode   int    `json:"exit_code"`
+	Failed     bool   `json:"failed,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	Parallel   bool   `json:"parallel,omitempty"`
+}
+
+func newCommandResult(cmd Command, err error, duration time.Duration) CommandResult {
+	result := CommandResult{
+		Name:       cmd.Name,
+		Cmd:        cmd.String(),
+		DurationMs: duration.Milliseconds(),
+		Parallel:   cmd.Parallel,
+	}
+	result.Failed = err != nil
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		result.ExitCode = cmdErr.ExitCode
+	} else if err != nil {
+		result.ExitCode = -1
+	}
+	return result
+}
+
+// sendWebhook posts the report to the configured webhook. Delivery failures
+// are logged and otherwise ignored.
+func sendWebhook(config Config, report RunReport) {
+	if err := postWebhook(config, report); err != nil {
+		logWith("run_id", report.RunID).Printf("Failed to deliver webhook to %s: %v", config.WebhookURL, err)
+	}
+}
+
+func postWebhook(config Config, report RunReport) error {
+	timeout := defaultWebhookTimeout
+	if config.WebhookTimeout != "" {
+		parsed, err := time.ParseDuration(config.WebhookTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid webhook timeout: %w", err)
+		}
+		timeout = parsed
+	}
+
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, config.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range config.WebhookHeaders {
+		req.Header.Set(key, value)
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
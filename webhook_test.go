@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the payload posted to the webhook after a rule runs
+func TestWebhookPayload(t *testing.T) {
+	var payload map[string]interface{}
+	var token string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("Authorization")
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+	}))
+	defer server.Close()
+
+	config := Config{
+		WebhookURL:     server.URL,
+		WebhookHeaders: map[string]string{"Authorization": "Bearer secret"},
+		Rules: []Rule{
+			{
+				Name:     "build",
+				Patterns: []string{"*.go"},
+				Commands: []Command{
+					{Cmd: "true"},
+					{Cmd: "exit 4"},
+				},
+			},
+		},
+	}
+
+	executeRules(context.Background(), []string{"main.go", "style.css"}, config)
+
+	assert.Equal(t, "Bearer secret", token)
+	assert.Equal(t, "build", payload["rule"])
+	assert.Equal(t, []interface{}{"*.go"}, payload["patterns"])
+	assert.Equal(t, []interface{}{"main.go"}, payload["files"])
+	assert.Contains(t, payload, "duration_ms")
+
+	commands := payload["commands"].([]interface{})
+	assert.Len(t, commands, 2)
+	first := commands[0].(map[string]interface{})
+	assert.Equal(t, "true", first["cmd"])
+	assert.Equal(t, float64(0), first["exit_code"])
+	assert.Contains(t, first, "duration_ms")
+	second := commands[1].(map[string]interface{})
+	assert.Equal(t, float64(4), second["exit_code"])
+}